@@ -17,11 +17,13 @@
 package commands
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"os"
 
+	"github.com/rotisserie/eris"
 	"github.com/spf13/cobra"
 
 	"github.com/mrlyc/inu/pkg/anonymizer"
@@ -35,6 +37,12 @@ var (
 	anonymizeNoPrint        bool
 	anonymizeOutput         string
 	anonymizeOutputEntities string
+	anonymizeStrict         bool
+	anonymizeEncrypt        bool
+	anonymizeKeyFile        string
+	anonymizeVault          string
+	anonymizeVaultProject   string
+	anonymizeOptions        anonymizerOptions
 )
 
 // NewAnonymizeCmd creates the anonymize command.
@@ -43,17 +51,26 @@ func NewAnonymizeCmd() *cobra.Command {
 		Use:   "anonymize",
 		Short: "Anonymize sensitive information in text",
 		Long: `Anonymize text by detecting and replacing sensitive entities with placeholders.
-The anonymized entities can be saved to a YAML file for later restoration.`,
+The anonymized entities can be saved to a YAML, JSON or JSONL file for later restoration.
+With --encrypt the entities file is encrypted, so it can be kept next to the anonymized text.
+With --vault the entities are stored in an encrypted vault database shared by all documents
+of a project, and values already in the project keep their placeholders.`,
 		RunE: runAnonymize,
 	}
 
 	flags := cmd.Flags()
 	flags.StringVarP(&anonymizeFile, "file", "f", "", "Read input from file")
 	flags.StringVarP(&anonymizeContent, "content", "c", "", "Input content as string")
-	flags.StringSliceVarP(&anonymizeEntityTypes, "entity-types", "t", anonymizer.DefaultEntityTypes, "Entity types to detect (comma-separated)")
+	flags.StringSliceVarP(&anonymizeEntityTypes, "entity-types", "t", anonymizer.DefaultEntityTypes, entityTypesUsage)
 	flags.BoolVar(&anonymizeNoPrint, "no-print", false, "Do not print output to stdout (default: print to stdout)")
 	flags.StringVarP(&anonymizeOutput, "output", "o", "", "Write anonymized text to file")
-	flags.StringVarP(&anonymizeOutputEntities, "output-entities", "e", "", "Write entities to YAML file")
+	flags.StringVarP(&anonymizeOutputEntities, "output-entities", "e", "", "Write entities to file (format by extension: .yaml, .json or .jsonl)")
+	flags.BoolVar(&anonymizeStrict, "strict", false, "Re-mask entity values left in the anonymized text before writing output")
+	flags.BoolVar(&anonymizeEncrypt, "encrypt", false, "Encrypt the entities file with a passphrase ("+cli.EntitiesPassphraseEnv+" or prompt) or --key-file")
+	flags.StringVar(&anonymizeKeyFile, "key-file", "", "File with a 32-byte key (raw or hex) to encrypt the entities file and the vault")
+	flags.StringVar(&anonymizeVault, "vault", "", "Store the entities in this vault file, created if missing (output is buffered)")
+	flags.StringVar(&anonymizeVaultProject, "vault-project", cli.DefaultVaultProject, "Project of the vault to store the entities in")
+	addAnonymizerFlags(flags, &anonymizeOptions)
 
 	return cmd
 }
@@ -61,11 +78,6 @@ The anonymized entities can be saved to a YAML file for later restoration.`,
 func runAnonymize(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
 
-	// Check environment variables
-	if err := cli.CheckRequiredEnvVars(); err != nil {
-		return err
-	}
-
 	// Read input
 	var stdin *os.File
 	if anonymizeFile == "" && anonymizeContent == "" {
@@ -78,16 +90,52 @@ func runAnonymize(cmd *cobra.Command, args []string) error {
 	}
 
 	// Determine entity types
-	entityTypes := anonymizeEntityTypes
-
-	// Initialize LLM
-	cli.ProgressMessage("=== Initializing LLM client... ===")
-	llm, err := anonymizer.CreateOpenAIChatModel(ctx)
+	entityTypes, err := resolveEntityTypes(anonymizeEntityTypes, &anonymizeOptions)
 	if err != nil {
 		return err
 	}
 
-	anon, err := anonymizer.NewHashHidePair(llm)
+	// Resolve the encryption key before any work, so a wrong confirmation fails fast
+	if anonymizeEncrypt && anonymizeOutputEntities == "" {
+		return eris.New("--encrypt requires --output-entities")
+	}
+	if anonymizeKeyFile != "" && anonymizeOutputEntities == "" && anonymizeVault == "" {
+		return eris.New("--key-file requires --output-entities or --vault")
+	}
+	encrypt := (anonymizeKeyFile != "" || anonymizeEncrypt) && anonymizeOutputEntities != ""
+	var key *cli.EntitiesKey
+	if encrypt || anonymizeVault != "" {
+		// A new passphrase is entered twice
+		confirm := anonymizeEncrypt || (anonymizeVault != "" && !cli.VaultExists(anonymizeVault))
+		key, err = cli.ResolveEntitiesKey(anonymizeKeyFile, confirm)
+		if err != nil {
+			return err
+		}
+	}
+	var entitiesKey *cli.EntitiesKey
+	if encrypt {
+		entitiesKey = key
+	}
+
+	var vault anonymizer.Vault
+	if anonymizeVault != "" {
+		opened, err := cli.OpenVault(anonymizeVault, key)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := opened.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to close vault: %v\n", err)
+			}
+		}()
+		vault = opened
+		anonymizeOptions.vault = vault
+		anonymizeOptions.vaultProject = anonymizeVaultProject
+	}
+
+	// Initialize LLM
+	cli.ProgressMessage("=== Initializing anonymizer... ===")
+	anon, err := newAnonymizer(ctx, &anonymizeOptions)
 	if err != nil {
 		return err
 	}
@@ -128,25 +176,60 @@ func runAnonymize(cmd *cobra.Command, args []string) error {
 		writer = io.Discard
 	}
 
-	// Anonymize text with streaming
+	// Anonymize text with streaming; in strict mode the output is held back until leaks are re-masked
+	var anonymized bytes.Buffer
+	anonymizeWriter := io.MultiWriter(writer, &anonymized)
+	if anonymizeStrict {
+		anonymizeWriter = &anonymized
+	}
+
 	cli.ProgressMessage("=== Anonymizing text... ===")
-	entities, err := anon.Anonymize(ctx, entityTypes, input, writer)
+	entities, err := anon.Anonymize(ctx, entityTypes, input, anonymizeWriter)
 	if err != nil {
 		return err
 	}
 
+	// Drop hallucinated values and report placeholders that cannot be restored
+	entities, issues := anonymizer.ValidateEntities(input, anonymized.String(), entities)
+
+	// Verify that no entity value is left in the anonymized text
+	verified, report := anonymizer.VerifyAnonymized(anonymized.String(), entities, anonymizeStrict)
+	if anonymizeStrict {
+		if _, err := io.WriteString(writer, verified); err != nil {
+			return eris.Wrap(err, "failed to write output")
+		}
+	}
+
+	// Record where every entity occurs in the original and the anonymized text
+	anonymizer.ComputeSpans(input, verified, entities)
+
 	cli.ProgressMessage("=== Anonymization complete ===")
+	cli.WriteValidationIssues(issues)
+	cli.WriteLeakReport(report)
 	// Output entities to stderr
 	cli.WriteEntitiesToStderr(entities, anonymizeNoPrint)
 
 	// Output entities to file
 	if anonymizeOutputEntities != "" {
-		if err := cli.SaveEntitiesToYAML(entities, anonymizeOutputEntities); err != nil {
+		doc := cli.NewEntitiesDocument(entities)
+		doc.Model = anonymizeOptions.modelName()
+		doc.EntityTypes = entityTypes
+		doc.SourceHash = cli.HashSource(input)
+
+		if err := cli.SaveEntities(doc, anonymizeOutputEntities, entitiesKey); err != nil {
 			return err
 		}
 		cli.ProgressMessage("Entities saved to: %s", anonymizeOutputEntities)
 	}
 
+	// Store entities in the vault project
+	if vault != nil {
+		if err := vault.Put(ctx, anonymizeVaultProject, entities); err != nil {
+			return err
+		}
+		cli.ProgressMessage("Entities saved to vault: %s (project %s)", anonymizeVault, anonymizeVaultProject)
+	}
+
 	cli.ProgressMessage("All done")
 	return nil
 }
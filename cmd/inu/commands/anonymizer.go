@@ -0,0 +1,304 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/rotisserie/eris"
+	"github.com/spf13/pflag"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+	"github.com/mrlyc/inu/pkg/cli"
+)
+
+const (
+	// engineLLM detects entities with the LLM (<<<PAIR>>> protocol)
+	engineLLM = "llm"
+	// engineRules detects structured entities with built-in regex rules, no LLM required
+	engineRules = "rules"
+	// engineHybrid masks structured entities with rules first, then detects the rest with the LLM
+	engineHybrid = "hybrid"
+	// engineStructured detects entities with the LLM through tool calling (structured output)
+	engineStructured = "structured"
+)
+
+// entityTypesUsage is the help of the --entity-types flag of every command that anonymizes text.
+const entityTypesUsage = "Entity types to detect: comma-separated names, or a YAML/JSON entity type schema file"
+
+const (
+	// defaultRetryBackoff is the delay before the first retry of a malformed LLM response.
+	defaultRetryBackoff = time.Second
+	// maxRetryBackoff caps the delay between retries of malformed LLM responses.
+	maxRetryBackoff = 30 * time.Second
+)
+
+// newChatModel creates the chat model used by the LLM engines; tests replace it with a test double.
+var newChatModel = anonymizer.CreateOpenAIChatModel
+
+// anonymizerOptions holds the flags shared by commands that anonymize text.
+type anonymizerOptions struct {
+	engine           string
+	chunkSize        int
+	concurrency      int
+	strictValidation bool
+	maxAttempts      int
+	retryBackoff     time.Duration
+	promptFile       string
+	promptLanguage   string
+	termsFile        string
+	allowTerms       []string
+	denyTerms        []string
+	replacement      string
+	keyedIDs         bool
+	idKeyFile        string
+	// terms are the lists resolved from termsFile, allowTerms and denyTerms by newAnonymizer
+	terms *anonymizer.TermLists
+	// entityTypes describes the entity types in the LLM prompt, set from --entity-types by resolveEntityTypes
+	entityTypes *anonymizer.EntityTypeSchema
+	// vault and vaultProject are set by commands that store the entities in a vault,
+	// so that the anonymizer reuses the placeholders of the project
+	vault        anonymizer.Vault
+	vaultProject string
+}
+
+// resolveEntityTypes resolves the --entity-types flag and records the schema for newAnonymizer.
+func resolveEntityTypes(values []string, opts *anonymizerOptions) ([]string, error) {
+	types, schema, err := cli.ResolveEntityTypes(values)
+	if err != nil {
+		return nil, err
+	}
+	opts.entityTypes = schema
+	return types, nil
+}
+
+// addAnonymizerFlags registers the shared anonymizer flags.
+func addAnonymizerFlags(flags *pflag.FlagSet, opts *anonymizerOptions) {
+	flags.StringVar(&opts.engine, "engine", engineLLM, "Detection engine: llm, structured (llm with tool calling), rules (works offline) or hybrid (rules first, then llm)")
+	flags.IntVar(&opts.chunkSize, "chunk-size", 0, "Split long input into chunks of at most this many characters (0 disables chunking)")
+	flags.IntVar(&opts.concurrency, "concurrency", 1, "Number of chunks to anonymize in parallel")
+	flags.IntVar(&opts.maxAttempts, "max-attempts", 1, "Maximum number of LLM calls when the response is malformed (output is buffered when greater than 1)")
+	flags.DurationVar(&opts.retryBackoff, "retry-backoff", defaultRetryBackoff, "Delay before the first retry, doubled for every further retry")
+	flags.BoolVar(&opts.strictValidation, "strict-validation", false, "Fail when the LLM entity mapping does not match the text instead of only warning")
+	flags.StringVar(&opts.promptFile, "prompt-file", "", "Load the anonymize prompt (system/user templates, few-shot examples, language variants) from a YAML/JSON file")
+	flags.StringVar(&opts.promptLanguage, "prompt-language", "", "Language variant of --prompt-file to use (default: the language set in the file)")
+	flags.StringVar(&opts.termsFile, "terms-file", "", "Load allow and deny terms from a YAML/JSON file")
+	flags.StringArrayVar(&opts.allowTerms, "allow", nil, "Term that is never anonymized, e.g. the company name (repeatable, output is buffered)")
+	flags.StringArrayVar(&opts.denyTerms, "deny", nil, "Term that is always anonymized, as TERM=TYPE (repeatable, output is buffered)")
+	flags.BoolVar(&opts.keyedIDs, "keyed-ids", false, "Derive entity IDs from their values with a secret, so the same value gets the same placeholder in every document (output is buffered)")
+	flags.StringVar(&opts.idKeyFile, "id-key-file", "", "File with the secret of --keyed-ids (default: the "+cli.IDKeyEnv+" environment variable)")
+	flags.StringVar(&opts.replacement, "replacement", string(anonymizer.ReplacePlaceholder), "Replace entities with placeholder tags or realistic fake values: placeholder or pseudonym (output is buffered)")
+}
+
+// modelName describes what detects the entities, for the metadata of entities files.
+func (opts *anonymizerOptions) modelName() string {
+	if opts.engine == engineRules {
+		return engineRules
+	}
+	if name := os.Getenv("OPENAI_MODEL_NAME"); name != "" {
+		return opts.engine + ":" + name
+	}
+	return opts.engine
+}
+
+// pairResponseFlag returns the first flag set that only applies to the <<<PAIR>>> response of
+// the llm and hybrid engines, or an empty string.
+func (opts *anonymizerOptions) pairResponseFlag() string {
+	switch {
+	case opts.maxAttempts != 1:
+		return "--max-attempts"
+	case opts.retryBackoff != 0 && opts.retryBackoff != defaultRetryBackoff:
+		return "--retry-backoff"
+	case opts.strictValidation:
+		return "--strict-validation"
+	}
+	return ""
+}
+
+// newAnonymizer creates the Anonymizer configured by the shared flags.
+func newAnonymizer(ctx context.Context, opts *anonymizerOptions) (anonymizer.Anonymizer, error) {
+	var anon anonymizer.Anonymizer
+	var err error
+
+	if opts.maxAttempts < 1 {
+		return nil, eris.Errorf("--max-attempts must be positive, got %d", opts.maxAttempts)
+	}
+	if opts.promptLanguage != "" && opts.promptFile == "" {
+		return nil, eris.New("--prompt-language requires --prompt-file")
+	}
+	if opts.promptFile != "" && (opts.engine == engineStructured || opts.engine == engineRules) {
+		return nil, eris.Errorf("--prompt-file is not supported by the %s engine", opts.engine)
+	}
+	if flag := opts.pairResponseFlag(); flag != "" && (opts.engine == engineStructured || opts.engine == engineRules) {
+		return nil, eris.Errorf("%s is not supported by the %s engine", flag, opts.engine)
+	}
+
+	replacement, err := anonymizer.ParseReplacementStrategy(opts.replacement)
+	if err != nil {
+		return nil, err
+	}
+	opts.terms, err = cli.ResolveTermLists(opts.termsFile, opts.allowTerms, opts.denyTerms)
+	if err != nil {
+		return nil, err
+	}
+
+	switch opts.engine {
+	case engineLLM:
+		anon, err = newLLMAnonymizer(ctx, opts)
+	case engineStructured:
+		anon, err = newStructuredAnonymizer(ctx, opts)
+	case engineRules:
+		anon, err = anonymizer.NewRuleBased(nil)
+	case engineHybrid:
+		anon, err = newHybridAnonymizer(ctx, opts)
+	default:
+		return nil, eris.Errorf("unknown engine: %s (supported: %s, %s, %s, %s)", opts.engine, engineLLM, engineStructured, engineRules, engineHybrid)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.chunkSize > 0 {
+		anon, err = anonymizer.NewChunked(anon, &anonymizer.ChunkConfig{
+			MaxChunkSize: opts.chunkSize,
+			Concurrency:  opts.concurrency,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Enforce the term lists on the merged result of all chunks
+	if opts.terms != nil {
+		anon, err = anonymizer.NewTermFiltered(anon, opts.terms)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.keyedIDs {
+		key, err := cli.LoadIDKey(opts.idKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		anon, err = anonymizer.NewKeyedIDs(anon, &anonymizer.KeyedIDConfig{Key: key})
+		if err != nil {
+			return nil, err
+		}
+	} else if opts.idKeyFile != "" {
+		return nil, eris.New("--id-key-file requires --keyed-ids")
+	}
+
+	// Reuse the placeholders of the vault project once the IDs are final
+	if opts.vault != nil {
+		if replacement == anonymizer.ReplacePseudonym {
+			return nil, eris.New("--vault does not support --replacement pseudonym")
+		}
+		anon, err = anonymizer.NewVaulted(anon, opts.vault, opts.vaultProject)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Pseudonyms replace the final placeholders, after all entities are known
+	if replacement == anonymizer.ReplacePseudonym {
+		anon, err = anonymizer.NewPseudonymized(anon, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return anon, nil
+}
+
+// newLLMAnonymizer creates the LLM-backed Anonymizer after checking the required environment variables.
+func newLLMAnonymizer(ctx context.Context, opts *anonymizerOptions) (anonymizer.Anonymizer, error) {
+	if err := cli.CheckRequiredEnvVars(); err != nil {
+		return nil, err
+	}
+
+	llm, err := newChatModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var options []anonymizer.Option
+	if opts.entityTypes != nil {
+		options = append(options, anonymizer.WithEntityTypeSchema(opts.entityTypes))
+	}
+	if opts.terms != nil {
+		options = append(options, anonymizer.WithTermLists(opts.terms))
+	}
+	if opts.promptFile != "" {
+		set, err := cli.LoadPromptTemplateSet(opts.promptFile)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, anonymizer.WithPromptTemplate(set, opts.promptLanguage))
+	}
+	if opts.strictValidation {
+		options = append(options, anonymizer.WithStrictValidation())
+	}
+	if opts.maxAttempts != 1 {
+		options = append(options, anonymizer.WithRetry(&anonymizer.RetryConfig{
+			MaxAttempts:    opts.maxAttempts,
+			InitialBackoff: opts.retryBackoff,
+			MaxBackoff:     maxRetryBackoff,
+		}))
+	}
+
+	return anonymizer.NewHashHidePair(llm, options...)
+}
+
+// newStructuredAnonymizer creates the tool-calling Anonymizer after checking the required environment variables.
+func newStructuredAnonymizer(ctx context.Context, opts *anonymizerOptions) (anonymizer.Anonymizer, error) {
+	if err := cli.CheckRequiredEnvVars(); err != nil {
+		return nil, err
+	}
+
+	llm, err := newChatModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var options []anonymizer.StructuredOption
+	if opts.entityTypes != nil {
+		options = append(options, anonymizer.WithStructuredEntityTypeSchema(opts.entityTypes))
+	}
+	if opts.terms != nil {
+		options = append(options, anonymizer.WithStructuredTermLists(opts.terms))
+	}
+
+	return anonymizer.NewStructured(llm, options...)
+}
+
+// newHybridAnonymizer creates an Anonymizer that applies the built-in rules before the LLM.
+func newHybridAnonymizer(ctx context.Context, opts *anonymizerOptions) (anonymizer.Anonymizer, error) {
+	rules, err := anonymizer.NewRuleBased(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	llm, err := newLLMAnonymizer(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return anonymizer.NewHybrid(rules, llm)
+}
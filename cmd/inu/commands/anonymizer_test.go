@@ -0,0 +1,221 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrlyc/inu/pkg/anonymizer/anonymizertest"
+	"github.com/mrlyc/inu/pkg/cli"
+)
+
+// useChatModel replaces the chat model of the LLM engines for the duration of the test.
+func useChatModel(t *testing.T, chatModel model.BaseChatModel) {
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	t.Setenv("OPENAI_MODEL_NAME", "test-model")
+
+	original := newChatModel
+	newChatModel = func(ctx context.Context) (model.BaseChatModel, error) {
+		return chatModel, nil
+	}
+	t.Cleanup(func() { newChatModel = original })
+}
+
+func TestNewAnonymizer_Engines(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     anonymizerOptions
+		text     string
+		response anonymizertest.Response
+		expected string
+	}{
+		{
+			name: "LLM engine streams the reply",
+			opts: anonymizerOptions{engine: engineLLM, maxAttempts: 1},
+			text: "张三来了",
+			response: anonymizertest.PairResponse("<个人信息[0].姓名.全名>来了", map[string][]string{
+				"<个人信息[0].姓名.全名>": {"张三"},
+			}, 2),
+			expected: "<个人信息[0].姓名.全名>来了",
+		},
+		{
+			name: "Hybrid engine sends masked text to the LLM",
+			opts: anonymizerOptions{engine: engineHybrid, maxAttempts: 1},
+			text: "张三的邮箱是 zhangsan@example.com",
+			response: anonymizertest.PairResponse("<个人信息[1].姓名.全名>的邮箱是 <个人信息[1].邮箱.地址>", map[string][]string{
+				"<个人信息[1].姓名.全名>": {"张三"},
+			}, 4),
+			// LLM IDs are shifted past the IDs used by the rules
+			expected: "<个人信息[2].姓名.全名>的邮箱是 <个人信息[1].邮箱.地址>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chatModel := anonymizertest.NewChatModel(tt.response)
+			useChatModel(t, chatModel)
+
+			anon, err := newAnonymizer(context.Background(), &tt.opts)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			entities, err := anon.Anonymize(context.Background(), []string{"个人信息"}, tt.text, &buf)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected, buf.String())
+			assert.NotEmpty(t, entities)
+			assert.Equal(t, 1, chatModel.Calls())
+		})
+	}
+}
+
+func TestNewAnonymizer_UnknownEngine(t *testing.T) {
+	_, err := newAnonymizer(context.Background(), &anonymizerOptions{engine: "unknown", maxAttempts: 1})
+	assert.Error(t, err)
+}
+
+func TestNewAnonymizer_UnsupportedFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		opts anonymizerOptions
+	}{
+		{name: "prompt file", opts: anonymizerOptions{maxAttempts: 1, promptFile: "prompt.yaml"}},
+		{name: "max attempts", opts: anonymizerOptions{maxAttempts: 3}},
+		{name: "retry backoff", opts: anonymizerOptions{maxAttempts: 1, retryBackoff: 5 * time.Second}},
+		{name: "strict validation", opts: anonymizerOptions{maxAttempts: 1, strictValidation: true}},
+	}
+
+	for _, tt := range tests {
+		for _, engine := range []string{engineStructured, engineRules} {
+			t.Run(tt.name+"/"+engine, func(t *testing.T) {
+				opts := tt.opts
+				opts.engine = engine
+				_, err := newAnonymizer(context.Background(), &opts)
+				assert.ErrorContains(t, err, "not supported by the "+engine+" engine")
+			})
+		}
+	}
+
+	// Zero or negative attempts are rejected by every engine
+	for _, engine := range []string{engineLLM, engineStructured, engineRules, engineHybrid} {
+		_, err := newAnonymizer(context.Background(), &anonymizerOptions{engine: engine, maxAttempts: 0})
+		assert.ErrorContains(t, err, "--max-attempts must be positive", engine)
+	}
+
+	// The defaults of the flags are accepted
+	_, err := newAnonymizer(context.Background(), &anonymizerOptions{engine: engineRules, maxAttempts: 1, retryBackoff: defaultRetryBackoff})
+	assert.NoError(t, err)
+}
+
+func TestNewAnonymizer_TermLists(t *testing.T) {
+	opts := &anonymizerOptions{
+		engine:      engineRules,
+		maxAttempts: 1,
+		allowTerms:  []string{"zhangsan@example.com"},
+		denyTerms:   []string{"星火计划=业务信息"},
+	}
+
+	anon, err := newAnonymizer(context.Background(), opts)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(context.Background(), []string{"个人信息", "业务信息"}, "星火计划联系 zhangsan@example.com 或 13800138000", &buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, "<业务信息[1].词条.名称>联系 zhangsan@example.com 或 <个人信息[2].电话.号码>", buf.String())
+	assert.Len(t, entities, 2)
+}
+
+func TestNewAnonymizer_Pseudonyms(t *testing.T) {
+	anon, err := newAnonymizer(context.Background(), &anonymizerOptions{engine: engineRules, maxAttempts: 1, replacement: "pseudonym"})
+	require.NoError(t, err)
+
+	text := "邮箱 zhangsan@corp.cn"
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(context.Background(), []string{"个人信息"}, text, &buf)
+	require.NoError(t, err)
+
+	require.Len(t, entities, 1)
+	assert.Equal(t, "邮箱 "+entities[0].Pseudonym, buf.String())
+	assert.Regexp(t, `@example\.(com|org|net)$`, entities[0].Pseudonym)
+
+	_, err = newAnonymizer(context.Background(), &anonymizerOptions{engine: engineRules, maxAttempts: 1, replacement: "fake"})
+	assert.Error(t, err)
+}
+
+func TestNewAnonymizer_KeyedIDs(t *testing.T) {
+	t.Setenv(cli.IDKeyEnv, "0123456789abcdef0123456789abcdef")
+
+	var keys []string
+	for _, text := range []string{"邮箱 zhangsan@corp.cn", "电话 13800138000，邮箱 zhangsan@corp.cn"} {
+		anon, err := newAnonymizer(context.Background(), &anonymizerOptions{engine: engineRules, maxAttempts: 1, keyedIDs: true})
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		entities, err := anon.Anonymize(context.Background(), []string{"个人信息"}, text, &buf)
+		require.NoError(t, err)
+		for _, entity := range entities {
+			if entity.Values[0] == "zhangsan@corp.cn" {
+				keys = append(keys, entity.Key)
+			}
+		}
+	}
+	require.Len(t, keys, 2)
+	assert.Equal(t, keys[0], keys[1])
+
+	t.Setenv(cli.IDKeyEnv, "")
+	_, err := newAnonymizer(context.Background(), &anonymizerOptions{engine: engineRules, maxAttempts: 1, keyedIDs: true})
+	assert.Error(t, err)
+}
+
+func TestNewAnonymizer_Vault(t *testing.T) {
+	ctx := context.Background()
+	key, err := cli.NewPassphraseKey([]byte("correct horse"))
+	require.NoError(t, err)
+	vault, err := cli.OpenVault(filepath.Join(t.TempDir(), "inu.vault"), key)
+	require.NoError(t, err)
+	defer vault.Close()
+
+	var keys []string
+	for _, text := range []string{"邮箱 zhangsan@corp.cn", "电话 13800138000，邮箱 zhangsan@corp.cn"} {
+		anon, err := newAnonymizer(ctx, &anonymizerOptions{engine: engineRules, maxAttempts: 1, vault: vault, vaultProject: "alpha"})
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		entities, err := anon.Anonymize(ctx, []string{"个人信息"}, text, &buf)
+		require.NoError(t, err)
+		require.NoError(t, vault.Put(ctx, "alpha", entities))
+		for _, entity := range entities {
+			if entity.Values[0] == "zhangsan@corp.cn" {
+				keys = append(keys, entity.Key)
+			}
+		}
+	}
+	require.Len(t, keys, 2)
+	assert.Equal(t, keys[0], keys[1])
+
+	_, err = newAnonymizer(ctx, &anonymizerOptions{engine: engineRules, maxAttempts: 1, replacement: "pseudonym", vault: vault, vaultProject: "alpha"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,328 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rotisserie/eris"
+	"github.com/spf13/cobra"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+	"github.com/mrlyc/inu/pkg/cli"
+)
+
+// entitiesFiles loads and saves entities files for the entities subcommands.
+// The key of encrypted files is resolved once and reused, and edited files keep their encryption.
+type entitiesFiles struct {
+	keyFile string
+	key     *cli.EntitiesKey
+}
+
+// load reads an entities file and reports whether it was encrypted.
+func (f *entitiesFiles) load(file string) (*cli.EntitiesDocument, bool, error) {
+	encrypted := false
+	doc, err := cli.LoadEntitiesDocument(file, func() (*cli.EntitiesKey, error) {
+		encrypted = true
+		if f.key == nil {
+			key, err := cli.ResolveEntitiesKey(f.keyFile, false)
+			if err != nil {
+				return nil, err
+			}
+			f.key = key
+		}
+		return f.key, nil
+	})
+	return doc, encrypted, err
+}
+
+// save writes an entities file, encrypted with the resolved key if encrypt is true.
+func (f *entitiesFiles) save(doc *cli.EntitiesDocument, file string, encrypt bool) error {
+	var key *cli.EntitiesKey
+	if encrypt {
+		key = f.key
+	}
+	if err := cli.SaveEntities(doc, file, key); err != nil {
+		return err
+	}
+	cli.ProgressMessage("Entities saved to: %s", file)
+	return nil
+}
+
+// NewEntitiesCmd creates the entities command and its subcommands.
+func NewEntitiesCmd() *cobra.Command {
+	files := &entitiesFiles{}
+
+	cmd := &cobra.Command{
+		Use:   "entities",
+		Short: "Inspect and edit entities files",
+		Long: `Inspect and edit the entities files written by the anonymize command.
+Encrypted files are decrypted with --key-file, the ` + cli.EntitiesPassphraseEnv + ` environment
+variable or a passphrase prompt, and edited files stay encrypted.`,
+	}
+	cmd.PersistentFlags().StringVar(&files.keyFile, "key-file", "", "File with the 32-byte key (raw or hex) of encrypted entities files")
+
+	cmd.AddCommand(
+		newEntitiesListCmd(files),
+		newEntitiesShowCmd(files),
+		newEntitiesMergeCmd(files),
+		newEntitiesDiffCmd(files),
+		newEntitiesRenameCmd(files),
+		newEntitiesDropCmd(files),
+		newEntitiesRedactCmd(files),
+	)
+
+	return cmd
+}
+
+func newEntitiesListCmd(files *entitiesFiles) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list FILE",
+		Short: "List the entities of a file without their values",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			doc, _, err := files.load(args[0])
+			if err != nil {
+				return err
+			}
+			return writeEntitiesList(cmd.OutOrStdout(), doc)
+		},
+	}
+}
+
+func writeEntitiesList(out io.Writer, doc *cli.EntitiesDocument) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tTYPE\tCATEGORY\tVALUES\tSPANS")
+	for _, entity := range doc.Entities {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\n", entity.Key, entity.EntityType, entity.Category, len(entity.Values), len(entity.Spans))
+	}
+	return w.Flush()
+}
+
+func newEntitiesShowCmd(files *entitiesFiles) *cobra.Command {
+	return &cobra.Command{
+		Use:   "show FILE [KEY...]",
+		Short: "Show the metadata and entities of a file, including values",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			doc, _, err := files.load(args[0])
+			if err != nil {
+				return err
+			}
+
+			if keys := args[1:]; len(keys) > 0 {
+				selected := make([]*anonymizer.Entity, 0, len(keys))
+				for _, key := range keys {
+					entity := findEntity(doc.Entities, key)
+					if entity == nil {
+						return eris.Errorf("entity not found: %s", key)
+					}
+					selected = append(selected, entity)
+				}
+				doc.Entities = selected
+			}
+
+			data, err := cli.EncodeEntities(doc, cli.EntitiesYAML)
+			if err != nil {
+				return err
+			}
+			_, err = cmd.OutOrStdout().Write(data)
+			return err
+		},
+	}
+}
+
+func findEntity(entities []*anonymizer.Entity, key string) *anonymizer.Entity {
+	key = anonymizer.NormalizePlaceholder(key)
+	for _, entity := range entities {
+		if anonymizer.NormalizePlaceholder(entity.Key) == key {
+			return entity
+		}
+	}
+	return nil
+}
+
+func newEntitiesMergeCmd(files *entitiesFiles) *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "merge FILE FILE... -o OUTPUT",
+		Short: "Merge the entities of several anonymize runs into one file",
+		Long: `Merge the entities of several files into one file that restores all their texts.
+Entities with the same key must share a value; rename conflicting keys first.
+The output is encrypted if any input is encrypted.`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			docs := make([]*cli.EntitiesDocument, 0, len(args))
+			encrypt := false
+			for _, file := range args {
+				doc, encrypted, err := files.load(file)
+				if err != nil {
+					return err
+				}
+				docs = append(docs, doc)
+				encrypt = encrypt || encrypted
+			}
+
+			merged, err := cli.MergeEntitiesDocuments(docs...)
+			if err != nil {
+				return err
+			}
+			return files.save(merged, output, encrypt)
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write the merged entities to file (required)")
+	_ = cmd.MarkFlagRequired("output")
+
+	return cmd
+}
+
+func newEntitiesDiffCmd(files *entitiesFiles) *cobra.Command {
+	return &cobra.Command{
+		Use:   "diff OLD NEW",
+		Short: "Show the entities added, removed and changed between two files",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			before, _, err := files.load(args[0])
+			if err != nil {
+				return err
+			}
+			after, _, err := files.load(args[1])
+			if err != nil {
+				return err
+			}
+
+			writeEntitiesDiff(cmd.OutOrStdout(), cli.DiffEntities(before.Entities, after.Entities))
+			return nil
+		},
+	}
+}
+
+func writeEntitiesDiff(out io.Writer, diff *cli.EntitiesDiff) {
+	for _, entity := range diff.Added {
+		fmt.Fprintf(out, "+ %s: %s\n", entity.Key, strings.Join(entity.Values, ", "))
+	}
+	for _, entity := range diff.Removed {
+		fmt.Fprintf(out, "- %s: %s\n", entity.Key, strings.Join(entity.Values, ", "))
+	}
+	for _, change := range diff.Changed {
+		fmt.Fprintf(out, "~ %s: %s -> %s\n", change.New.Key, strings.Join(change.Old.Values, ", "), strings.Join(change.New.Values, ", "))
+	}
+}
+
+func newEntitiesRenameCmd(files *entitiesFiles) *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "rename FILE OLD_KEY NEW_KEY",
+		Short: "Change the key of an entity",
+		Long: `Change the key of an entity, for example to resolve a merge conflict.
+Only the entities file changes: anonymized texts using the old key must be updated separately.`,
+		Args: cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			doc, encrypted, err := files.load(args[0])
+			if err != nil {
+				return err
+			}
+			if err := cli.RenameEntity(doc.Entities, args[1], args[2]); err != nil {
+				return err
+			}
+			return files.save(doc, outputOrInput(output, args[0]), encrypted)
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write the entities to file (default: edit FILE in place)")
+
+	return cmd
+}
+
+func newEntitiesDropCmd(files *entitiesFiles) *cobra.Command {
+	var (
+		output string
+		values []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "drop FILE [KEY...] [--value VALUE...]",
+		Short: "Remove false positives by key or by value",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keys := args[1:]
+			if len(keys) == 0 && len(values) == 0 {
+				return eris.New("nothing to drop: give entity keys or --value")
+			}
+
+			doc, encrypted, err := files.load(args[0])
+			if err != nil {
+				return err
+			}
+			remaining, err := cli.DropEntities(doc.Entities, keys, values)
+			if err != nil {
+				return err
+			}
+			cli.ProgressMessage("Dropped %d entities", len(doc.Entities)-len(remaining))
+
+			doc.Entities = remaining
+			return files.save(doc, outputOrInput(output, args[0]), encrypted)
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&values, "value", nil, "Remove this value from every entity (repeatable); entities left without values are removed")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write the entities to file (default: edit FILE in place)")
+
+	return cmd
+}
+
+func newEntitiesRedactCmd(files *entitiesFiles) *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "redact FILE -o OUTPUT",
+		Short: "Write a copy without the original values, for audit",
+		Long: `Write a copy of an entities file whose values are replaced with ` + cli.RedactedValue + `.
+Keys, pseudonyms, span offsets and metadata are kept. The copy is never encrypted
+and cannot be used for restoration.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output == args[0] {
+				return eris.New("refusing to overwrite the original entities file")
+			}
+
+			doc, _, err := files.load(args[0])
+			if err != nil {
+				return err
+			}
+			return files.save(cli.RedactEntitiesDocument(doc), output, false)
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write the redacted entities to file (required)")
+	_ = cmd.MarkFlagRequired("output")
+
+	return cmd
+}
+
+func outputOrInput(output, input string) string {
+	if output != "" {
+		return output
+	}
+	return input
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+	"github.com/mrlyc/inu/pkg/cli"
+)
+
+func runEntitiesCmd(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	cmd := NewEntitiesCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func writeTestEntities(t *testing.T, file string, entities ...*anonymizer.Entity) {
+	t.Helper()
+	require.NoError(t, cli.SaveEntitiesToYAML(entities, file))
+}
+
+func TestEntitiesCmd(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.yaml")
+	second := filepath.Join(dir, "second.json")
+	merged := filepath.Join(dir, "merged.jsonl")
+
+	writeTestEntities(t, first,
+		&anonymizer.Entity{Key: "<个人信息[0].姓名.全名>", EntityType: "个人信息", ID: "0", Category: "姓名", Detail: "全名", Values: []string{"张三"}},
+		&anonymizer.Entity{Key: "<业务信息[0].系统.名称>", EntityType: "业务信息", ID: "0", Category: "系统", Detail: "名称", Values: []string{"Linux"}},
+	)
+	require.NoError(t, cli.SaveEntities(cli.NewEntitiesDocument([]*anonymizer.Entity{
+		{Key: "<个人信息[0].姓名.全名>", EntityType: "个人信息", ID: "0", Category: "姓名", Detail: "全名", Values: []string{"李四"}},
+	}), second, nil))
+
+	out, err := runEntitiesCmd(t, "list", first)
+	require.NoError(t, err)
+	assert.Contains(t, out, "<业务信息[0].系统.名称>")
+	assert.NotContains(t, out, "张三")
+
+	out, err = runEntitiesCmd(t, "show", first, "<个人信息[0].姓名.全名>")
+	require.NoError(t, err)
+	assert.Contains(t, out, "张三")
+	assert.NotContains(t, out, "Linux")
+
+	// Same key for different people: resolve the conflict by renaming before merging
+	_, err = runEntitiesCmd(t, "merge", first, second, "-o", merged)
+	assert.Error(t, err)
+	_, err = runEntitiesCmd(t, "rename", second, "<个人信息[0].姓名.全名>", "<个人信息[1].姓名.全名>")
+	require.NoError(t, err)
+	_, err = runEntitiesCmd(t, "merge", first, second, "-o", merged)
+	require.NoError(t, err)
+
+	// Drop the false positive from the merged file in place
+	_, err = runEntitiesCmd(t, "drop", merged, "<业务信息[0].系统.名称>")
+	require.NoError(t, err)
+
+	out, err = runEntitiesCmd(t, "diff", first, merged)
+	require.NoError(t, err)
+	assert.Equal(t, "+ <个人信息[1].姓名.全名>: 李四\n- <业务信息[0].系统.名称>: Linux\n", out)
+
+	redacted := filepath.Join(dir, "audit.yaml")
+	_, err = runEntitiesCmd(t, "redact", merged, "-o", redacted)
+	require.NoError(t, err)
+	data, err := os.ReadFile(redacted)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "张三")
+	assert.Equal(t, 2, strings.Count(string(data), cli.RedactedValue))
+}
+
+func TestEntitiesCmd_KeepsEncryption(t *testing.T) {
+	t.Setenv(cli.EntitiesPassphraseEnv, "correct horse")
+	key, err := cli.NewPassphraseKey([]byte("correct horse"))
+	require.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "entities.yaml")
+	require.NoError(t, cli.SaveEncryptedEntities([]*anonymizer.Entity{
+		{Key: "<个人信息[0].姓名.全名>", Values: []string{"张三", "老张"}},
+	}, file, key))
+
+	_, err = runEntitiesCmd(t, "drop", file, "--value", "老张")
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.True(t, cli.IsEncryptedEntities(data))
+
+	entities, err := cli.LoadEntities(file, func() (*cli.EntitiesKey, error) { return key, nil })
+	require.NoError(t, err)
+	require.Len(t, entities, 1)
+	assert.Equal(t, []string{"张三"}, entities[0].Values)
+}
@@ -35,6 +35,7 @@ var (
 	interactiveContent     string
 	interactiveEntityTypes []string
 	interactiveNoPrompt    bool
+	interactiveOptions     anonymizerOptions
 )
 
 // NewInteractiveCmd creates the interactive command.
@@ -61,8 +62,9 @@ the anonymized text multiple times with different external tools.`,
 	flags := cmd.Flags()
 	flags.StringVarP(&interactiveFile, "file", "f", "", "Read input from file")
 	flags.StringVarP(&interactiveContent, "content", "c", "", "Input content as string")
-	flags.StringSliceVarP(&interactiveEntityTypes, "entity-types", "t", anonymizer.DefaultEntityTypes, "Entity types to detect (comma-separated)")
+	flags.StringSliceVarP(&interactiveEntityTypes, "entity-types", "t", anonymizer.DefaultEntityTypes, entityTypesUsage)
 	flags.BoolVar(&interactiveNoPrompt, "no-prompt", false, "Disable detailed prompts (show minimal messages only)")
+	addAnonymizerFlags(flags, &interactiveOptions)
 
 	return cmd
 }
@@ -70,11 +72,6 @@ the anonymized text multiple times with different external tools.`,
 func runInteractive(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
 
-	// Check environment variables
-	if err := cli.CheckRequiredEnvVars(); err != nil {
-		return err
-	}
-
 	// Read original input
 	var stdin *os.File
 	if interactiveFile == "" && interactiveContent == "" {
@@ -86,14 +83,14 @@ func runInteractive(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	// Initialize LLM
-	cli.ProgressMessage("Initializing LLM client...")
-	llm, err := anonymizer.CreateOpenAIChatModel(ctx)
+	entityTypes, err := resolveEntityTypes(interactiveEntityTypes, &interactiveOptions)
 	if err != nil {
 		return err
 	}
 
-	anon, err := anonymizer.NewHashHidePair(llm)
+	// Initialize LLM
+	cli.ProgressMessage("Initializing anonymizer...")
+	anon, err := newAnonymizer(ctx, &interactiveOptions)
 	if err != nil {
 		return err
 	}
@@ -103,7 +100,7 @@ func runInteractive(cmd *cobra.Command, args []string) error {
 	fmt.Fprintln(os.Stderr, "\n"+strings.Repeat("=", 60))
 	fmt.Fprintln(os.Stderr, "ANONYMIZED TEXT:")
 	fmt.Fprintln(os.Stderr, strings.Repeat("=", 60))
-	entities, err := anon.Anonymize(ctx, interactiveEntityTypes, input, os.Stdout)
+	entities, err := anon.Anonymize(ctx, entityTypes, input, os.Stdout)
 	if err != nil {
 		return err
 	}
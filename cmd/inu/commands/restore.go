@@ -17,13 +17,16 @@
 package commands
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/rotisserie/eris"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 
 	"github.com/mrlyc/inu/pkg/anonymizer"
 	"github.com/mrlyc/inu/pkg/cli"
@@ -35,6 +38,10 @@ var (
 	restoreEntities string
 	restoreNoPrint  bool
 	restoreOutput   string
+	restorePolicy   string
+	restoreKeyFile  string
+	restoreVault    string
+	restoreProject  string
 )
 
 // NewRestoreCmd creates the restore command.
@@ -42,56 +49,74 @@ func NewRestoreCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "restore",
 		Short: "Restore anonymized text to original",
-		Long: `Restore anonymized text using the entities file saved during anonymization.
-Requires an entities YAML file generated by the anonymize command.`,
+		Long: `Restore anonymized text using the entities file saved during anonymization,
+or the entities of a vault project with --vault.
+Encrypted entities files are detected automatically. They and vaults are decrypted with --key-file,
+the ` + cli.EntitiesPassphraseEnv + ` environment variable or a passphrase prompt.`,
 		RunE: runRestore,
 	}
 
 	flags := cmd.Flags()
 	flags.StringVarP(&restoreFile, "file", "f", "", "Read anonymized text from file")
 	flags.StringVarP(&restoreContent, "content", "c", "", "Anonymized text as string")
-	flags.StringVarP(&restoreEntities, "entities", "e", "", "Entities YAML file (required)")
+	flags.StringVarP(&restoreEntities, "entities", "e", "", "Entities file: .yaml, .json or .jsonl, plain or encrypted")
 	flags.BoolVar(&restoreNoPrint, "no-print", false, "Do not print output to stdout (default: print to stdout)")
 	flags.StringVarP(&restoreOutput, "output", "o", "", "Write restored text to file")
+	flags.StringVar(&restoreKeyFile, "key-file", "", "File with the 32-byte key (raw or hex) of an encrypted entities file or the vault")
+	flags.StringVar(&restoreVault, "vault", "", "Restore with the entities of a vault project instead of an entities file")
+	flags.StringVar(&restoreProject, "vault-project", cli.DefaultVaultProject, "Project of the vault to restore with")
+	flags.StringVar(&restorePolicy, "policy", string(anonymizer.DefaultRestorePolicy), "Restore policy for entities with several values: ordered (original wording at each position) or first (always the first value)")
 
-	_ = cmd.MarkFlagRequired("entities")
+	cmd.MarkFlagsMutuallyExclusive("entities", "vault")
 
 	return cmd
 }
 
 func runRestore(cmd *cobra.Command, args []string) error {
-	ctx := context.Background()
-
 	// Validate entities flag
-	if restoreEntities == "" {
-		return eris.New("--entities flag is required")
-	}
-
-	// Read input
-	var stdin *os.File
-	if restoreFile == "" && restoreContent == "" {
-		stdin = os.Stdin
+	if restoreEntities == "" && restoreVault == "" {
+		return eris.New("--entities or --vault flag is required")
 	}
 
-	input, err := cli.ReadInput(restoreFile, restoreContent, stdin)
+	policy, err := anonymizer.ParseRestorePolicy(restorePolicy)
 	if err != nil {
 		return err
 	}
 
-	// Load entities
-	cli.ProgressMessage("=== Loading entities from: %s ===", restoreEntities)
-	entities, err := cli.LoadEntitiesFromYAML(restoreEntities)
-	if err != nil {
-		return err
+	// Read input; stdin is restored as it arrives so that a token stream can be piped through
+	var input io.Reader
+	if restoreFile != "" || restoreContent != "" {
+		content, err := cli.ReadInput(restoreFile, restoreContent, nil)
+		if err != nil {
+			return err
+		}
+		input = strings.NewReader(content)
+	} else {
+		// Files and --content may be empty, only a missing stdin input is an error.
+		// It is checked before the output file is created so that an existing file is not truncated.
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			return eris.New("no input provided: use --file, --content, or pipe to stdin")
+		}
+		stdin := bufio.NewReader(os.Stdin)
+		if _, err := stdin.Peek(1); err == io.EOF {
+			return eris.New("no input provided: use --file, --content, or pipe to stdin")
+		} else if err != nil {
+			return eris.Wrap(err, "failed to read from stdin")
+		}
+		input = stdin
 	}
 
-	// Initialize LLM (not needed for restore, but keep same pattern)
-	llm, err := anonymizer.CreateOpenAIChatModel(ctx)
-	if err != nil {
-		return err
+	// Load entities
+	var entities []*anonymizer.Entity
+	if restoreVault != "" {
+		cli.ProgressMessage("=== Loading entities from vault: %s (project %s) ===", restoreVault, restoreProject)
+		entities, err = loadVaultEntities(restoreVault, restoreKeyFile, restoreProject)
+	} else {
+		cli.ProgressMessage("=== Loading entities from: %s ===", restoreEntities)
+		entities, err = cli.LoadEntities(restoreEntities, func() (*cli.EntitiesKey, error) {
+			return cli.ResolveEntitiesKey(restoreKeyFile, false)
+		})
 	}
-
-	anon, err := anonymizer.NewHashHidePair(llm)
 	if err != nil {
 		return err
 	}
@@ -128,10 +153,14 @@ func runRestore(cmd *cobra.Command, args []string) error {
 		writer = os.Stdout
 	}
 
-	failures, err := anon.RestoreText(ctx, entities, input, writer)
-	if err != nil {
+	restorer := anonymizer.NewRestoreWriter(writer, entities, policy)
+	if _, err := io.Copy(restorer, input); err != nil {
+		return eris.Wrap(err, "failed to restore input")
+	}
+	if err := restorer.Close(); err != nil {
 		return err
 	}
+	failures := restorer.Failures()
 
 	// Display warnings for failed placeholders
 	if len(failures) > 0 {
@@ -150,3 +179,21 @@ func runRestore(cmd *cobra.Command, args []string) error {
 	cli.ProgressMessage("=== Restoration complete ===")
 	return nil
 }
+
+// loadVaultEntities reads all entities of a project from an existing vault.
+func loadVaultEntities(file, keyFile, project string) ([]*anonymizer.Entity, error) {
+	if !cli.VaultExists(file) {
+		return nil, eris.Errorf("vault not found: %s", file)
+	}
+	key, err := cli.ResolveEntitiesKey(keyFile, false)
+	if err != nil {
+		return nil, err
+	}
+	vault, err := cli.OpenVault(file, key)
+	if err != nil {
+		return nil, err
+	}
+	defer vault.Close()
+
+	return vault.Entities(context.Background(), project)
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rotisserie/eris"
+	"github.com/spf13/cobra"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+	"github.com/mrlyc/inu/pkg/cli"
+)
+
+// vaultFile opens the vault of the vault subcommands.
+type vaultFile struct {
+	file    string
+	keyFile string
+}
+
+// open opens an existing vault; the caller closes it.
+func (v *vaultFile) open() (*anonymizer.BoltVault, error) {
+	if !cli.VaultExists(v.file) {
+		return nil, eris.Errorf("vault not found: %s", v.file)
+	}
+	key, err := cli.ResolveEntitiesKey(v.keyFile, false)
+	if err != nil {
+		return nil, err
+	}
+	return cli.OpenVault(v.file, key)
+}
+
+// NewVaultCmd creates the vault command and its subcommands.
+func NewVaultCmd() *cobra.Command {
+	vault := &vaultFile{}
+
+	cmd := &cobra.Command{
+		Use:   "vault",
+		Short: "Inspect and manage entity vaults",
+		Long: `Inspect and manage the vault files written by anonymize --vault and web --vault.
+Vaults are decrypted with --key-file, the ` + cli.EntitiesPassphraseEnv + ` environment
+variable or a passphrase prompt.`,
+	}
+	cmd.PersistentFlags().StringVar(&vault.file, "vault", "", "Vault file (required)")
+	cmd.PersistentFlags().StringVar(&vault.keyFile, "key-file", "", "File with the 32-byte key (raw or hex) of the vault")
+	_ = cmd.MarkPersistentFlagRequired("vault")
+
+	cmd.AddCommand(
+		newVaultProjectsCmd(vault),
+		newVaultLookupCmd(vault),
+		newVaultDeleteCmd(vault),
+	)
+
+	return cmd
+}
+
+func newVaultProjectsCmd(vault *vaultFile) *cobra.Command {
+	return &cobra.Command{
+		Use:   "projects",
+		Short: "List the projects of a vault",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v, err := vault.open()
+			if err != nil {
+				return err
+			}
+			defer v.Close()
+
+			projects, err := v.Projects(context.Background())
+			if err != nil {
+				return err
+			}
+			return writeVaultProjects(cmd.OutOrStdout(), projects)
+		},
+	}
+}
+
+func writeVaultProjects(out io.Writer, projects []*anonymizer.VaultProject) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PROJECT\tENTITIES\tCREATED\tUPDATED")
+	for _, project := range projects {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", project.Name, project.Entities,
+			project.CreatedAt.Local().Format(time.DateTime), project.UpdatedAt.Local().Format(time.DateTime))
+	}
+	return w.Flush()
+}
+
+func newVaultLookupCmd(vault *vaultFile) *cobra.Command {
+	var (
+		project string
+		values  []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "lookup [PLACEHOLDER...] [--value VALUE...]",
+		Short: "Find entities by placeholder or by original value",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && len(values) == 0 {
+				return eris.New("nothing to look up: give placeholders or --value")
+			}
+
+			v, err := vault.open()
+			if err != nil {
+				return err
+			}
+			defer v.Close()
+
+			ctx := context.Background()
+			out := cmd.OutOrStdout()
+			for _, key := range args {
+				entity, err := v.LookupKey(ctx, project, key)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(out, "%s: %s\n", entity.Key, strings.Join(entity.Values, ", "))
+			}
+			for _, value := range values {
+				entity, err := v.LookupValue(ctx, project, value)
+				if errors.Is(err, anonymizer.ErrNotInVault) {
+					return eris.Errorf("value not found in project %s: %s", project, value)
+				} else if err != nil {
+					return err
+				}
+				fmt.Fprintf(out, "%s: %s\n", value, entity.Key)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&project, "project", cli.DefaultVaultProject, "Project to look up")
+	cmd.Flags().StringArrayVar(&values, "value", nil, "Find the placeholder of this original value (repeatable)")
+
+	return cmd
+}
+
+func newVaultDeleteCmd(vault *vaultFile) *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete PROJECT",
+		Short: "Delete a project and all its entities",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v, err := vault.open()
+			if err != nil {
+				return err
+			}
+			defer v.Close()
+
+			if err := v.DeleteProject(context.Background(), args[0]); err != nil {
+				return err
+			}
+			cli.ProgressMessage("Deleted project: %s", args[0])
+			return nil
+		},
+	}
+}
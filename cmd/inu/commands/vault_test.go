@@ -0,0 +1,80 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+	"github.com/mrlyc/inu/pkg/cli"
+)
+
+func runVaultCmd(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	cmd := NewVaultCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestVaultCmd(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "inu.vault")
+	keyFile := filepath.Join(dir, "vault.key")
+	require.NoError(t, os.WriteFile(keyFile, []byte(strings.Repeat("ab", 32)), 0600))
+
+	key, err := cli.LoadEntitiesKeyFile(keyFile)
+	require.NoError(t, err)
+	vault, err := cli.OpenVault(file, key)
+	require.NoError(t, err)
+	require.NoError(t, vault.Put(context.Background(), cli.DefaultVaultProject, []*anonymizer.Entity{
+		{Key: "<个人信息[0].姓名.全名>", EntityType: "个人信息", ID: "0", Category: "姓名", Detail: "全名", Values: []string{"张三"}},
+	}))
+	require.NoError(t, vault.Close())
+
+	out, err := runVaultCmd(t, "projects", "--vault", file, "--key-file", keyFile)
+	require.NoError(t, err)
+	assert.Contains(t, out, cli.DefaultVaultProject)
+
+	out, err = runVaultCmd(t, "lookup", "--vault", file, "--key-file", keyFile, "<个人信息[0].姓名.全名>", "--value", "张三")
+	require.NoError(t, err)
+	assert.Contains(t, out, "<个人信息[0].姓名.全名>: 张三")
+	assert.Contains(t, out, "张三: <个人信息[0].姓名.全名>")
+
+	_, err = runVaultCmd(t, "lookup", "--vault", file, "--key-file", keyFile, "--value", "李四")
+	assert.Error(t, err)
+
+	_, err = runVaultCmd(t, "delete", "--vault", file, "--key-file", keyFile, cli.DefaultVaultProject)
+	require.NoError(t, err)
+	_, err = runVaultCmd(t, "delete", "--vault", file, "--key-file", keyFile, cli.DefaultVaultProject)
+	assert.Error(t, err)
+
+	_, err = runVaultCmd(t, "projects", "--vault", filepath.Join(dir, "missing.vault"), "--key-file", keyFile)
+	assert.Error(t, err)
+}
@@ -18,15 +18,19 @@ package commands
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/rotisserie/eris"
 	"github.com/spf13/cobra"
 
 	"github.com/mrlyc/inu/pkg/anonymizer"
 	"github.com/mrlyc/inu/pkg/cli"
 	"github.com/mrlyc/inu/pkg/web"
+	"github.com/mrlyc/inu/pkg/web/session"
 )
 
 var (
@@ -34,6 +38,11 @@ var (
 	webAdminUser   string
 	webAdminToken  string
 	webEntityTypes []string
+	webSessionTTL  time.Duration
+	webSessionDir  string
+	webVault       string
+	webKeyFile     string
+	webOptions     anonymizerOptions
 )
 
 // NewWebCmd creates the web command.
@@ -51,14 +60,26 @@ Available endpoints:
   - GET  /health        Health check (no auth required)
   - GET  /api/v1/config Configuration
   - POST /api/v1/anonymize  Anonymize text
-  - POST /api/v1/restore    Restore anonymized text`,
+  - POST /api/v1/restore    Restore anonymized text
+  - DELETE /api/v1/sessions/:id  Delete a server-side session
+
+Anonymize requests with "session": true keep the entities on the server and return a
+session ID, which restore requests use instead of the entities. With --vault the sessions
+are kept in an encrypted vault file, decrypted with --key-file, the ` + cli.EntitiesPassphraseEnv + `
+environment variable or a passphrase prompt.`,
 		RunE: runWeb,
 	}
 
 	cmd.Flags().StringVar(&webAddr, "addr", "127.0.0.1:8080", "Server address to listen on")
 	cmd.Flags().StringVar(&webAdminUser, "admin-user", "admin", "Admin username for HTTP Basic Auth")
 	cmd.Flags().StringVar(&webAdminToken, "admin-token", "", "Admin token/password for HTTP Basic Auth (leave empty to disable auth)")
-	cmd.Flags().StringSliceVar(&webEntityTypes, "entity-types", anonymizer.DefaultEntityTypes, "Entity types to recognize")
+	cmd.Flags().DurationVar(&webSessionTTL, "session-ttl", time.Hour, "How long server-side sessions are kept")
+	cmd.Flags().StringVar(&webSessionDir, "session-dir", "", "Store sessions in files under this directory so they survive restarts (default: in memory)")
+	cmd.Flags().StringVar(&webVault, "vault", "", "Store sessions encrypted in this vault file, created if missing")
+	cmd.Flags().StringVar(&webKeyFile, "key-file", "", "File with the 32-byte key (raw or hex) of the vault")
+	cmd.MarkFlagsMutuallyExclusive("session-dir", "vault")
+	cmd.Flags().StringSliceVar(&webEntityTypes, "entity-types", anonymizer.DefaultEntityTypes, entityTypesUsage)
+	addAnonymizerFlags(cmd.Flags(), &webOptions)
 
 	return cmd
 }
@@ -66,19 +87,14 @@ Available endpoints:
 func runWeb(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
 
-	// Check environment variables
-	if err := cli.CheckRequiredEnvVars(); err != nil {
-		return err
-	}
-
-	// Initialize LLM
-	cli.ProgressMessage("Initializing LLM client...")
-	llm, err := anonymizer.CreateOpenAIChatModel(ctx)
+	entityTypes, err := resolveEntityTypes(webEntityTypes, &webOptions)
 	if err != nil {
 		return err
 	}
 
-	anon, err := anonymizer.NewHashHidePair(llm)
+	// Initialize LLM
+	cli.ProgressMessage("Initializing anonymizer...")
+	anon, err := newAnonymizer(ctx, &webOptions)
 	if err != nil {
 		return err
 	}
@@ -88,6 +104,8 @@ func runWeb(cmd *cobra.Command, args []string) error {
 		Addr:       webAddr,
 		AdminUser:  webAdminUser,
 		AdminToken: webAdminToken,
+		SessionTTL: webSessionTTL,
+		SessionDir: webSessionDir,
 	}
 
 	server, err := web.NewServer(anon, config)
@@ -95,8 +113,29 @@ func runWeb(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// Keep sessions in the vault
+	if webVault != "" {
+		key, err := cli.ResolveEntitiesKey(webKeyFile, !cli.VaultExists(webVault))
+		if err != nil {
+			return err
+		}
+		vault, err := cli.OpenVault(webVault, key)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := vault.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to close vault: %v\n", err)
+			}
+		}()
+		server.SetSessionStore(session.NewVaultStore(vault, webSessionTTL))
+	} else if webKeyFile != "" {
+		return eris.New("--key-file requires --vault")
+	}
+
 	// Set entity types from command line flag
-	server.SetEntityTypes(webEntityTypes)
+	server.SetEntityTypes(entityTypes)
+	server.SetEntityTypeSchema(webOptions.entityTypes)
 
 	// Setup graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -45,6 +45,9 @@ func main() {
 	rootCmd.AddCommand(commands.NewRestoreCmd())
 	rootCmd.AddCommand(commands.NewInteractiveCmd())
 	rootCmd.AddCommand(commands.NewWebCmd())
+	rootCmd.AddCommand(commands.NewEvalCmd())
+	rootCmd.AddCommand(commands.NewEntitiesCmd())
+	rootCmd.AddCommand(commands.NewVaultCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
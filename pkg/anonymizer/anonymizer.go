@@ -29,13 +29,15 @@ import (
 	"github.com/rotisserie/eris"
 
 	"github.com/cloudwego/eino/components/model"
-	"github.com/cloudwego/eino/components/prompt"
 	"github.com/cloudwego/eino/schema"
 )
 
 // placeholderRegex matches placeholder patterns like <...>
 var placeholderRegex = regexp.MustCompile(`<[^>]+>`)
 
+// entityKeyRegex parses entity keys in the format <EntityType[ID].Category.Detail>
+var entityKeyRegex = regexp.MustCompile(`<(.+?)\[(.+?)\]\.(.+?)\.(.+?)>`)
+
 // RestoreFailure 表示一个无法还原的占位符及其失败原因。
 type RestoreFailure struct {
 	// Placeholder 是归一化后的占位符字符串 (如 "<个人信息[1].姓名.全名>")
@@ -68,8 +70,42 @@ type Anonymizer interface {
 //
 // 此实现支持流式输出，在遇到 <<<PAIR>>> 标记前将 token 实时写入输出。
 type HasHidePair struct {
-	anonymizeTemplate *prompt.DefaultChatTemplate
-	llm               model.BaseChatModel
+	anonymizePrompt  *anonymizePrompt
+	llm              model.BaseChatModel
+	strictValidation bool
+	retry            *RetryConfig
+	entityTypes      *EntityTypeSchema
+	terms            *TermLists
+	promptSet        *PromptTemplateSet
+	promptLanguage   string
+}
+
+// Option configures a HasHidePair.
+type Option func(*HasHidePair)
+
+// WithStrictValidation makes Anonymize return a *ValidationError when the LLM mapping
+// does not match the text (see ValidateEntities) instead of an unrestorable result.
+// Note that in streaming mode the anonymized text has already been written when validation fails.
+func WithStrictValidation() Option {
+	return func(h *HasHidePair) {
+		h.strictValidation = true
+	}
+}
+
+// WithEntityTypeSchema sets the definitions of the entity types described in the prompt
+// (DefaultEntityTypeSchema by default). Requested types the schema does not define are passed by name only.
+func WithEntityTypeSchema(entityTypes *EntityTypeSchema) Option {
+	return func(h *HasHidePair) {
+		h.entityTypes = entityTypes
+	}
+}
+
+// WithTermLists describes the allow and deny terms in the prompt. The model may still ignore them:
+// wrap the Anonymizer with NewTermFiltered to enforce the lists on the result.
+func WithTermLists(lists *TermLists) Option {
+	return func(h *HasHidePair) {
+		h.terms = lists
+	}
 }
 
 // createAnonymizeMessages creates messages for anonymization.
@@ -79,22 +115,13 @@ func (h *HasHidePair) createAnonymizeMessages(ctx context.Context, types []strin
 		return nil, eris.Wrap(err, "failed to marshal types")
 	}
 
-	messages, err := h.anonymizeTemplate.Format(ctx, map[string]any{
-		"types": string(encodedTypes),
-		"text":  text,
-	})
-
-	if err != nil {
-		return nil, eris.Wrap(err, "failed to format message")
-	}
-
-	return messages, nil
+	return h.anonymizePrompt.format(ctx, string(encodedTypes), h.entityTypes.describe(types), h.terms.describe(), text)
 }
 
 // parseAnonymizeResponse parses the complete LLM response to extract anonymized text and entities.
 // The response format is: <anonymized_text>\n<<<PAIR>>>\n<JSON_mapping>
 func parseAnonymizeResponse(responseContent string) (string, []*Entity, error) {
-	splited := strings.SplitN(responseContent, "<<<PAIR>>>", 2)
+	splited := strings.SplitN(responseContent, pairMarker, 2)
 	if len(splited) != 2 {
 		return "", nil, fmt.Errorf("invalid response format, expected 2 parts but got %d, %s", len(splited), responseContent)
 	}
@@ -120,10 +147,9 @@ func parseAnonymizeEntities(entitiesStr []byte) ([]*Entity, error) {
 	}
 
 	// key format: <EntityType[ID].Category.Detail>
-	keyParseRe := regexp.MustCompile(`<(.+?)\[(.+?)\]\.(.+?)\.(.+?)>`)
 	entities := make([]*Entity, 0, len(mapping))
 	for key, values := range mapping {
-		matches := keyParseRe.FindStringSubmatch(key)
+		matches := entityKeyRegex.FindStringSubmatch(key)
 		if len(matches) != 5 {
 			return nil, fmt.Errorf("invalid key format: %s", key)
 		}
@@ -175,28 +201,80 @@ func (h *HasHidePair) Anonymize(ctx context.Context, types []string, text string
 		return nil, eris.Wrap(err, "failed to create anonymize messages")
 	}
 
+	maxAttempts := h.retry.maxAttempts()
+	for attempt := 1; ; attempt++ {
+		// With retries enabled the output is held back until the attempt succeeds
+		var output bytes.Buffer
+		attemptWriter := io.MultiWriter(writer, &output)
+		if maxAttempts > 1 {
+			attemptWriter = &output
+		}
+
+		entities, response, err := h.anonymize(ctx, text, messages, attemptWriter)
+		if err == nil && h.strictValidation {
+			_, issues := ValidateEntities(text, output.String(), entities)
+			if fatal := fatalIssues(issues); len(fatal) > 0 {
+				err = &ValidationError{Issues: fatal}
+			}
+		}
+
+		if err == nil {
+			if maxAttempts > 1 {
+				if _, err := writer.Write(output.Bytes()); err != nil {
+					return nil, eris.Wrap(err, "failed to write to output")
+				}
+			}
+			return entities, nil
+		}
+
+		if attempt >= maxAttempts || !isRepairable(err) {
+			if attempt > 1 {
+				return nil, eris.Wrapf(err, "failed after %d attempts", attempt)
+			}
+			return nil, err
+		}
+
+		if err := h.retry.wait(ctx, attempt); err != nil {
+			return nil, err
+		}
+		messages = repairMessages(messages, response, err)
+	}
+}
+
+// anonymize calls the LLM once and streams the anonymized text to writer.
+// It returns the entities and the raw response, which is needed to ask the model for a repair.
+// If the model replies "None", the original text is written unchanged and no entities are returned.
+func (h *HasHidePair) anonymize(ctx context.Context, text string, messages []*schema.Message, writer io.Writer) ([]*Entity, string, error) {
 	// Get streaming reader from LLM
 	streamReader, err := h.llm.Stream(ctx, messages)
 	if err != nil {
 		// Fallback to Generate if Stream is not supported (e.g., in tests)
 		response, genErr := h.llm.Generate(ctx, messages)
 		if genErr != nil {
-			return nil, eris.Wrap(genErr, "failed to generate response (stream fallback)")
+			return nil, "", eris.Wrap(genErr, "failed to generate response (stream fallback)")
+		}
+		if isNoneReply(response.Content) {
+			return writeUnchanged(text, response.Content, writer)
 		}
 		// Parse response to extract anonymized text and entities
 		anonymizedText, entities, parseErr := parseAnonymizeResponse(response.Content)
 		if parseErr != nil {
-			return nil, eris.Wrap(parseErr, "failed to parse response")
+			return nil, response.Content, &responseFormatError{err: eris.Wrap(parseErr, "failed to parse response")}
 		}
 		// Write only the anonymized text to writer
 		if _, writeErr := writer.Write([]byte(anonymizedText)); writeErr != nil {
-			return nil, eris.Wrap(writeErr, "failed to write to output")
+			return nil, response.Content, eris.Wrap(writeErr, "failed to write to output")
 		}
-		return entities, nil
+		return entities, response.Content, nil
 	}
 
-	var buffer bytes.Buffer
-	foundPair := false
+	defer streamReader.Close()
+
+	var parser pairParser
+	var response strings.Builder
+	// A reply that may still turn out to be "None" is held back until it is decided
+	var held strings.Builder
+	written := false
 
 	for {
 		msg, err := streamReader.Recv()
@@ -204,113 +282,84 @@ func (h *HasHidePair) Anonymize(ctx context.Context, types []string, text string
 			break
 		}
 		if err != nil {
-			return nil, eris.Wrap(err, "failed to receive stream token")
+			return nil, response.String(), eris.Wrap(err, "failed to receive stream token")
 		}
+		response.WriteString(msg.Content)
 
-		if foundPair {
-			// After <<<PAIR>>>, collect JSON tokens
-			buffer.WriteString(msg.Content)
-			continue
+		output := parser.feed(msg.Content)
+		if !written {
+			held.WriteString(output)
+			if !parser.found && isNoneCandidate(response.String()) {
+				continue
+			}
+			output = held.String()
+			held.Reset()
 		}
-
-		buffer.WriteString(msg.Content)
-		if !strings.Contains(msg.Content, "\n") {
-			continue
-		} else if strings.Contains(buffer.String(), "<<<PAIR>>>") {
-			buffer.Reset()
-			foundPair = true
+		if output == "" {
 			continue
 		}
 
-		_, err = writer.Write(buffer.Bytes())
-		if err != nil {
-			return nil, eris.Wrap(err, "failed to write to output")
+		if _, err := io.WriteString(writer, output); err != nil {
+			return nil, response.String(), eris.Wrap(err, "failed to write to output")
 		}
-		buffer.Reset()
+		written = true
+	}
+
+	if !parser.found && !written && isNoneReply(response.String()) {
+		return writeUnchanged(text, response.String(), writer)
+	}
+
+	if !parser.found {
+		return nil, response.String(), &responseFormatError{err: fmt.Errorf("invalid response format, %s not found", pairMarker)}
 	}
 
-	entitesBytes := buffer.Bytes()
-	entities, err := parseAnonymizeEntities(entitesBytes)
+	mapping := strings.TrimSpace(parser.mapping.String())
+	entities, err := parseAnonymizeEntities([]byte(mapping))
 	if err != nil {
-		return nil, eris.Wrapf(err, "failed to parse anonymize response: %s", string(entitesBytes))
+		return nil, response.String(), &responseFormatError{err: eris.Wrapf(err, "failed to parse anonymize response: %s", mapping)}
 	}
 
-	return entities, nil
+	return entities, response.String(), nil
+}
+
+// isNoneReply returns true if the LLM reply means that no sensitive entity was found.
+func isNoneReply(content string) bool {
+	content = strings.TrimSpace(content)
+	content = strings.Trim(content, "\"'`.。")
+	return strings.EqualFold(strings.TrimSpace(content), "None")
+}
+
+// isNoneCandidate returns true if a partial reply may still become a "None" reply.
+func isNoneCandidate(content string) bool {
+	content = strings.TrimLeft(strings.TrimSpace(content), "\"'`")
+	return strings.HasPrefix("none", strings.ToLower(content)) || isNoneReply(content)
+}
+
+// writeUnchanged writes the original text for a "None" reply and returns an empty entity list.
+func writeUnchanged(text, response string, writer io.Writer) ([]*Entity, string, error) {
+	if _, err := io.WriteString(writer, text); err != nil {
+		return nil, response, eris.Wrap(err, "failed to write to output")
+	}
+	return []*Entity{}, response, nil
 }
 
 // RestoreText restores the original text from the anonymized text using the provided entities.
 // It supports fuzzy matching of placeholders with format variations (extra spaces, Chinese punctuation, fullwidth characters).
 // The restored text is written to the writer, and a list of failures is returned.
+// Multi-valued entities are restored with DefaultRestorePolicy.
 //
 // Returns:
 //   - failures: List of placeholders that could not be restored, with reasons
 //   - error: Any error during writing
 func (h *HasHidePair) RestoreText(ctx context.Context, entities []*Entity, text string, writer io.Writer) ([]RestoreFailure, error) {
-	// Build two maps: one for entities with values, one for entities without values
-	entityMap := make(map[string]string)
-	emptyKeys := make(map[string]bool)
-
-	for _, entity := range entities {
-		normalizedKey := normalizePlaceholder(entity.Key)
-		if len(entity.Values) == 0 {
-			emptyKeys[normalizedKey] = true
-		} else {
-			entityMap[normalizedKey] = entity.Values[0]
-		}
-	}
-
-	// Collect failures
-	var failures []RestoreFailure
-	seenFailures := make(map[string]bool) // Deduplication
-
-	// Stream replacement
-	lastIndex := 0
-	matches := placeholderRegex.FindAllStringIndex(text, -1)
-
-	for _, match := range matches {
-		// Write text before placeholder
-		if _, err := writer.Write([]byte(text[lastIndex:match[0]])); err != nil {
-			return nil, eris.Wrap(err, "failed to write to output")
-		}
-
-		// Process placeholder
-		placeholder := text[match[0]:match[1]]
-		normalizedKey := normalizePlaceholder(placeholder)
-
-		if value, exists := entityMap[normalizedKey]; exists {
-			// Restore succeeded
-			if _, err := writer.Write([]byte(value)); err != nil {
-				return nil, eris.Wrap(err, "failed to write to output")
-			}
-		} else {
-			// Restore failed, keep placeholder
-			if _, err := writer.Write([]byte(placeholder)); err != nil {
-				return nil, eris.Wrap(err, "failed to write to output")
-			}
-
-			// Record failure reason
-			if !seenFailures[normalizedKey] {
-				reason := "not_found"
-				if emptyKeys[normalizedKey] {
-					reason = "empty_values"
-				}
-				failures = append(failures, RestoreFailure{
-					Placeholder: normalizedKey,
-					Reason:      reason,
-				})
-				seenFailures[normalizedKey] = true
-			}
-		}
-
-		lastIndex = match[1]
-	}
-
-	// Write remaining text
-	if _, err := writer.Write([]byte(text[lastIndex:])); err != nil {
-		return nil, eris.Wrap(err, "failed to write to output")
-	}
+	return restoreText(entities, text, writer)
+}
 
-	return failures, nil
+// NormalizePlaceholder returns the canonical form of a placeholder, ignoring the whitespace,
+// Chinese punctuation and fullwidth characters that restore also ignores.
+// Two keys refer to the same entity if their normalized forms are equal.
+func NormalizePlaceholder(placeholder string) string {
+	return normalizePlaceholder(placeholder)
 }
 
 // normalizePlaceholder normalizes a placeholder string to a standard format for matching.
@@ -373,15 +422,41 @@ func normalizePlaceholder(placeholder string) string {
 
 // NewHashHidePair 创建一个基于 <<<PAIR>>> 格式的 Anonymizer 实现。
 // 该实现使用 LLM 进行文本脱敏，响应格式为脱敏文本和 JSON 映射由 <<<PAIR>>> 分隔。
-func NewHashHidePair(chatModel model.BaseChatModel) (Anonymizer, error) {
-	anonymizeTemplate := prompt.FromMessages(schema.FString,
-		schema.UserMessage(`Anonymize the text with the given entity types, then output the tag-to-original mapping; if nothing is found, reply "None".
-Specified types: {types}
-<text>{text}</text>`),
-	)
-
-	return &HasHidePair{
-		anonymizeTemplate: anonymizeTemplate,
-		llm:               chatModel,
-	}, nil
+func NewHashHidePair(chatModel model.BaseChatModel, opts ...Option) (Anonymizer, error) {
+	h := &HasHidePair{
+		llm:         chatModel,
+		entityTypes: DefaultEntityTypeSchema,
+		promptSet:   defaultPromptSet(),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	if h.retry != nil {
+		if err := h.retry.Validate(); err != nil {
+			return nil, eris.Wrap(err, "invalid retry config")
+		}
+	}
+	if h.terms != nil {
+		if err := h.terms.Validate(); err != nil {
+			return nil, eris.Wrap(err, "invalid term lists")
+		}
+	}
+
+	if err := h.promptSet.Validate(); err != nil {
+		return nil, eris.Wrap(err, "invalid prompt template")
+	}
+	template, err := h.promptSet.Select(h.promptLanguage)
+	if err != nil {
+		return nil, err
+	}
+	formatType, err := h.promptSet.formatType()
+	if err != nil {
+		return nil, err
+	}
+	if h.anonymizePrompt, err = compilePrompt(template, formatType); err != nil {
+		return nil, eris.Wrap(err, "invalid prompt template")
+	}
+
+	return h, nil
 }
@@ -20,9 +20,12 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/cloudwego/eino/schema"
+
+	"github.com/mrlyc/inu/pkg/anonymizer/anonymizertest"
 )
 
 // TestAnonymize_SingleEntity tests anonymizing text with a single entity.
@@ -216,6 +219,88 @@ func TestAnonymizeText_NoMatch(t *testing.T) {
 	}
 }
 
+// TestAnonymizeText_NoneReply tests that a "None" reply from Generate returns the original text.
+func TestAnonymizeText_NoneReply(t *testing.T) {
+	ctx := context.Background()
+	originalText := "This is just plain text"
+
+	for _, reply := range []string{"None", " none.\n", "\"None\""} {
+		mockLLM := newMockWithResponse(&schema.Message{Role: schema.Assistant, Content: reply})
+
+		anon, err := NewHashHidePair(mockLLM)
+		if err != nil {
+			t.Fatalf("Failed to create anonymizer: %v", err)
+		}
+
+		var buf bytes.Buffer
+		entities, err := anon.Anonymize(ctx, []string{"个人信息"}, originalText, &buf)
+		if err != nil {
+			t.Fatalf("reply %q: AnonymizeText failed: %v", reply, err)
+		}
+		if buf.String() != originalText {
+			t.Errorf("reply %q: expected original text, got: %s", reply, buf.String())
+		}
+		if entities == nil || len(entities) != 0 {
+			t.Errorf("reply %q: expected empty entity slice, got %v", reply, entities)
+		}
+	}
+}
+
+// TestAnonymizeText_NoneReplyStream tests that a streamed "None" reply returns the original text.
+func TestAnonymizeText_NoneReplyStream(t *testing.T) {
+	ctx := context.Background()
+	originalText := "This is just plain text"
+
+	for _, tokens := range [][]string{{"None"}, {"No", "ne"}, {"None\n"}, {"None", "\n"}} {
+		mockLLM := anonymizertest.NewChatModel(anonymizertest.Tokens(tokens...))
+
+		anon, err := NewHashHidePair(mockLLM)
+		if err != nil {
+			t.Fatalf("Failed to create anonymizer: %v", err)
+		}
+
+		var buf bytes.Buffer
+		entities, err := anon.Anonymize(ctx, []string{"个人信息"}, originalText, &buf)
+		if err != nil {
+			t.Fatalf("tokens %q: AnonymizeText failed: %v", tokens, err)
+		}
+		if buf.String() != originalText {
+			t.Errorf("tokens %q: expected original text, got: %q", tokens, buf.String())
+		}
+		if entities == nil || len(entities) != 0 {
+			t.Errorf("tokens %q: expected empty entity slice, got %v", tokens, entities)
+		}
+	}
+}
+
+// TestAnonymizeText_Stream tests the streaming path with a regular reply.
+func TestAnonymizeText_Stream(t *testing.T) {
+	ctx := context.Background()
+	mockLLM := anonymizertest.NewChatModel(anonymizertest.Tokens(
+		"<个人信息[0].姓名.全名> lives",
+		" in Beijing\n",
+		"<<<PAIR>>>\n",
+		`{"<个人信息[0].姓名.全名>": ["张三"]}`,
+	))
+
+	anon, err := NewHashHidePair(mockLLM)
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(ctx, []string{"个人信息"}, "张三 lives in Beijing", &buf)
+	if err != nil {
+		t.Fatalf("AnonymizeText failed: %v", err)
+	}
+	if strings.TrimSpace(buf.String()) != "<个人信息[0].姓名.全名> lives in Beijing" {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+	if len(entities) != 1 || entities[0].Values[0] != "张三" {
+		t.Errorf("unexpected entities: %+v", entities)
+	}
+}
+
 // TestAnonymizeText_LLMError tests handling LLM API errors.
 func TestAnonymizeText_LLMError(t *testing.T) {
 	ctx := context.Background()
@@ -572,8 +657,8 @@ func TestNew_Success(t *testing.T) {
 		t.Error("Expected non-nil llm field")
 	}
 
-	if impl.anonymizeTemplate == nil {
-		t.Error("Expected non-nil anonymizeTemplate field")
+	if impl.anonymizePrompt == nil {
+		t.Error("Expected non-nil anonymizePrompt field")
 	}
 }
 
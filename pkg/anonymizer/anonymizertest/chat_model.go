@@ -0,0 +1,211 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package anonymizertest provides test doubles for code built on the anonymizer package.
+package anonymizertest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// ErrNoResponse is returned when the ChatModel is called more often than responses were configured.
+var ErrNoResponse = errors.New("anonymizertest: no response configured")
+
+// Response is one scripted reply of a ChatModel.
+type Response struct {
+	// Tokens are streamed one message per token; Generate returns them joined
+	Tokens []string
+	// ToolCalls are attached to the message returned by Generate
+	ToolCalls []schema.ToolCall
+	// Err fails the call: Generate returns it, a stream returns it from the first Recv
+	Err error
+	// StreamErr is received from the stream after all tokens (a mid-stream failure)
+	StreamErr error
+	// Delay is waited before every streamed token
+	Delay time.Duration
+}
+
+// Content returns the complete reply text.
+func (r Response) Content() string {
+	return strings.Join(r.Tokens, "")
+}
+
+// Tokens creates a Response that streams the given tokens.
+func Tokens(tokens ...string) Response {
+	return Response{Tokens: tokens}
+}
+
+// PairResponse creates a Response in the <<<PAIR>>> format, split into tokens of at most tokenSize characters
+// (0 sends the whole reply as one token).
+func PairResponse(anonymizedText string, mapping map[string][]string, tokenSize int) Response {
+	encoded, err := json.Marshal(mapping)
+	if err != nil {
+		panic(fmt.Sprintf("anonymizertest: failed to marshal mapping: %v", err))
+	}
+	return Response{Tokens: SplitTokens(anonymizedText+"\n<<<PAIR>>>\n"+string(encoded), tokenSize)}
+}
+
+// SplitTokens splits s into tokens of at most size characters; size <= 0 returns s as a single token.
+func SplitTokens(s string, size int) []string {
+	if size <= 0 || s == "" {
+		return []string{s}
+	}
+
+	runes := []rune(s)
+	tokens := make([]string, 0, (len(runes)+size-1)/size)
+	for start := 0; start < len(runes); start += size {
+		end := start + size
+		if end > len(runes) {
+			end = len(runes)
+		}
+		tokens = append(tokens, string(runes[start:end]))
+	}
+	return tokens
+}
+
+// ChatModel 是可编排响应的 model.ToolCallingChatModel 测试替身。
+// 每次 Generate 或 Stream 调用依次消费一个 Response；Stream 返回真实的 schema.StreamReader，
+// 支持逐 token 延迟和流中途错误。调用记录可通过 Requests 获取。可安全地并发使用。
+type ChatModel struct {
+	// StreamDisabled makes Stream fail so that callers fall back to Generate
+	StreamDisabled bool
+
+	mu        sync.Mutex
+	responses []Response
+	requests  [][]*schema.Message
+	tools     []*schema.ToolInfo
+}
+
+// NewChatModel 创建一个按顺序返回 responses 的 ChatModel。
+func NewChatModel(responses ...Response) *ChatModel {
+	return &ChatModel{responses: responses}
+}
+
+// next records the request and returns the next scripted response.
+func (m *ChatModel) next(messages []*schema.Message) (Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests = append(m.requests, messages)
+	if len(m.requests) > len(m.responses) {
+		return Response{}, ErrNoResponse
+	}
+	return m.responses[len(m.requests)-1], nil
+}
+
+// Generate implements model.BaseChatModel.
+func (m *ChatModel) Generate(ctx context.Context, messages []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	response, err := m.next(messages)
+	if err != nil {
+		return nil, err
+	}
+	if response.Err != nil {
+		return nil, response.Err
+	}
+	if response.StreamErr != nil {
+		return nil, response.StreamErr
+	}
+
+	return &schema.Message{
+		Role:      schema.Assistant,
+		Content:   response.Content(),
+		ToolCalls: response.ToolCalls,
+	}, nil
+}
+
+// Stream implements model.BaseChatModel.
+func (m *ChatModel) Stream(ctx context.Context, messages []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	if m.StreamDisabled {
+		return nil, errors.New("anonymizertest: stream disabled")
+	}
+
+	response, err := m.next(messages)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, writer := schema.Pipe[*schema.Message](0)
+	go func() {
+		defer writer.Close()
+
+		if response.Err != nil {
+			writer.Send(nil, response.Err)
+			return
+		}
+
+		for _, token := range response.Tokens {
+			if response.Delay > 0 {
+				select {
+				case <-ctx.Done():
+					writer.Send(nil, ctx.Err())
+					return
+				case <-time.After(response.Delay):
+				}
+			}
+			if closed := writer.Send(&schema.Message{Role: schema.Assistant, Content: token}, nil); closed {
+				return
+			}
+		}
+
+		if response.StreamErr != nil {
+			writer.Send(nil, response.StreamErr)
+		}
+	}()
+
+	return reader, nil
+}
+
+// WithTools implements model.ToolCallingChatModel. The tools are shared with the returned model.
+func (m *ChatModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.tools = tools
+	return m, nil
+}
+
+// Tools returns the tools bound with WithTools.
+func (m *ChatModel) Tools() []*schema.ToolInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.tools
+}
+
+// Requests returns the messages of every call so far.
+func (m *ChatModel) Requests() [][]*schema.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([][]*schema.Message(nil), m.requests...)
+}
+
+// Calls returns the number of Generate and Stream calls so far.
+func (m *ChatModel) Calls() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.requests)
+}
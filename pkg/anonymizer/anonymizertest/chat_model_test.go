@@ -0,0 +1,82 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizertest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+func TestChatModel_Stream(t *testing.T) {
+	streamErr := errors.New("boom")
+	m := NewChatModel(Response{Tokens: []string{"a", "b"}, StreamErr: streamErr})
+
+	reader, err := m.Stream(context.Background(), []*schema.Message{schema.UserMessage("hi")})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	defer reader.Close()
+
+	var tokens []string
+	for {
+		msg, err := reader.Recv()
+		if err == io.EOF {
+			t.Fatal("expected the stream error before EOF")
+		}
+		if err != nil {
+			if !errors.Is(err, streamErr) {
+				t.Fatalf("expected stream error, got %v", err)
+			}
+			break
+		}
+		tokens = append(tokens, msg.Content)
+	}
+
+	if !reflect.DeepEqual(tokens, []string{"a", "b"}) {
+		t.Errorf("unexpected tokens: %v", tokens)
+	}
+	if m.Calls() != 1 || m.Requests()[0][0].Content != "hi" {
+		t.Errorf("expected the request to be recorded, got %+v", m.Requests())
+	}
+}
+
+func TestChatModel_Generate(t *testing.T) {
+	m := NewChatModel(Tokens("a", "b"))
+
+	msg, err := m.Generate(context.Background(), nil)
+	if err != nil || msg.Content != "ab" {
+		t.Fatalf("expected joined tokens, got %v, %v", msg, err)
+	}
+
+	if _, err := m.Generate(context.Background(), nil); !errors.Is(err, ErrNoResponse) {
+		t.Errorf("expected ErrNoResponse, got %v", err)
+	}
+}
+
+func TestSplitTokens(t *testing.T) {
+	if tokens := SplitTokens("张三ab", 2); !reflect.DeepEqual(tokens, []string{"张三", "ab"}) {
+		t.Errorf("unexpected tokens: %v", tokens)
+	}
+	if tokens := SplitTokens("abc", 0); !reflect.DeepEqual(tokens, []string{"abc"}) {
+		t.Errorf("unexpected tokens: %v", tokens)
+	}
+}
@@ -0,0 +1,461 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rotisserie/eris"
+)
+
+// ChunkConfig holds the configuration for chunked anonymization.
+type ChunkConfig struct {
+	// MaxChunkSize is the maximum number of characters sent to the LLM in one chunk
+	MaxChunkSize int
+	// Concurrency is the number of chunks anonymized in parallel (1 means sequential)
+	Concurrency int
+}
+
+// Validate checks if the configuration is valid.
+func (c *ChunkConfig) Validate() error {
+	if c.MaxChunkSize <= 0 {
+		return fmt.Errorf("max chunk size must be positive, got %d", c.MaxChunkSize)
+	}
+	if c.Concurrency <= 0 {
+		return fmt.Errorf("concurrency must be positive, got %d", c.Concurrency)
+	}
+	return nil
+}
+
+// Chunked 是对其他 Anonymizer 的分块包装。
+// 它将长文本按段落/句子边界切分为多个块，分别脱敏后合并实体映射：
+//   - 相同实体类型且值相同的实体在所有块中使用同一个占位符
+//   - 不同块之间 ID 冲突时重新编号，并同步改写块内的占位符
+//
+// 输出按块的原始顺序写入 writer，前面的块完成后即可输出，无需等待全部完成。
+type Chunked struct {
+	inner  Anonymizer
+	config ChunkConfig
+}
+
+// chunkResult holds the anonymization result of a single chunk.
+type chunkResult struct {
+	text     string
+	entities []*Entity
+	err      error
+	done     chan struct{}
+}
+
+// Anonymize splits the text into chunks, anonymizes them with the wrapped Anonymizer
+// and merges the entities so that placeholders are consistent across chunks.
+func (c *Chunked) Anonymize(ctx context.Context, types []string, text string, writer io.Writer) ([]*Entity, error) {
+	chunks := splitIntoChunks(text, c.config.MaxChunkSize)
+	if len(chunks) == 1 {
+		return c.inner.Anonymize(ctx, types, text, writer)
+	}
+
+	results := make([]*chunkResult, len(chunks))
+	for i := range results {
+		results[i] = &chunkResult{done: make(chan struct{})}
+	}
+
+	// Cancel the remaining chunks before waiting for them, so that a failure returns early
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	semaphore := make(chan struct{}, c.config.Concurrency)
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func(result *chunkResult, chunk string) {
+			defer wg.Done()
+			defer close(result.done)
+
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+				result.err = ctx.Err()
+				return
+			}
+
+			result.text, result.entities, result.err = c.anonymizeChunk(ctx, types, chunk)
+			if result.err != nil {
+				// Earlier chunks are waited for in order, stop them too
+				cancel()
+			}
+		}(results[i], chunk)
+	}
+
+	merger := newEntityMerger()
+	for i, result := range results {
+		<-result.done
+		if result.err != nil {
+			return nil, eris.Wrapf(result.err, "failed to anonymize chunk %d/%d", i+1, len(chunks))
+		}
+
+		keyMap := merger.merge(result.entities)
+		if _, err := writer.Write([]byte(rewritePlaceholders(result.text, keyMap))); err != nil {
+			return nil, eris.Wrap(err, "failed to write to output")
+		}
+	}
+
+	return merger.entities, nil
+}
+
+// anonymizeChunk anonymizes a single chunk, preserving its leading and trailing whitespace
+// which would otherwise be trimmed by the LLM response parsing.
+func (c *Chunked) anonymizeChunk(ctx context.Context, types []string, chunk string) (string, []*Entity, error) {
+	content := strings.TrimSpace(chunk)
+	if content == "" {
+		return chunk, nil, nil
+	}
+
+	start := strings.Index(chunk, content)
+	prefix := chunk[:start]
+	suffix := chunk[start+len(content):]
+
+	var buf bytes.Buffer
+	entities, err := c.inner.Anonymize(ctx, types, content, &buf)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return prefix + buf.String() + suffix, entities, nil
+}
+
+// RestoreText delegates to the wrapped Anonymizer.
+func (c *Chunked) RestoreText(ctx context.Context, entities []*Entity, text string, writer io.Writer) ([]RestoreFailure, error) {
+	return c.inner.RestoreText(ctx, entities, text, writer)
+}
+
+// NewChunked 创建一个分块脱敏的 Anonymizer，包装给定的 Anonymizer 实现。
+func NewChunked(inner Anonymizer, config *ChunkConfig) (Anonymizer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, eris.Wrap(err, "invalid chunk config")
+	}
+
+	return &Chunked{
+		inner:  inner,
+		config: *config,
+	}, nil
+}
+
+// entityMerger merges entities from multiple anonymization results into one consistent set.
+type entityMerger struct {
+	entities []*Entity
+	byKey    map[string]*Entity // normalized key -> entity
+	byValue  map[string]*Entity // entity type + normalized value -> entity
+	usedIDs  map[string]bool    // entity type + ID
+	maxID    map[string]int     // entity type -> max numeric ID
+}
+
+func newEntityMerger() *entityMerger {
+	return &entityMerger{
+		byKey:   make(map[string]*Entity),
+		byValue: make(map[string]*Entity),
+		usedIDs: make(map[string]bool),
+		maxID:   make(map[string]int),
+	}
+}
+
+// merge adds entities to the merged set and returns a mapping from the
+// normalized keys of the given entities to the keys used in the merged set.
+func (m *entityMerger) merge(entities []*Entity) map[string]string {
+	sorted := make([]*Entity, len(entities))
+	copy(sorted, entities)
+	sortEntities(sorted)
+
+	keyMap := make(map[string]string, len(sorted))
+	idMap := make(map[string]string) // entity type + local ID -> merged ID
+
+	// First pass: entities whose values are already known reuse the existing key.
+	var pending []*Entity
+	for _, entity := range sorted {
+		existing := m.findByValue(entity)
+		if existing == nil {
+			pending = append(pending, entity)
+			continue
+		}
+
+		keyMap[normalizePlaceholder(entity.Key)] = existing.Key
+		m.addValues(existing, entity.Values)
+		if _, ok := idMap[typeIDKey(entity.EntityType, entity.ID)]; !ok {
+			idMap[typeIDKey(entity.EntityType, entity.ID)] = existing.ID
+		}
+	}
+
+	// Second pass: new entities keep their ID when possible, otherwise they are renumbered.
+	for _, entity := range pending {
+		localID := typeIDKey(entity.EntityType, entity.ID)
+		id, ok := idMap[localID]
+		if !ok {
+			if m.usedIDs[localID] {
+				id = m.nextID(entity.EntityType)
+			} else {
+				id = entity.ID
+				m.claimID(entity.EntityType, id)
+			}
+			idMap[localID] = id
+		}
+
+		key := formatEntityKey(entity.EntityType, id, entity.Category, entity.Detail)
+		if _, exists := m.byKey[normalizePlaceholder(key)]; exists {
+			id = m.nextID(entity.EntityType)
+			key = formatEntityKey(entity.EntityType, id, entity.Category, entity.Detail)
+		}
+
+		merged := &Entity{
+			Key:        key,
+			EntityType: entity.EntityType,
+			ID:         id,
+			Category:   entity.Category,
+			Detail:     entity.Detail,
+		}
+		m.entities = append(m.entities, merged)
+		m.byKey[normalizePlaceholder(key)] = merged
+		m.addValues(merged, entity.Values)
+		keyMap[normalizePlaceholder(entity.Key)] = key
+	}
+
+	return keyMap
+}
+
+// findByValue returns the merged entity of the same type sharing any value with the given entity.
+func (m *entityMerger) findByValue(entity *Entity) *Entity {
+	for _, value := range entity.Values {
+		if existing, ok := m.byValue[typeValueKey(entity.EntityType, value)]; ok {
+			return existing
+		}
+	}
+	return nil
+}
+
+// addValues appends values not yet present in the entity and indexes them.
+func (m *entityMerger) addValues(entity *Entity, values []string) {
+	for _, value := range values {
+		key := typeValueKey(entity.EntityType, value)
+		if existing, ok := m.byValue[key]; ok && existing == entity {
+			continue
+		}
+		if _, ok := m.byValue[key]; !ok {
+			m.byValue[key] = entity
+		}
+		entity.Values = append(entity.Values, value)
+	}
+}
+
+// claimID marks an ID of the entity type as used.
+func (m *entityMerger) claimID(entityType, id string) {
+	m.usedIDs[typeIDKey(entityType, id)] = true
+	if n, err := strconv.Atoi(id); err == nil && n > m.maxID[entityType] {
+		m.maxID[entityType] = n
+	}
+}
+
+// nextID allocates a new unused numeric ID for the entity type.
+func (m *entityMerger) nextID(entityType string) string {
+	n := m.maxID[entityType] + 1
+	for m.usedIDs[typeIDKey(entityType, strconv.Itoa(n))] {
+		n++
+	}
+	id := strconv.Itoa(n)
+	m.claimID(entityType, id)
+	return id
+}
+
+func typeIDKey(entityType, id string) string {
+	return entityType + "\x00" + id
+}
+
+func typeValueKey(entityType, value string) string {
+	return entityType + "\x00" + normalizeValue(value)
+}
+
+// sortEntities sorts entities by type, numeric ID and key for deterministic processing.
+func sortEntities(entities []*Entity) {
+	sort.SliceStable(entities, func(i, j int) bool {
+		a, b := entities[i], entities[j]
+		if a.EntityType != b.EntityType {
+			return a.EntityType < b.EntityType
+		}
+		if a.ID != b.ID {
+			na, errA := strconv.Atoi(a.ID)
+			nb, errB := strconv.Atoi(b.ID)
+			if errA == nil && errB == nil {
+				return na < nb
+			}
+			return a.ID < b.ID
+		}
+		return a.Key < b.Key
+	})
+}
+
+// formatEntityKey builds an entity key in the format <EntityType[ID].Category.Detail>
+func formatEntityKey(entityType, id, category, detail string) string {
+	return fmt.Sprintf("<%s[%s].%s.%s>", entityType, id, category, detail)
+}
+
+// normalizeValue normalizes an entity value for comparison.
+// It removes whitespace, converts fullwidth characters to halfwidth and lowercases the value.
+func normalizeValue(value string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		if r >= 0xFF01 && r <= 0xFF5E {
+			r -= 0xFEE0
+		}
+		return unicode.ToLower(r)
+	}, value)
+}
+
+// rewritePlaceholders replaces placeholders in text according to keyMap (normalized key -> new key).
+// Placeholders not present in keyMap are kept unchanged.
+func rewritePlaceholders(text string, keyMap map[string]string) string {
+	return placeholderRegex.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if key, ok := keyMap[normalizePlaceholder(placeholder)]; ok {
+			return key
+		}
+		return placeholder
+	})
+}
+
+// splitIntoChunks splits text into chunks of at most maxSize characters.
+// It prefers paragraph boundaries, then sentence boundaries, and only cuts
+// inside a sentence when the sentence alone exceeds maxSize.
+// Concatenating the returned chunks yields the original text.
+func splitIntoChunks(text string, maxSize int) []string {
+	if maxSize <= 0 || utf8.RuneCountInString(text) <= maxSize {
+		return []string{text}
+	}
+
+	var chunks []string
+	var current strings.Builder
+	currentSize := 0
+
+	for _, segment := range splitSegments(text, maxSize) {
+		size := utf8.RuneCountInString(segment)
+		if currentSize > 0 && currentSize+size > maxSize {
+			chunks = append(chunks, current.String())
+			current.Reset()
+			currentSize = 0
+		}
+		current.WriteString(segment)
+		currentSize += size
+	}
+
+	if currentSize > 0 {
+		chunks = append(chunks, current.String())
+	}
+
+	return chunks
+}
+
+// splitSegments splits text into boundary-aligned segments of at most maxSize characters.
+func splitSegments(text string, maxSize int) []string {
+	var segments []string
+	for _, paragraph := range splitAfter(text, isParagraphBoundary) {
+		if utf8.RuneCountInString(paragraph) <= maxSize {
+			segments = append(segments, paragraph)
+			continue
+		}
+
+		for _, sentence := range splitAfter(paragraph, isSentenceBoundary) {
+			if utf8.RuneCountInString(sentence) <= maxSize {
+				segments = append(segments, sentence)
+				continue
+			}
+
+			runes := []rune(sentence)
+			for len(runes) > maxSize {
+				segments = append(segments, string(runes[:maxSize]))
+				runes = runes[maxSize:]
+			}
+			segments = append(segments, string(runes))
+		}
+	}
+	return segments
+}
+
+// splitAfter splits text after every rune position for which boundary returns true.
+func splitAfter(text string, boundary func(runes []rune, i int) bool) []string {
+	runes := []rune(text)
+	var parts []string
+	start := 0
+	for i := range runes {
+		if boundary(runes, i) {
+			parts = append(parts, string(runes[start:i+1]))
+			start = i + 1
+		}
+	}
+	if start < len(runes) {
+		parts = append(parts, string(runes[start:]))
+	}
+	return parts
+}
+
+// isParagraphBoundary reports whether position i ends a run of two or more newlines.
+func isParagraphBoundary(runes []rune, i int) bool {
+	return runes[i] == '\n' && i > 0 && runes[i-1] == '\n' &&
+		(i+1 == len(runes) || runes[i+1] != '\n')
+}
+
+// isSentenceBoundary reports whether position i ends a sentence or a line.
+// Spaces following a sentence terminator belong to the preceding sentence.
+func isSentenceBoundary(runes []rune, i int) bool {
+	next := i + 1
+	atEnd := next == len(runes)
+
+	switch r := runes[i]; {
+	case r == '\n':
+		return atEnd || runes[next] != '\n'
+	case unicode.IsSpace(r):
+		if !atEnd && unicode.IsSpace(runes[next]) {
+			return false
+		}
+		j := i
+		for j > 0 && unicode.IsSpace(runes[j-1]) && runes[j-1] != '\n' {
+			j--
+		}
+		return j > 0 && isSentenceTerminator(runes[j-1])
+	case isSentenceTerminator(r):
+		if atEnd {
+			return true
+		}
+		// ASCII terminators need trailing whitespace, e.g. "3.14" is not a boundary
+		return r > unicode.MaxASCII && !unicode.IsSpace(runes[next])
+	}
+	return false
+}
+
+// isSentenceTerminator reports whether r terminates a sentence.
+func isSentenceTerminator(r rune) bool {
+	return strings.ContainsRune("。！？；.!?;", r)
+}
@@ -0,0 +1,272 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mrlyc/inu/pkg/anonymizer/anonymizertest"
+)
+
+// chunkFakeAnonymizer anonymizes each chunk with a per-chunk canned response.
+type chunkFakeAnonymizer struct {
+	responses map[string]chunkFakeResponse // trimmed chunk text -> response
+}
+
+type chunkFakeResponse struct {
+	text     string
+	entities []*Entity
+	err      error
+}
+
+func (f *chunkFakeAnonymizer) Anonymize(ctx context.Context, types []string, text string, writer io.Writer) ([]*Entity, error) {
+	resp, ok := f.responses[text]
+	if !ok {
+		_, _ = writer.Write([]byte(text))
+		return nil, nil
+	}
+	if resp.err != nil {
+		return nil, resp.err
+	}
+	_, _ = writer.Write([]byte(resp.text))
+	return resp.entities, nil
+}
+
+func (f *chunkFakeAnonymizer) RestoreText(ctx context.Context, entities []*Entity, text string, writer io.Writer) ([]RestoreFailure, error) {
+	return (&HasHidePair{}).RestoreText(ctx, entities, text, writer)
+}
+
+func newTestEntity(key string, values ...string) *Entity {
+	matches := entityKeyRegex.FindStringSubmatch(key)
+	return &Entity{
+		Key:        key,
+		EntityType: matches[1],
+		ID:         matches[2],
+		Category:   matches[3],
+		Detail:     matches[4],
+		Values:     values,
+	}
+}
+
+// TestSplitIntoChunks tests that chunks respect the size limit and preserve the text.
+func TestSplitIntoChunks(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		maxSize int
+		want    []string
+	}{
+		{
+			name:    "Short text is a single chunk",
+			text:    "张三在北京。",
+			maxSize: 100,
+			want:    []string{"张三在北京。"},
+		},
+		{
+			name:    "Split on paragraphs",
+			text:    "第一段内容。\n\n第二段内容。\n\n第三段。",
+			maxSize: 10,
+			want:    []string{"第一段内容。\n\n", "第二段内容。\n\n", "第三段。"},
+		},
+		{
+			name:    "Split long paragraph on sentences",
+			text:    "First sentence. Second one! Third?",
+			maxSize: 20,
+			want:    []string{"First sentence. ", "Second one! Third?"},
+		},
+		{
+			name:    "Hard split when a sentence is too long",
+			text:    "abcdefghij",
+			maxSize: 4,
+			want:    []string{"abcd", "efgh", "ij"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := splitIntoChunks(tt.text, tt.maxSize)
+			if strings.Join(chunks, "") != tt.text {
+				t.Errorf("chunks do not concatenate to the original text: %q", chunks)
+			}
+			for _, chunk := range chunks {
+				if utf8.RuneCountInString(chunk) > tt.maxSize {
+					t.Errorf("chunk %q exceeds max size %d", chunk, tt.maxSize)
+				}
+			}
+			if len(chunks) != len(tt.want) {
+				t.Fatalf("expected %d chunks, got %d: %q", len(tt.want), len(chunks), chunks)
+			}
+			for i := range chunks {
+				if chunks[i] != tt.want[i] {
+					t.Errorf("chunk %d: expected %q, got %q", i, tt.want[i], chunks[i])
+				}
+			}
+		})
+	}
+}
+
+// TestChunked_ConsistentEntitiesAcrossChunks tests that the same value keeps one key
+// across chunks and that colliding IDs are renumbered.
+func TestChunked_ConsistentEntitiesAcrossChunks(t *testing.T) {
+	ctx := context.Background()
+	fake := &chunkFakeAnonymizer{responses: map[string]chunkFakeResponse{
+		"张三在北京工作。": {
+			text:     "<个人信息[0].姓名.全名>在北京工作。",
+			entities: []*Entity{newTestEntity("<个人信息[0].姓名.全名>", "张三")},
+		},
+		"李四认识张三。": {
+			text: "<个人信息[0].姓名.全名>认识<个人信息[1].姓名.全名>。",
+			entities: []*Entity{
+				newTestEntity("<个人信息[0].姓名.全名>", "李四"),
+				newTestEntity("<个人信息[1].姓名.全名>", "张三"),
+			},
+		},
+	}}
+
+	for _, concurrency := range []int{1, 4} {
+		anon, err := NewChunked(fake, &ChunkConfig{MaxChunkSize: 10, Concurrency: concurrency})
+		if err != nil {
+			t.Fatalf("Failed to create chunked anonymizer: %v", err)
+		}
+
+		var buf bytes.Buffer
+		entities, err := anon.Anonymize(ctx, []string{"个人信息"}, "张三在北京工作。\n\n李四认识张三。", &buf)
+		if err != nil {
+			t.Fatalf("Anonymize failed: %v", err)
+		}
+
+		expected := "<个人信息[0].姓名.全名>在北京工作。\n\n<个人信息[1].姓名.全名>认识<个人信息[0].姓名.全名>。"
+		if buf.String() != expected {
+			t.Errorf("concurrency %d: expected %q, got %q", concurrency, expected, buf.String())
+		}
+
+		if len(entities) != 2 {
+			t.Fatalf("concurrency %d: expected 2 entities, got %d", concurrency, len(entities))
+		}
+		if entities[0].Key != "<个人信息[0].姓名.全名>" || entities[0].Values[0] != "张三" {
+			t.Errorf("unexpected first entity: %+v", entities[0])
+		}
+		if entities[1].Key != "<个人信息[1].姓名.全名>" || entities[1].ID != "1" || entities[1].Values[0] != "李四" {
+			t.Errorf("unexpected second entity: %+v", entities[1])
+		}
+
+		var restored bytes.Buffer
+		failures, err := anon.RestoreText(ctx, entities, buf.String(), &restored)
+		if err != nil {
+			t.Fatalf("RestoreText failed: %v", err)
+		}
+		if restored.String() != "张三在北京工作。\n\n李四认识张三。" || len(failures) != 0 {
+			t.Errorf("round trip failed: %q, failures: %v", restored.String(), failures)
+		}
+	}
+}
+
+// TestChunked_MergesSurfaceForms tests that a known value merges new surface forms into the same entity.
+func TestChunked_MergesSurfaceForms(t *testing.T) {
+	ctx := context.Background()
+	fake := &chunkFakeAnonymizer{responses: map[string]chunkFakeResponse{
+		"张三来了。": {
+			text:     "<个人信息[1].姓名.全名>来了。",
+			entities: []*Entity{newTestEntity("<个人信息[1].姓名.全名>", "张三")},
+		},
+		"老张，也就是张三，走了。": {
+			text:     "<个人信息[1].姓名.全名>，也就是<个人信息[1].姓名.全名>，走了。",
+			entities: []*Entity{newTestEntity("<个人信息[1].姓名.全名>", "老张", "张三")},
+		},
+	}}
+
+	anon, err := NewChunked(fake, &ChunkConfig{MaxChunkSize: 12, Concurrency: 2})
+	if err != nil {
+		t.Fatalf("Failed to create chunked anonymizer: %v", err)
+	}
+
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(ctx, nil, "张三来了。\n\n老张，也就是张三，走了。", &buf)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+
+	if len(entities) != 1 {
+		t.Fatalf("expected 1 entity, got %d", len(entities))
+	}
+	if len(entities[0].Values) != 2 || entities[0].Values[1] != "老张" {
+		t.Errorf("expected merged values [张三 老张], got %v", entities[0].Values)
+	}
+}
+
+// TestChunked_ChunkError tests that a failing chunk aborts anonymization.
+func TestChunked_ChunkError(t *testing.T) {
+	fake := &chunkFakeAnonymizer{responses: map[string]chunkFakeResponse{
+		"第二段。": {err: errors.New("context length exceeded")},
+	}}
+
+	anon, err := NewChunked(fake, &ChunkConfig{MaxChunkSize: 5, Concurrency: 2})
+	if err != nil {
+		t.Fatalf("Failed to create chunked anonymizer: %v", err)
+	}
+
+	var buf bytes.Buffer
+	_, err = anon.Anonymize(context.Background(), nil, "第一段。\n\n第二段。", &buf)
+	if err == nil {
+		t.Error("Expected error when a chunk fails, got nil")
+	}
+}
+
+// TestChunked_ChunkErrorCancelsOtherChunks tests that a failed chunk does not wait for slow chunks.
+func TestChunked_ChunkErrorCancelsOtherChunks(t *testing.T) {
+	slow := anonymizertest.PairResponse("第一段。", map[string][]string{}, 1)
+	slow.Delay = time.Second
+	chatModel := anonymizertest.NewChatModel(
+		anonymizertest.Response{Err: errors.New("context length exceeded")},
+		slow,
+		anonymizertest.Response{Err: errors.New("context length exceeded")},
+	)
+	llm, err := NewHashHidePair(chatModel)
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+	anon, err := NewChunked(llm, &ChunkConfig{MaxChunkSize: 5, Concurrency: 2})
+	if err != nil {
+		t.Fatalf("Failed to create chunked anonymizer: %v", err)
+	}
+
+	start := time.Now()
+	var buf bytes.Buffer
+	if _, err := anon.Anonymize(context.Background(), nil, "第一段。\n\n第二段。", &buf); err == nil {
+		t.Error("Expected error when a chunk fails, got nil")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the slow chunk to be cancelled, Anonymize took %s", elapsed)
+	}
+}
+
+// TestNewChunked_InvalidConfig tests config validation.
+func TestNewChunked_InvalidConfig(t *testing.T) {
+	if _, err := NewChunked(&chunkFakeAnonymizer{}, &ChunkConfig{MaxChunkSize: 0, Concurrency: 1}); err == nil {
+		t.Error("Expected error for zero chunk size, got nil")
+	}
+	if _, err := NewChunked(&chunkFakeAnonymizer{}, &ChunkConfig{MaxChunkSize: 10, Concurrency: 0}); err == nil {
+		t.Error("Expected error for zero concurrency, got nil")
+	}
+}
@@ -0,0 +1,235 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CategoryDefinition 是实体类型下允许的一个类别 (占位符中的 Category) 及其细节 (Detail)。
+type CategoryDefinition struct {
+	Name    string   `json:"name" yaml:"name" mapstructure:"name"`
+	Details []string `json:"details,omitempty" yaml:"details,omitempty" mapstructure:"details"`
+}
+
+// EntityTypeDefinition 描述一种实体类型，用于在提示词中向模型说明该类型的含义。
+type EntityTypeDefinition struct {
+	// Name 是占位符中的实体类型 (如 "个人信息")
+	Name        string `json:"name" yaml:"name" mapstructure:"name"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty" mapstructure:"description"`
+	// Examples 是属于该类型的值
+	Examples []string `json:"examples,omitempty" yaml:"examples,omitempty" mapstructure:"examples"`
+	// CounterExamples 是容易混淆但不属于该类型的值
+	CounterExamples []string `json:"counter_examples,omitempty" yaml:"counter_examples,omitempty" mapstructure:"counter_examples"`
+	// Categories 是允许的类别和细节，为空时不限制
+	Categories []CategoryDefinition `json:"categories,omitempty" yaml:"categories,omitempty" mapstructure:"categories"`
+}
+
+// EntityTypeSchema 是一组实体类型定义，可以从 schema 文件加载 (见 cli.LoadEntityTypeSchema)。
+type EntityTypeSchema struct {
+	Types []*EntityTypeDefinition `json:"types" yaml:"types" mapstructure:"types"`
+}
+
+// Validate checks if the schema is valid.
+func (s *EntityTypeSchema) Validate() error {
+	if len(s.Types) == 0 {
+		return fmt.Errorf("entity type schema must define at least one type")
+	}
+
+	seen := make(map[string]bool, len(s.Types))
+	for i, definition := range s.Types {
+		if definition == nil || strings.TrimSpace(definition.Name) == "" {
+			return fmt.Errorf("entity type %d must have a name", i)
+		}
+		if strings.ContainsAny(definition.Name, "<>[].") {
+			return fmt.Errorf("entity type name must not contain <, >, [, ] or '.': %s", definition.Name)
+		}
+		if seen[definition.Name] {
+			return fmt.Errorf("duplicate entity type: %s", definition.Name)
+		}
+		seen[definition.Name] = true
+
+		for j, category := range definition.Categories {
+			if strings.TrimSpace(category.Name) == "" {
+				return fmt.Errorf("category %d of entity type %s must have a name", j, definition.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Names returns the names of the types in schema order.
+func (s *EntityTypeSchema) Names() []string {
+	names := make([]string, 0, len(s.Types))
+	for _, definition := range s.Types {
+		names = append(names, definition.Name)
+	}
+	return names
+}
+
+// Lookup returns the definition of the named type, or nil if the schema does not define it.
+func (s *EntityTypeSchema) Lookup(name string) *EntityTypeDefinition {
+	if s == nil {
+		return nil
+	}
+	for _, definition := range s.Types {
+		if definition.Name == name {
+			return definition
+		}
+	}
+	return nil
+}
+
+// describe renders the definitions of the requested types for the prompt.
+// Types without a definition, or whose definition only has a name, are left out;
+// an empty string is returned if nothing is left to describe.
+func (s *EntityTypeSchema) describe(types []string) string {
+	var builder strings.Builder
+	for _, name := range types {
+		definition := s.Lookup(name)
+		if definition == nil || !definition.hasDetails() {
+			continue
+		}
+
+		if builder.Len() == 0 {
+			builder.WriteString("Entity type definitions:\n")
+		}
+		fmt.Fprintf(&builder, "- %s", definition.Name)
+		if definition.Description != "" {
+			fmt.Fprintf(&builder, ": %s", definition.Description)
+		}
+		builder.WriteString("\n")
+
+		if len(definition.Categories) > 0 {
+			categories := make([]string, 0, len(definition.Categories))
+			for _, category := range definition.Categories {
+				if len(category.Details) == 0 {
+					categories = append(categories, category.Name)
+					continue
+				}
+				categories = append(categories, fmt.Sprintf("%s (%s)", category.Name, strings.Join(category.Details, ", ")))
+			}
+			fmt.Fprintf(&builder, "  Categories (Details): %s\n", strings.Join(categories, "; "))
+		}
+		if len(definition.Examples) > 0 {
+			fmt.Fprintf(&builder, "  Examples: %s\n", strings.Join(definition.Examples, "; "))
+		}
+		if len(definition.CounterExamples) > 0 {
+			fmt.Fprintf(&builder, "  Not this type: %s\n", strings.Join(definition.CounterExamples, "; "))
+		}
+	}
+	return builder.String()
+}
+
+// hasDetails returns true if the definition says more than its name.
+func (d *EntityTypeDefinition) hasDetails() bool {
+	return d.Description != "" || len(d.Examples) > 0 || len(d.CounterExamples) > 0 || len(d.Categories) > 0
+}
+
+// DefaultEntityTypeSchema 是内置实体类型 (DefaultEntityTypes) 的定义。
+var DefaultEntityTypeSchema = &EntityTypeSchema{
+	Types: []*EntityTypeDefinition{
+		{
+			Name:            "个人信息",
+			Description:     "能识别或联系到具体自然人的信息",
+			Examples:        []string{"张三", "13912345678", "li.si@example.org", "11010519491231002X"},
+			CounterExamples: []string{"用户", "客户经理"},
+			Categories: []CategoryDefinition{
+				{Name: "姓名", Details: []string{"全名", "姓氏", "昵称"}},
+				{Name: "电话", Details: []string{"号码"}},
+				{Name: "邮箱", Details: []string{"地址"}},
+				{Name: "身份证", Details: []string{"号码"}},
+				{Name: "生日", Details: []string{"日期"}},
+			},
+		},
+		{
+			Name:            "业务信息",
+			Description:     "未公开的业务数据，如项目代号、合同编号、订单号、交易金额和内部系统名称",
+			Examples:        []string{"星火计划", "HT-2024-0012", "订单 20240501123456", "320 万元"},
+			CounterExamples: []string{"项目", "合同", "公开发布的产品名称"},
+			Categories: []CategoryDefinition{
+				{Name: "项目", Details: []string{"名称", "代号"}},
+				{Name: "合同", Details: []string{"编号", "金额"}},
+				{Name: "订单", Details: []string{"编号"}},
+				{Name: "系统", Details: []string{"名称"}},
+			},
+		},
+		{
+			Name:            "资产信息",
+			Description:     "可定位到具体资产的标识，如服务器地址、域名、网址、设备编号和车牌",
+			Examples:        []string{"192.168.1.10", "https://intranet.example.com", "京A12345"},
+			CounterExamples: []string{"localhost", "127.0.0.1", "服务器"},
+			Categories: []CategoryDefinition{
+				{Name: "IP", Details: []string{"地址"}},
+				{Name: "网址", Details: []string{"链接", "域名"}},
+				{Name: "设备", Details: []string{"编号"}},
+				{Name: "车牌", Details: []string{"号码"}},
+			},
+		},
+		{
+			Name:            "账户信息",
+			Description:     "账号及其凭证，如银行卡号、用户名、密码和 API 密钥",
+			Examples:        []string{"6222021234567890123", "zhangsan_admin", "sk-abc123"},
+			CounterExamples: []string{"账号", "密码已重置"},
+			Categories: []CategoryDefinition{
+				{Name: "银行卡", Details: []string{"号码"}},
+				{Name: "账号", Details: []string{"用户名"}},
+				{Name: "凭证", Details: []string{"密码", "密钥"}},
+			},
+		},
+		{
+			Name:            "位置数据",
+			Description:     "具体的地理位置，如详细地址、小区、楼栋和门牌号",
+			Examples:        []string{"北京市海淀区中关村大街 1 号", "阳光花园 3 栋 402"},
+			CounterExamples: []string{"北方", "线上"},
+			Categories: []CategoryDefinition{
+				{Name: "地址", Details: []string{"详细地址", "城市", "区县"}},
+				{Name: "场所", Details: []string{"名称"}},
+			},
+		},
+		{
+			Name:            "文档名称",
+			Description:     "内部文件、报告和附件的名称",
+			Examples:        []string{"《2024 年度预算.xlsx》", "薪酬调整方案 v2.docx"},
+			CounterExamples: []string{"文件", "附件"},
+			Categories: []CategoryDefinition{
+				{Name: "文件", Details: []string{"名称"}},
+			},
+		},
+		{
+			Name:            "组织机构",
+			Description:     "公司、部门、团队和其他机构的名称",
+			Examples:        []string{"某某科技有限公司", "风控部", "华东销售二组"},
+			CounterExamples: []string{"公司", "团队"},
+			Categories: []CategoryDefinition{
+				{Name: "公司", Details: []string{"名称"}},
+				{Name: "部门", Details: []string{"名称"}},
+			},
+		},
+		{
+			Name:            "岗位称谓",
+			Description:     "与具体人员对应的职务、职级和称谓",
+			Examples:        []string{"技术总监", "P7 工程师", "王总"},
+			CounterExamples: []string{"员工", "同事"},
+			Categories: []CategoryDefinition{
+				{Name: "职位", Details: []string{"名称", "职级"}},
+				{Name: "称谓", Details: []string{"称呼"}},
+			},
+		},
+	},
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mrlyc/inu/pkg/anonymizer/anonymizertest"
+)
+
+func TestEntityTypeSchema_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  *EntityTypeSchema
+		wantErr bool
+	}{
+		{name: "default schema", schema: DefaultEntityTypeSchema},
+		{name: "no types", schema: &EntityTypeSchema{}, wantErr: true},
+		{name: "missing name", schema: &EntityTypeSchema{Types: []*EntityTypeDefinition{{Description: "x"}}}, wantErr: true},
+		{name: "placeholder syntax in name", schema: &EntityTypeSchema{Types: []*EntityTypeDefinition{{Name: "客户.名称"}}}, wantErr: true},
+		{name: "duplicate name", schema: &EntityTypeSchema{Types: []*EntityTypeDefinition{{Name: "客户"}, {Name: "客户"}}}, wantErr: true},
+		{
+			name:    "category without name",
+			schema:  &EntityTypeSchema{Types: []*EntityTypeDefinition{{Name: "客户", Categories: []CategoryDefinition{{Details: []string{"全称"}}}}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.schema.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEntityTypeSchema_Describe(t *testing.T) {
+	schema := &EntityTypeSchema{
+		Types: []*EntityTypeDefinition{
+			{
+				Name:            "客户",
+				Description:     "客户公司名称",
+				Examples:        []string{"某某科技", "某某银行"},
+				CounterExamples: []string{"供应商"},
+				Categories: []CategoryDefinition{
+					{Name: "公司", Details: []string{"全称", "简称"}},
+					{Name: "品牌"},
+				},
+			},
+			{Name: "内部代号"},
+		},
+	}
+
+	expected := `Entity type definitions:
+- 客户: 客户公司名称
+  Categories (Details): 公司 (全称, 简称); 品牌
+  Examples: 某某科技; 某某银行
+  Not this type: 供应商
+`
+	if got := schema.describe([]string{"客户", "内部代号", "未定义"}); got != expected {
+		t.Errorf("unexpected description:\n%s", got)
+	}
+
+	// Nothing to describe keeps the prompt unchanged
+	if got := schema.describe([]string{"内部代号", "未定义"}); got != "" {
+		t.Errorf("expected an empty description, got %q", got)
+	}
+	var none *EntityTypeSchema
+	if got := none.describe([]string{"客户"}); got != "" {
+		t.Errorf("expected an empty description for a nil schema, got %q", got)
+	}
+}
+
+func TestDefaultEntityTypes_MatchSchema(t *testing.T) {
+	if strings.Join(DefaultEntityTypes, ",") != strings.Join(DefaultEntityTypeSchema.Names(), ",") {
+		t.Errorf("DefaultEntityTypes %v do not match the default schema", DefaultEntityTypes)
+	}
+}
+
+func TestAnonymize_PromptDescribesEntityTypes(t *testing.T) {
+	schema := &EntityTypeSchema{
+		Types: []*EntityTypeDefinition{{Name: "客户", Description: "客户公司名称"}},
+	}
+
+	chatModel := anonymizertest.NewChatModel(anonymizertest.Tokens("None"), anonymizertest.Tokens("None"))
+	anon, err := NewHashHidePair(chatModel, WithEntityTypeSchema(schema))
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	if _, err := anon.Anonymize(context.Background(), []string{"客户"}, "某某科技", io.Discard); err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+	prompt := chatModel.Requests()[0][0].Content
+	if !strings.Contains(prompt, "- 客户: 客户公司名称\n<text>") {
+		t.Errorf("expected the definition in the prompt, got %q", prompt)
+	}
+
+	// Types the schema does not define are passed by name only
+	if _, err := anon.Anonymize(context.Background(), []string{"未定义"}, "某某科技", io.Discard); err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+	prompt = chatModel.Requests()[1][0].Content
+	if strings.Contains(prompt, "Entity type definitions") {
+		t.Errorf("expected no definitions for an undefined type, got %q", prompt)
+	}
+}
+
+func TestStructured_PromptDescribesEntityTypes(t *testing.T) {
+	chatModel := anonymizertest.NewChatModel(anonymizertest.Tokens(`{"anonymized_text": "某某科技", "mapping": []}`))
+	anon, err := NewStructured(chatModel)
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	if _, err := anon.Anonymize(context.Background(), []string{"个人信息"}, "某某科技", io.Discard); err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+	prompt := chatModel.Requests()[0][0].Content
+	if !strings.Contains(prompt, "- 个人信息: "+DefaultEntityTypeSchema.Lookup("个人信息").Description) {
+		t.Errorf("expected the default definition in the prompt, got %q", prompt)
+	}
+}
@@ -0,0 +1,312 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	// FixtureModeEnv selects the fixture mode of CreateOpenAIChatModel: "record" or "replay"
+	FixtureModeEnv = "INU_LLM_FIXTURE_MODE"
+	// FixtureDirEnv is the directory of the fixture files, DefaultFixtureDir if unset
+	FixtureDirEnv = "INU_LLM_FIXTURE_DIR"
+	// DefaultFixtureDir is the fixture directory used when FixtureDirEnv is unset
+	DefaultFixtureDir = "testdata/llm-fixtures"
+)
+
+// FixtureMode 决定 CreateOpenAIChatModel 如何使用 LLM 请求/响应夹具。
+type FixtureMode string
+
+const (
+	// FixtureOff 直接调用真实模型
+	FixtureOff FixtureMode = ""
+	// FixtureRecord 调用真实模型并把请求和响应写入夹具文件
+	FixtureRecord FixtureMode = "record"
+	// FixtureReplay 不访问网络，只从夹具文件返回响应
+	FixtureReplay FixtureMode = "replay"
+)
+
+// ParseFixtureMode parses a fixture mode name.
+func ParseFixtureMode(name string) (FixtureMode, error) {
+	switch mode := FixtureMode(name); mode {
+	case FixtureOff, FixtureRecord, FixtureReplay:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown fixture mode: %s (supported: %s, %s)", name, FixtureRecord, FixtureReplay)
+}
+
+// ErrFixtureNotFound is returned by ReplayChatModel when no fixture was recorded for the messages.
+var ErrFixtureNotFound = errors.New("llm fixture not found")
+
+// Fixture 是一次模型调用的记录，以 FixtureKey 命名保存为 JSON 文件。
+// Response 记录 Generate 的结果，Chunks 记录 Stream 的消息块；同一请求两种调用方式可以共存于同一文件。
+type Fixture struct {
+	Key      string            `json:"key"`
+	Messages []*schema.Message `json:"messages"`
+	Tools    []string          `json:"tools,omitempty"`
+	Response *schema.Message   `json:"response,omitempty"`
+	Chunks   []*schema.Message `json:"chunks,omitempty"`
+}
+
+// FixtureKey returns the key of a request: the hex SHA-256 of the JSON encoded messages and bound tool names.
+func FixtureKey(messages []*schema.Message, tools []string) (string, error) {
+	encoded, err := json.Marshal(struct {
+		Messages []*schema.Message `json:"messages"`
+		Tools    []string          `json:"tools,omitempty"`
+	}{messages, tools})
+	if err != nil {
+		return "", eris.Wrap(err, "failed to marshal messages")
+	}
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// fixturePath returns the path of the fixture file for key.
+func fixturePath(dir, key string) string {
+	return filepath.Join(dir, key+".json")
+}
+
+// loadFixture reads the fixture of key, returning ErrFixtureNotFound if it does not exist.
+func loadFixture(dir, key string) (*Fixture, error) {
+	data, err := os.ReadFile(fixturePath(dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, eris.Wrapf(ErrFixtureNotFound, "no fixture %s in %s, record it with %s=%s", key, dir, FixtureModeEnv, FixtureRecord)
+	}
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to read fixture %s", key)
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, eris.Wrapf(err, "failed to unmarshal fixture %s", key)
+	}
+	return &fixture, nil
+}
+
+// toolNames returns the names of the tools, which are part of the fixture key.
+func toolNames(tools []*schema.ToolInfo) []string {
+	names := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+	}
+	return names
+}
+
+// RecordingChatModel 包装一个真实模型，把每次成功调用的请求和 (流式) 响应记录为夹具文件，
+// 供 ReplayChatModel 在无网络环境下确定性地重放。可安全地并发使用。
+type RecordingChatModel struct {
+	chatModel model.BaseChatModel
+	dir       string
+	tools     []string
+	// mu serializes the read-modify-write of fixture files, shared with the models returned by WithTools
+	mu *sync.Mutex
+}
+
+// NewRecordingChatModel 创建一个把 chatModel 的调用记录到 dir 的模型。
+func NewRecordingChatModel(chatModel model.BaseChatModel, dir string) *RecordingChatModel {
+	return &RecordingChatModel{
+		chatModel: chatModel,
+		dir:       dir,
+		mu:        &sync.Mutex{},
+	}
+}
+
+// Generate implements model.BaseChatModel.
+func (r *RecordingChatModel) Generate(ctx context.Context, messages []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	response, err := r.chatModel.Generate(ctx, messages, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.save(messages, func(fixture *Fixture) { fixture.Response = response }); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Stream implements model.BaseChatModel.
+// The chunks are forwarded as they arrive; the fixture is written once the stream has been received completely,
+// a failure to write it is returned as the last stream error.
+func (r *RecordingChatModel) Stream(ctx context.Context, messages []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	stream, err := r.chatModel.Stream(ctx, messages, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, writer := schema.Pipe[*schema.Message](0)
+	go func() {
+		defer stream.Close()
+		defer writer.Close()
+
+		var chunks []*schema.Message
+		for {
+			chunk, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				writer.Send(nil, err)
+				return
+			}
+
+			chunks = append(chunks, chunk)
+			if closed := writer.Send(chunk, nil); closed {
+				// The consumer stopped early, the response is incomplete
+				return
+			}
+		}
+
+		if err := r.save(messages, func(fixture *Fixture) { fixture.Chunks = chunks }); err != nil {
+			writer.Send(nil, err)
+		}
+	}()
+
+	return reader, nil
+}
+
+// WithTools implements model.ToolCallingChatModel if the wrapped model supports tool calling.
+func (r *RecordingChatModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	toolModel, ok := r.chatModel.(model.ToolCallingChatModel)
+	if !ok {
+		return nil, fmt.Errorf("chat model %T does not support tool calling", r.chatModel)
+	}
+
+	bound, err := toolModel.WithTools(tools)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecordingChatModel{
+		chatModel: bound,
+		dir:       r.dir,
+		tools:     toolNames(tools),
+		mu:        r.mu,
+	}, nil
+}
+
+// save updates the fixture of messages, keeping a response recorded by the other call type.
+func (r *RecordingChatModel) save(messages []*schema.Message, update func(*Fixture)) error {
+	key, err := FixtureKey(messages, r.tools)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fixture, err := loadFixture(r.dir, key)
+	if errors.Is(err, ErrFixtureNotFound) {
+		fixture = &Fixture{Key: key, Messages: messages, Tools: r.tools}
+	} else if err != nil {
+		return err
+	}
+	update(fixture)
+
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return eris.Wrapf(err, "failed to marshal fixture %s", key)
+	}
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return eris.Wrapf(err, "failed to create fixture directory %s", r.dir)
+	}
+	if err := os.WriteFile(fixturePath(r.dir, key), append(data, '\n'), 0o644); err != nil {
+		return eris.Wrapf(err, "failed to write fixture %s", key)
+	}
+	return nil
+}
+
+// ReplayChatModel 从 RecordingChatModel 记录的夹具文件返回响应，不访问网络。
+// 请求按 FixtureKey 匹配，未记录的请求返回 ErrFixtureNotFound。
+// 只记录过 Generate 的请求也可以 Stream (整条消息作为一个块)，反之亦然 (块被合并为一条消息)。
+type ReplayChatModel struct {
+	dir   string
+	tools []string
+}
+
+// NewReplayChatModel 创建一个从 dir 重放夹具的模型。
+func NewReplayChatModel(dir string) *ReplayChatModel {
+	return &ReplayChatModel{dir: dir}
+}
+
+// load returns the fixture recorded for messages.
+func (r *ReplayChatModel) load(messages []*schema.Message) (*Fixture, error) {
+	key, err := FixtureKey(messages, r.tools)
+	if err != nil {
+		return nil, err
+	}
+	return loadFixture(r.dir, key)
+}
+
+// Generate implements model.BaseChatModel.
+func (r *ReplayChatModel) Generate(ctx context.Context, messages []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	fixture, err := r.load(messages)
+	if err != nil {
+		return nil, err
+	}
+
+	if fixture.Response != nil {
+		return fixture.Response, nil
+	}
+	if len(fixture.Chunks) == 0 {
+		return nil, fmt.Errorf("fixture %s has no response", fixture.Key)
+	}
+
+	response, err := schema.ConcatMessages(fixture.Chunks)
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to concat chunks of fixture %s", fixture.Key)
+	}
+	return response, nil
+}
+
+// Stream implements model.BaseChatModel.
+func (r *ReplayChatModel) Stream(ctx context.Context, messages []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	fixture, err := r.load(messages)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fixture.Chunks) > 0 {
+		return schema.StreamReaderFromArray(fixture.Chunks), nil
+	}
+	if fixture.Response == nil {
+		return nil, fmt.Errorf("fixture %s has no response", fixture.Key)
+	}
+	return schema.StreamReaderFromArray([]*schema.Message{fixture.Response}), nil
+}
+
+// WithTools implements model.ToolCallingChatModel. The tool names become part of the fixture key.
+func (r *ReplayChatModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return &ReplayChatModel{
+		dir:   r.dir,
+		tools: toolNames(tools),
+	}, nil
+}
@@ -0,0 +1,287 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/mrlyc/inu/pkg/anonymizer/anonymizertest"
+)
+
+// readStream receives all chunks and returns their concatenated content.
+func readStream(t *testing.T, stream *schema.StreamReader[*schema.Message]) (string, error) {
+	t.Helper()
+	defer stream.Close()
+
+	var content string
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return content, nil
+		}
+		if err != nil {
+			return content, err
+		}
+		content += chunk.Content
+	}
+}
+
+// TestFixture_RecordAndReplay tests that recorded Generate and Stream calls are replayed offline.
+func TestFixture_RecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	generateMessages := []*schema.Message{schema.UserMessage("generate")}
+	streamMessages := []*schema.Message{schema.UserMessage("stream")}
+
+	recorder := NewRecordingChatModel(anonymizertest.NewChatModel(
+		anonymizertest.Tokens("hello ", "world"),
+		anonymizertest.Tokens("streamed ", "reply"),
+	), dir)
+
+	response, err := recorder.Generate(ctx, generateMessages)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if response.Content != "hello world" {
+		t.Errorf("unexpected response: %q", response.Content)
+	}
+
+	stream, err := recorder.Stream(ctx, streamMessages)
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	content, err := readStream(t, stream)
+	if err != nil || content != "streamed reply" {
+		t.Fatalf("unexpected stream: %q, %v", content, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read fixture dir: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 fixtures, got %d", len(entries))
+	}
+
+	replay := NewReplayChatModel(dir)
+
+	response, err = replay.Generate(ctx, generateMessages)
+	if err != nil || response.Content != "hello world" {
+		t.Errorf("unexpected replayed response: %v, %v", response, err)
+	}
+
+	stream, err = replay.Stream(ctx, streamMessages)
+	if err != nil {
+		t.Fatalf("replayed Stream failed: %v", err)
+	}
+	chunks := 0
+	stream = schema.StreamReaderWithConvert(stream, func(chunk *schema.Message) (*schema.Message, error) {
+		chunks++
+		return chunk, nil
+	})
+	content, err = readStream(t, stream)
+	if err != nil || content != "streamed reply" {
+		t.Errorf("unexpected replayed stream: %q, %v", content, err)
+	}
+	if chunks != 2 {
+		t.Errorf("expected the recorded 2 chunks, got %d", chunks)
+	}
+
+	// A streamed recording can be generated and vice versa
+	response, err = replay.Generate(ctx, streamMessages)
+	if err != nil || response.Content != "streamed reply" {
+		t.Errorf("unexpected response from chunks: %v, %v", response, err)
+	}
+	stream, err = replay.Stream(ctx, generateMessages)
+	if err != nil {
+		t.Fatalf("replayed Stream failed: %v", err)
+	}
+	content, err = readStream(t, stream)
+	if err != nil || content != "hello world" {
+		t.Errorf("unexpected stream from response: %q, %v", content, err)
+	}
+}
+
+// TestFixture_ReplayMissing tests that an unrecorded request fails with ErrFixtureNotFound.
+func TestFixture_ReplayMissing(t *testing.T) {
+	replay := NewReplayChatModel(t.TempDir())
+
+	_, err := replay.Generate(context.Background(), []*schema.Message{schema.UserMessage("unknown")})
+	if !errors.Is(err, ErrFixtureNotFound) {
+		t.Errorf("expected ErrFixtureNotFound, got %v", err)
+	}
+}
+
+// TestFixture_StreamErrorNotRecorded tests that a failed stream does not leave a fixture behind.
+func TestFixture_StreamErrorNotRecorded(t *testing.T) {
+	dir := t.TempDir()
+	recorder := NewRecordingChatModel(anonymizertest.NewChatModel(anonymizertest.Response{
+		Tokens:    []string{"partial"},
+		StreamErr: errors.New("connection reset"),
+	}), dir)
+
+	stream, err := recorder.Stream(context.Background(), []*schema.Message{schema.UserMessage("text")})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if _, err := readStream(t, stream); err == nil {
+		t.Fatal("expected the stream error")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("expected no fixture, got %d", len(entries))
+	}
+}
+
+// TestFixtureKey tests that the key depends on the messages and the bound tools.
+func TestFixtureKey(t *testing.T) {
+	messages := []*schema.Message{schema.UserMessage("text")}
+
+	key, err := FixtureKey(messages, nil)
+	if err != nil {
+		t.Fatalf("FixtureKey failed: %v", err)
+	}
+	same, _ := FixtureKey([]*schema.Message{schema.UserMessage("text")}, []string{})
+	other, _ := FixtureKey([]*schema.Message{schema.UserMessage("other")}, nil)
+	withTools, _ := FixtureKey(messages, []string{structuredToolName})
+
+	if key != same {
+		t.Error("expected equal messages to have the same key")
+	}
+	if key == other || key == withTools {
+		t.Error("expected different requests to have different keys")
+	}
+}
+
+// TestFixture_AnonymizeReplay tests that an anonymization recorded once is replayed identically.
+func TestFixture_AnonymizeReplay(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	text := "张三来了"
+
+	recorded, err := NewHashHidePair(NewRecordingChatModel(anonymizertest.NewChatModel(
+		anonymizertest.PairResponse("<个人信息[0].姓名.全名>来了", map[string][]string{
+			"<个人信息[0].姓名.全名>": {"张三"},
+		}, 3),
+	), dir))
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	var expected bytes.Buffer
+	if _, err := recorded.Anonymize(ctx, []string{"个人信息"}, text, &expected); err != nil {
+		t.Fatalf("recorded Anonymize failed: %v", err)
+	}
+
+	replayed, err := NewHashHidePair(NewReplayChatModel(dir))
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	var actual bytes.Buffer
+	entities, err := replayed.Anonymize(ctx, []string{"个人信息"}, text, &actual)
+	if err != nil {
+		t.Fatalf("replayed Anonymize failed: %v", err)
+	}
+	if actual.String() != expected.String() {
+		t.Errorf("expected %q, got %q", expected.String(), actual.String())
+	}
+	if len(entities) != 1 || entities[0].Values[0] != "张三" {
+		t.Errorf("unexpected entities: %v", entities)
+	}
+}
+
+// TestFixture_StructuredReplay tests recording and replaying through the tool-calling engine.
+func TestFixture_StructuredReplay(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	recorded, err := NewStructured(NewRecordingChatModel(anonymizertest.NewChatModel(anonymizertest.Response{
+		ToolCalls: []schema.ToolCall{{
+			ID:   "call_0",
+			Type: "function",
+			Function: schema.FunctionCall{
+				Name:      structuredToolName,
+				Arguments: `{"anonymized_text":"<个人信息[0].姓名.全名>来了","mapping":[{"key":"<个人信息[0].姓名.全名>","values":["张三"]}]}`,
+			},
+		}},
+	}), dir))
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+	if _, err := recorded.Anonymize(ctx, []string{"个人信息"}, "张三来了", io.Discard); err != nil {
+		t.Fatalf("recorded Anonymize failed: %v", err)
+	}
+
+	replayed, err := NewStructured(NewReplayChatModel(dir))
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := replayed.Anonymize(ctx, []string{"个人信息"}, "张三来了", &buf); err != nil {
+		t.Fatalf("replayed Anonymize failed: %v", err)
+	}
+	if buf.String() != "<个人信息[0].姓名.全名>来了" {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+
+	// The bound tool is part of the key, so only the structured request was recorded
+	entries, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(entries) != 1 {
+		t.Errorf("expected 1 fixture, got %d", len(entries))
+	}
+}
+
+// TestCreateOpenAIChatModel_FixtureMode tests that the fixture mode is selected by the environment.
+func TestCreateOpenAIChatModel_FixtureMode(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(FixtureDirEnv, dir)
+
+	t.Setenv(FixtureModeEnv, string(FixtureReplay))
+	chatModel, err := CreateOpenAIChatModel(context.Background())
+	if err != nil {
+		t.Fatalf("CreateOpenAIChatModel failed: %v", err)
+	}
+	if replay, ok := chatModel.(*ReplayChatModel); !ok || replay.dir != dir {
+		t.Errorf("expected a replay model for %s, got %#v", dir, chatModel)
+	}
+
+	t.Setenv(FixtureModeEnv, string(FixtureRecord))
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	t.Setenv("OPENAI_MODEL_NAME", "test-model")
+	chatModel, err = CreateOpenAIChatModel(context.Background())
+	if err != nil {
+		t.Fatalf("CreateOpenAIChatModel failed: %v", err)
+	}
+	if _, ok := chatModel.(*RecordingChatModel); !ok {
+		t.Errorf("expected a recording model, got %T", chatModel)
+	}
+
+	t.Setenv(FixtureModeEnv, "unknown")
+	if _, err := CreateOpenAIChatModel(context.Background()); err == nil {
+		t.Error("expected an error for an unknown fixture mode")
+	}
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/rotisserie/eris"
+)
+
+// Hybrid 是规则与 LLM 组合的 Anonymizer 实现。
+// 处理流程：
+//  1. 使用规则 Anonymizer 在本地替换高置信度的结构化实体 (邮箱、电话、证件号等)
+//  2. 将已替换的文本交给 LLM Anonymizer 识别模糊实体 (姓名、组织、项目等)
+//  3. 合并两组实体，LLM 实体与规则实体 ID 冲突时重新编号
+//
+// 结构化实体不会发送给 LLM，既减少数据外泄也节省 token。
+// 当规则命中实体时，LLM 的输出需要改写占位符，因此会在 LLM 完成后一次性写入 writer。
+type Hybrid struct {
+	rules Anonymizer
+	llm   Anonymizer
+}
+
+// Anonymize masks structured entities with the rules first, then anonymizes the rest with the LLM.
+func (h *Hybrid) Anonymize(ctx context.Context, types []string, text string, writer io.Writer) ([]*Entity, error) {
+	var masked bytes.Buffer
+	ruleEntities, err := h.rules.Anonymize(ctx, types, text, &masked)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to anonymize with rules")
+	}
+
+	if len(ruleEntities) == 0 {
+		return h.llm.Anonymize(ctx, types, text, writer)
+	}
+
+	var output bytes.Buffer
+	llmEntities, err := h.llm.Anonymize(ctx, types, masked.String(), &output)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to anonymize with LLM")
+	}
+
+	merger := newEntityMerger()
+	merger.merge(ruleEntities)
+	keyMap := merger.merge(filterEchoedEntities(llmEntities, ruleEntities))
+
+	if _, err := writer.Write([]byte(rewritePlaceholders(output.String(), keyMap))); err != nil {
+		return nil, eris.Wrap(err, "failed to write to output")
+	}
+
+	return merger.entities, nil
+}
+
+// RestoreText restores placeholders of the merged entity set.
+func (h *Hybrid) RestoreText(ctx context.Context, entities []*Entity, text string, writer io.Writer) ([]RestoreFailure, error) {
+	return h.llm.RestoreText(ctx, entities, text, writer)
+}
+
+// filterEchoedEntities drops LLM entities that merely echo placeholders produced by the rules:
+// entities reusing a rule key, and values that are themselves placeholders.
+func filterEchoedEntities(entities []*Entity, ruleEntities []*Entity) []*Entity {
+	ruleKeys := make(map[string]bool, len(ruleEntities))
+	for _, entity := range ruleEntities {
+		ruleKeys[normalizePlaceholder(entity.Key)] = true
+	}
+
+	filtered := make([]*Entity, 0, len(entities))
+	for _, entity := range entities {
+		if ruleKeys[normalizePlaceholder(entity.Key)] {
+			continue
+		}
+
+		values := make([]string, 0, len(entity.Values))
+		for _, value := range entity.Values {
+			if !placeholderRegex.MatchString(value) {
+				values = append(values, value)
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		copied := *entity
+		copied.Values = values
+		filtered = append(filtered, &copied)
+	}
+
+	return filtered
+}
+
+// NewHybrid 创建一个先规则后 LLM 的组合 Anonymizer。
+func NewHybrid(rules Anonymizer, llm Anonymizer) (Anonymizer, error) {
+	if rules == nil || llm == nil {
+		return nil, eris.New("hybrid anonymizer requires both rules and llm anonymizers")
+	}
+
+	return &Hybrid{
+		rules: rules,
+		llm:   llm,
+	}, nil
+}
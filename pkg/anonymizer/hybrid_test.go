@@ -0,0 +1,125 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mrlyc/inu/pkg/anonymizer/anonymizertest"
+)
+
+func newTestHybrid(t *testing.T, mockLLM *anonymizertest.ChatModel) Anonymizer {
+	t.Helper()
+
+	rules, err := NewRuleBased(nil)
+	if err != nil {
+		t.Fatalf("Failed to create rule-based anonymizer: %v", err)
+	}
+	llm, err := NewHashHidePair(mockLLM)
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+	anon, err := NewHybrid(rules, llm)
+	if err != nil {
+		t.Fatalf("Failed to create hybrid anonymizer: %v", err)
+	}
+	return anon
+}
+
+// TestHybrid_MergesRuleAndLLMEntities tests that structured entities never reach the LLM
+// and that colliding LLM IDs are renumbered.
+func TestHybrid_MergesRuleAndLLMEntities(t *testing.T) {
+	ctx := context.Background()
+	originalText := "张三的电话是13800138000"
+	mockLLM := newMockWithResponse(newMockAnonymizeResponse(
+		"<个人信息[1].姓名.全名>的电话是<个人信息[1].电话.号码>",
+		map[string][]string{
+			"<个人信息[1].姓名.全名>": {"张三"},
+			"<个人信息[1].电话.号码>": {"<个人信息[1].电话.号码>"},
+		},
+	))
+	anon := newTestHybrid(t, mockLLM)
+
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(ctx, []string{"个人信息"}, originalText, &buf)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+
+	for _, msg := range lastRequest(mockLLM) {
+		if strings.Contains(msg.Content, "13800138000") {
+			t.Errorf("phone number was sent to the LLM: %q", msg.Content)
+		}
+	}
+
+	expected := "<个人信息[2].姓名.全名>的电话是<个人信息[1].电话.号码>"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	if len(entities) != 2 {
+		t.Fatalf("expected 2 entities, got %d", len(entities))
+	}
+	if entities[0].Key != "<个人信息[1].电话.号码>" || entities[1].Key != "<个人信息[2].姓名.全名>" {
+		t.Errorf("unexpected entity keys: %s, %s", entities[0].Key, entities[1].Key)
+	}
+
+	var restored bytes.Buffer
+	failures, err := anon.RestoreText(ctx, entities, buf.String(), &restored)
+	if err != nil {
+		t.Fatalf("RestoreText failed: %v", err)
+	}
+	if restored.String() != originalText || len(failures) != 0 {
+		t.Errorf("round trip failed: %q, failures: %v", restored.String(), failures)
+	}
+}
+
+// TestHybrid_NoRuleMatches tests that the LLM result is used as-is when no rule matches.
+func TestHybrid_NoRuleMatches(t *testing.T) {
+	mockLLM := newMockWithResponse(newMockAnonymizeResponse(
+		"<个人信息[0].姓名.全名>在<组织机构[0].公司.全名>工作",
+		map[string][]string{
+			"<个人信息[0].姓名.全名>": {"张三"},
+			"<组织机构[0].公司.全名>": {"ABC 科技"},
+		},
+	))
+	anon := newTestHybrid(t, mockLLM)
+
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(context.Background(), nil, "张三在ABC 科技工作", &buf)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+
+	if buf.String() != "<个人信息[0].姓名.全名>在<组织机构[0].公司.全名>工作" {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+	if len(entities) != 2 {
+		t.Errorf("expected 2 entities, got %d", len(entities))
+	}
+}
+
+// TestNewHybrid_RequiresBoth tests constructor validation.
+func TestNewHybrid_RequiresBoth(t *testing.T) {
+	rules, _ := NewRuleBased(nil)
+	if _, err := NewHybrid(rules, nil); err == nil {
+		t.Error("Expected error when llm anonymizer is nil, got nil")
+	}
+}
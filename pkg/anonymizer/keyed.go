@@ -0,0 +1,151 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/rotisserie/eris"
+)
+
+const (
+	// MinIDKeySize is the minimum size in bytes of the secret of keyed IDs
+	MinIDKeySize = 16
+	// DefaultKeyedIDLength is the default number of hex characters of a keyed ID
+	DefaultKeyedIDLength = 8
+)
+
+// KeyedIDConfig holds the configuration of keyed entity IDs.
+type KeyedIDConfig struct {
+	// Key is the HMAC secret; the same key yields the same IDs
+	Key []byte
+	// Length is the number of hex characters of an ID (DefaultKeyedIDLength if 0)
+	Length int
+}
+
+// Validate checks if the configuration is valid.
+func (c *KeyedIDConfig) Validate() error {
+	if len(c.Key) < MinIDKeySize {
+		return fmt.Errorf("ID key must be at least %d bytes, got %d", MinIDKeySize, len(c.Key))
+	}
+	if c.Length < 0 || c.Length > 2*sha256.Size {
+		return fmt.Errorf("ID length must be between 1 and %d (0 for the default), got %d", 2*sha256.Size, c.Length)
+	}
+	return nil
+}
+
+// KeyedIDs 是以密钥派生实体 ID 的 Anonymizer 包装。
+// 内部 Anonymizer 完成后，每个实体的 ID 改为 HMAC-SHA256(密钥, 实体类型 + 规范化后的值) 的前若干位十六进制，
+// 因此相同的值在不同文档、不同命令和 Web 服务器之间总是得到相同的占位符，例如 <个人信息[3f9a1c0b].姓名.全名>。
+// 多值实体使用规范化后最小的值派生 ID。没有密钥无法从 ID 反推原值。
+// 改写需要完整的实体映射，因此输出会在内部 Anonymizer 完成后一次性写入 writer。
+type KeyedIDs struct {
+	inner  Anonymizer
+	key    []byte
+	length int
+}
+
+// Anonymize anonymizes the text with the wrapped Anonymizer and replaces the entity IDs with keyed IDs.
+func (k *KeyedIDs) Anonymize(ctx context.Context, types []string, text string, writer io.Writer) ([]*Entity, error) {
+	var output bytes.Buffer
+	entities, err := k.inner.Anonymize(ctx, types, text, &output)
+	if err != nil {
+		return nil, err
+	}
+
+	keyMap := make(map[string]string, len(entities))
+	byKey := make(map[string]*Entity, len(entities))
+	result := make([]*Entity, 0, len(entities))
+	for _, entity := range entities {
+		copied := *entity
+		copied.Values = append([]string(nil), entity.Values...)
+		if len(copied.Values) == 0 {
+			result = append(result, &copied)
+			continue
+		}
+
+		id := k.deriveID(copied.EntityType, copied.Values)
+		key := formatEntityKey(copied.EntityType, id, copied.Category, copied.Detail)
+		keyMap[normalizePlaceholder(entity.Key)] = key
+
+		// Entities deriving the same key share a value: merge them
+		if existing, ok := byKey[key]; ok {
+			for _, value := range copied.Values {
+				if !containsString(existing.Values, value) {
+					existing.Values = append(existing.Values, value)
+				}
+			}
+			continue
+		}
+
+		copied.ID = id
+		copied.Key = key
+		byKey[key] = &copied
+		result = append(result, &copied)
+	}
+
+	if _, err := io.WriteString(writer, rewritePlaceholders(output.String(), keyMap)); err != nil {
+		return nil, eris.Wrap(err, "failed to write to output")
+	}
+
+	return result, nil
+}
+
+// RestoreText restores the text with the wrapped Anonymizer.
+func (k *KeyedIDs) RestoreText(ctx context.Context, entities []*Entity, text string, writer io.Writer) ([]RestoreFailure, error) {
+	return k.inner.RestoreText(ctx, entities, text, writer)
+}
+
+// deriveID derives the ID of an entity from its type and its smallest normalized value.
+func (k *KeyedIDs) deriveID(entityType string, values []string) string {
+	value := normalizeValue(values[0])
+	for _, v := range values[1:] {
+		if normalized := normalizeValue(v); normalized < value {
+			value = normalized
+		}
+	}
+
+	mac := hmac.New(sha256.New, k.key)
+	mac.Write([]byte(entityType))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:k.length]
+}
+
+// NewKeyedIDs 创建一个以密钥派生实体 ID 的 Anonymizer 包装。
+func NewKeyedIDs(inner Anonymizer, config *KeyedIDConfig) (Anonymizer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, eris.Wrap(err, "invalid keyed ID config")
+	}
+
+	length := config.Length
+	if length == 0 {
+		length = DefaultKeyedIDLength
+	}
+
+	return &KeyedIDs{
+		inner:  inner,
+		key:    append([]byte(nil), config.Key...),
+		length: length,
+	}, nil
+}
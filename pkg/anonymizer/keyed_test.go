@@ -0,0 +1,175 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mrlyc/inu/pkg/anonymizer/anonymizertest"
+)
+
+var testIDKey = []byte("0123456789abcdef0123456789abcdef")
+
+func newTestKeyedIDs(t *testing.T, inner Anonymizer, key []byte) Anonymizer {
+	t.Helper()
+
+	anon, err := NewKeyedIDs(inner, &KeyedIDConfig{Key: key})
+	if err != nil {
+		t.Fatalf("Failed to create keyed ID anonymizer: %v", err)
+	}
+	return anon
+}
+
+func anonymizeEntityKeys(t *testing.T, anon Anonymizer, text string) (string, map[string]string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(context.Background(), DefaultEntityTypes, text, &buf)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+	keys := make(map[string]string)
+	for _, entity := range entities {
+		keys[entity.Values[0]] = entity.Key
+	}
+	return buf.String(), keys
+}
+
+func TestKeyedIDs_ConsistentAcrossDocuments(t *testing.T) {
+	rules, err := NewRuleBased(nil)
+	if err != nil {
+		t.Fatalf("Failed to create rule-based anonymizer: %v", err)
+	}
+	anon := newTestKeyedIDs(t, rules, testIDKey)
+
+	// The same email appears at a different position in each document
+	_, first := anonymizeEntityKeys(t, anon, "联系 zhangsan@corp.cn")
+	_, second := anonymizeEntityKeys(t, anon, "联系 lisi@corp.cn 或 zhangsan@corp.cn")
+
+	key := first["zhangsan@corp.cn"]
+	if key == "" || key != second["zhangsan@corp.cn"] {
+		t.Errorf("expected the same placeholder in both documents, got %q and %q", key, second["zhangsan@corp.cn"])
+	}
+	if key == second["lisi@corp.cn"] {
+		t.Errorf("expected different values to get different placeholders, got %q", key)
+	}
+	if !strings.Contains(key, "[") || len(entityKeyRegex.FindStringSubmatch(key)[2]) != DefaultKeyedIDLength {
+		t.Errorf("expected a keyed ID of %d characters, got %q", DefaultKeyedIDLength, key)
+	}
+
+	// Another secret yields other IDs
+	_, other := anonymizeEntityKeys(t, newTestKeyedIDs(t, rules, []byte("fedcba9876543210fedcba9876543210")), "联系 zhangsan@corp.cn")
+	if other["zhangsan@corp.cn"] == key {
+		t.Errorf("expected a different placeholder for a different key, got %q", key)
+	}
+}
+
+func TestKeyedIDs_Restore(t *testing.T) {
+	chatModel := anonymizertest.NewChatModel(anonymizertest.PairResponse(
+		"<个人信息[0].姓名.全名>和<个人信息[1].姓名.全名>讨论了<业务信息[0].项目.名称>，<个人信息[0].姓名.全名>负责",
+		map[string][]string{
+			"<个人信息[0].姓名.全名>": {"张三"},
+			"<个人信息[1].姓名.全名>": {"李四"},
+			"<业务信息[0].项目.名称>": {"星火计划"},
+		},
+		3,
+	))
+	llm, err := NewHashHidePair(chatModel)
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+	anon := newTestKeyedIDs(t, llm, testIDKey)
+
+	text := "张三和李四讨论了星火计划，张三负责"
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(context.Background(), []string{"个人信息", "业务信息"}, text, &buf)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+	anonymized := buf.String()
+
+	for _, entity := range entities {
+		if entity.ID == "0" || entity.ID == "1" {
+			t.Errorf("expected a keyed ID, got %q", entity.Key)
+		}
+		if strings.Count(anonymized, entity.Key) == 0 {
+			t.Errorf("expected %q in %q", entity.Key, anonymized)
+		}
+	}
+
+	var restored bytes.Buffer
+	failures, err := Restore(entities, anonymized, &restored, DefaultRestorePolicy)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if len(failures) != 0 || restored.String() != text {
+		t.Errorf("expected %q, got %q (failures: %v)", text, restored.String(), failures)
+	}
+}
+
+func TestKeyedIDs_MergesSameValue(t *testing.T) {
+	chatModel := anonymizertest.NewChatModel(anonymizertest.PairResponse(
+		"<个人信息[0].姓名.全名>和<个人信息[1].姓名.全名>",
+		map[string][]string{
+			"<个人信息[0].姓名.全名>": {"张三"},
+			"<个人信息[1].姓名.全名>": {" 张三 "},
+		},
+		3,
+	))
+	llm, err := NewHashHidePair(chatModel)
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	var buf bytes.Buffer
+	entities, err := newTestKeyedIDs(t, llm, testIDKey).Anonymize(context.Background(), []string{"个人信息"}, "张三和 张三 ", &buf)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+
+	if len(entities) != 1 {
+		t.Fatalf("expected the entities to be merged, got %+v", entities)
+	}
+	if expected := entities[0].Key + "和" + entities[0].Key; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestKeyedIDConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config KeyedIDConfig
+		valid  bool
+	}{
+		{name: "default length", config: KeyedIDConfig{Key: testIDKey}, valid: true},
+		{name: "full length", config: KeyedIDConfig{Key: testIDKey, Length: 64}, valid: true},
+		{name: "short key", config: KeyedIDConfig{Key: []byte("secret")}},
+		{name: "negative length", config: KeyedIDConfig{Key: testIDKey, Length: -1}},
+		{name: "too long", config: KeyedIDConfig{Key: testIDKey, Length: 65}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Validate() = %v, expected valid: %v", err, tt.valid)
+			}
+		})
+	}
+}
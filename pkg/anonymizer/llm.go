@@ -26,7 +26,23 @@ import (
 )
 
 // CreateOpenAIChatModel creates an OpenAI chat model instance.
+// With INU_LLM_FIXTURE_MODE=record the model records its calls to fixture files in INU_LLM_FIXTURE_DIR,
+// with INU_LLM_FIXTURE_MODE=replay the calls are served from the fixture files without network access.
 func CreateOpenAIChatModel(ctx context.Context) (model.BaseChatModel, error) {
+	mode, err := ParseFixtureMode(os.Getenv(FixtureModeEnv))
+	if err != nil {
+		return nil, eris.Wrapf(err, "invalid %s", FixtureModeEnv)
+	}
+
+	dir := os.Getenv(FixtureDirEnv)
+	if dir == "" {
+		dir = DefaultFixtureDir
+	}
+
+	if mode == FixtureReplay {
+		return NewReplayChatModel(dir), nil
+	}
+
 	key := os.Getenv("OPENAI_API_KEY")
 	modelName := os.Getenv("OPENAI_MODEL_NAME")
 	baseURL := os.Getenv("OPENAI_BASE_URL")
@@ -35,5 +51,12 @@ func CreateOpenAIChatModel(ctx context.Context) (model.BaseChatModel, error) {
 		Model:   modelName,
 		APIKey:  key,
 	})
-	return chatModel, eris.Wrap(err, "failed to create openai chat model")
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to create openai chat model")
+	}
+
+	if mode == FixtureRecord {
+		return NewRecordingChatModel(chatModel, dir), nil
+	}
+	return chatModel, nil
 }
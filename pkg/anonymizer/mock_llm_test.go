@@ -17,66 +17,34 @@
 package anonymizer
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 
-	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/schema"
-)
 
-// mockChatModel is a mock implementation of model.BaseChatModel for testing.
-// It allows configuring responses without making real LLM API calls.
-type mockChatModel struct {
-	response      *schema.Message // The mocked response to return
-	responseError error           // The error to return (if any)
-	streamTokens  []string        // Tokens to stream (for Stream() method)
-	streamError   error           // Error to return during streaming
-}
+	"github.com/mrlyc/inu/pkg/anonymizer/anonymizertest"
+)
 
-// Generate implements model.BaseChatModel.Generate for testing.
-func (m *mockChatModel) Generate(ctx context.Context, messages []*schema.Message, opts ...model.Option) (*schema.Message, error) {
-	if m.responseError != nil {
-		return nil, m.responseError
+// newMockChatModel creates a chat model that replies to successive Generate calls with responses.
+// Streaming is disabled, so that Anonymize falls back to Generate; use anonymizertest.NewChatModel
+// directly to test the streaming path.
+func newMockChatModel(responses ...*schema.Message) *anonymizertest.ChatModel {
+	scripted := make([]anonymizertest.Response, 0, len(responses))
+	for _, response := range responses {
+		scripted = append(scripted, anonymizertest.Response{Tokens: []string{response.Content}, ToolCalls: response.ToolCalls})
 	}
-	return m.response, nil
+	chatModel := anonymizertest.NewChatModel(scripted...)
+	chatModel.StreamDisabled = true
+	return chatModel
 }
 
-// BindTools implements model.BaseChatModel.BindTools (not used in tests).
-func (m *mockChatModel) BindTools(tools []*schema.ToolInfo) error {
-	return nil
-}
-
-// Stream implements model.BaseChatModel.Stream for testing.
-// Note: For now, this returns a minimal implementation. The streaming functionality
-// is tested indirectly through AnonymizeText which uses AnonymizeTextStream internally.
-func (m *mockChatModel) Stream(ctx context.Context, messages []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
-	if m.streamError != nil {
-		return nil, m.streamError
-	}
-	if len(m.streamTokens) == 0 {
-		// Fall back to using Generate response for backward compatibility
-		if m.response != nil {
-			// Simulate streaming by breaking response into tokens
-			tokens := []string{m.response.Content}
-			m.streamTokens = tokens
-		} else {
-			return nil, fmt.Errorf("stream not configured in mock")
-		}
+// lastRequest returns the messages of the last call to the chat model.
+func lastRequest(chatModel *anonymizertest.ChatModel) []*schema.Message {
+	requests := chatModel.Requests()
+	if len(requests) == 0 {
+		return nil
 	}
-
-	// Create a goroutine-based stream simulator
-	// This is a workaround since we can't directly construct schema.StreamReader
-	return m.createStreamReaderFromTokens(m.streamTokens)
-}
-
-// createStreamReaderFromTokens creates a StreamReader from a token slice
-// This is a helper to work around type system limitations in testing
-func (m *mockChatModel) createStreamReaderFromTokens(tokens []string) (*schema.StreamReader[*schema.Message], error) {
-	// For testing purposes, we'll need to use reflection or accept the limitation
-	// that we can't fully test streaming without actual LLM integration.
-	// Return an error for now to indicate streaming isn't fully mocked.
-	return nil, fmt.Errorf("stream mocking not yet implemented - use Generate() path for testing")
+	return requests[len(requests)-1]
 }
 
 // newMockAnonymizeResponse constructs a mock LLM response in the expected format:
@@ -92,16 +60,24 @@ func newMockAnonymizeResponse(anonymizedText string, mapping map[string][]string
 	}
 }
 
-// newMockErrorResponse creates a mock that returns an error.
-func newMockErrorResponse(err error) *mockChatModel {
-	return &mockChatModel{
-		responseError: err,
+// newMockToolCallResponse constructs a mock LLM response that calls the given tool with arguments.
+func newMockToolCallResponse(name, arguments string) *schema.Message {
+	return &schema.Message{
+		Role: schema.Assistant,
+		ToolCalls: []schema.ToolCall{
+			{ID: "call_0", Type: "function", Function: schema.FunctionCall{Name: name, Arguments: arguments}},
+		},
 	}
 }
 
-// newMockWithResponse creates a mock that returns a specific response.
-func newMockWithResponse(response *schema.Message) *mockChatModel {
-	return &mockChatModel{
-		response: response,
-	}
+// newMockErrorResponse creates a mock whose Generate call fails with err.
+func newMockErrorResponse(err error) *anonymizertest.ChatModel {
+	chatModel := anonymizertest.NewChatModel(anonymizertest.Response{Err: err})
+	chatModel.StreamDisabled = true
+	return chatModel
+}
+
+// newMockWithResponse creates a mock whose Generate call returns response.
+func newMockWithResponse(response *schema.Message) *anonymizertest.ChatModel {
+	return newMockChatModel(response)
 }
@@ -16,18 +16,51 @@
 
 package anonymizer
 
+import "fmt"
+
 // Entity represents a detected sensitive entity in the text.
 type Entity struct {
-	Key        string   `json:"key"`
-	EntityType string   `json:"type"`
-	ID         string   `json:"id"`
-	Category   string   `json:"category"`
-	Detail     string   `json:"detail"`
-	Values     []string `json:"values"`
+	Key        string   `json:"key" yaml:"key"`
+	EntityType string   `json:"type" yaml:"type"`
+	ID         string   `json:"id" yaml:"id"`
+	Category   string   `json:"category" yaml:"category"`
+	Detail     string   `json:"detail" yaml:"detail"`
+	Values     []string `json:"values" yaml:"values"`
+	// Pseudonym is the fake value replacing the entity in the anonymized text (see Pseudonymized);
+	// empty if the entity is replaced by its placeholder Key
+	Pseudonym string `json:"pseudonym,omitempty" yaml:"pseudonym,omitempty"`
+	// Spans are the occurrences of the entity, see ComputeSpans
+	Spans []Span `json:"spans,omitempty" yaml:"spans,omitempty"`
 }
 
-// DefaultEntityTypes are the default entity types used when none are specified
-var DefaultEntityTypes = []string{
-	"个人信息", "业务信息", "资产信息", "账户信息",
-	"位置数据", "文档名称", "组织机构", "岗位称谓",
+// ParseEntityKey parses a key in the format <EntityType[ID].Category.Detail> into an entity without values.
+func ParseEntityKey(key string) (*Entity, error) {
+	matches := entityKeyRegex.FindStringSubmatch(key)
+	if len(matches) != 5 || matches[0] != key {
+		return nil, fmt.Errorf("invalid key format: %s", key)
+	}
+
+	return &Entity{
+		Key:        key,
+		EntityType: matches[1],
+		ID:         matches[2],
+		Category:   matches[3],
+		Detail:     matches[4],
+	}, nil
 }
+
+// Span is one occurrence of an entity.
+// Offsets are in characters (Unicode code points), End is exclusive.
+type Span struct {
+	// Value is the original text replaced at this occurrence
+	Value string `json:"value" yaml:"value"`
+	// Start and End are the offsets of Value in the original text
+	Start int `json:"start" yaml:"start"`
+	End   int `json:"end" yaml:"end"`
+	// AnonymizedStart and AnonymizedEnd are the offsets of the placeholder in the anonymized text
+	AnonymizedStart int `json:"anonymized_start" yaml:"anonymized_start"`
+	AnonymizedEnd   int `json:"anonymized_end" yaml:"anonymized_end"`
+}
+
+// DefaultEntityTypes are the default entity types used when none are specified
+var DefaultEntityTypes = DefaultEntityTypeSchema.Names()
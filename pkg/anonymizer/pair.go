@@ -0,0 +1,83 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"strings"
+	"unicode"
+)
+
+// pairMarker separates the anonymized text from the JSON mapping in the LLM response.
+const pairMarker = "<<<PAIR>>>"
+
+// pairParser incrementally splits a streamed <<<PAIR>>> response.
+// Text before the marker is returned by feed as soon as it is known not to be part of the marker,
+// with leading and trailing whitespace removed like parseAnonymizeResponse does.
+// Everything after the marker is collected as the mapping.
+type pairParser struct {
+	// pending holds text that may still be a partial marker or trailing whitespace
+	pending strings.Builder
+	// started is set once non-whitespace text has been emitted
+	started bool
+	found   bool
+	mapping strings.Builder
+}
+
+// feed consumes the next chunk and returns the anonymized text that can be emitted.
+func (p *pairParser) feed(chunk string) string {
+	if p.found {
+		p.mapping.WriteString(chunk)
+		return ""
+	}
+
+	p.pending.WriteString(chunk)
+	buffered := p.pending.String()
+	p.pending.Reset()
+
+	if index := strings.Index(buffered, pairMarker); index >= 0 {
+		p.found = true
+		p.mapping.WriteString(buffered[index+len(pairMarker):])
+		return p.emit(strings.TrimRightFunc(buffered[:index], unicode.IsSpace))
+	}
+
+	// Hold back a suffix that may be the start of the marker, and trailing whitespace before it
+	held := partialMarkerLength(buffered)
+	safe := buffered[:len(buffered)-held]
+	trimmed := strings.TrimRightFunc(safe, unicode.IsSpace)
+	p.pending.WriteString(buffered[len(trimmed):])
+
+	return p.emit(trimmed)
+}
+
+// emit removes leading whitespace of the anonymized text.
+func (p *pairParser) emit(text string) string {
+	if !p.started {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		p.started = text != ""
+	}
+	return text
+}
+
+// partialMarkerLength returns the length of the longest suffix of s that is a proper prefix of the marker.
+func partialMarkerLength(s string) int {
+	for n := len(pairMarker) - 1; n > 0; n-- {
+		if strings.HasSuffix(s, pairMarker[:n]) {
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/mrlyc/inu/pkg/anonymizer/anonymizertest"
+)
+
+// TestPairParser_Splits tests that every token split yields the same text and mapping.
+func TestPairParser_Splits(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		text     string
+		mapping  string
+	}{
+		{
+			name:     "Marker on its own line",
+			response: "<个人信息[0].姓名.全名>来了\n<<<PAIR>>>\n{\"<个人信息[0].姓名.全名>\": [\"张三\"]}",
+			text:     "<个人信息[0].姓名.全名>来了",
+			mapping:  "{\"<个人信息[0].姓名.全名>\": [\"张三\"]}",
+		},
+		{
+			name:     "Marker shares a line with text and mapping",
+			response: "<个人信息[0].姓名.全名>来了<<<PAIR>>>{\"<个人信息[0].姓名.全名>\": [\"张三\"]}",
+			text:     "<个人信息[0].姓名.全名>来了",
+			mapping:  "{\"<个人信息[0].姓名.全名>\": [\"张三\"]}",
+		},
+		{
+			name:     "Text contains marker-like prefixes",
+			response: "  a << b <<<P c\n\n<<<PAIR>>>\n{}\n",
+			text:     "a << b <<<P c",
+			mapping:  "{}",
+		},
+		{
+			name:     "Multi-line text",
+			response: "第一行\n\n第二行 \n<<<PAIR>>>{}",
+			text:     "第一行\n\n第二行",
+			mapping:  "{}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for size := 1; size <= utf8.RuneCountInString(tt.response); size++ {
+				var parser pairParser
+				var text strings.Builder
+				for _, token := range anonymizertest.SplitTokens(tt.response, size) {
+					text.WriteString(parser.feed(token))
+				}
+
+				if !parser.found {
+					t.Fatalf("token size %d: marker not found", size)
+				}
+				if text.String() != tt.text {
+					t.Fatalf("token size %d: expected text %q, got %q", size, tt.text, text.String())
+				}
+				if strings.TrimSpace(parser.mapping.String()) != tt.mapping {
+					t.Fatalf("token size %d: expected mapping %q, got %q", size, tt.mapping, parser.mapping.String())
+				}
+			}
+		})
+	}
+}
+
+// TestPairParser_NeverFlushesPartialMarker tests that a partial marker is held back.
+func TestPairParser_NeverFlushesPartialMarker(t *testing.T) {
+	var parser pairParser
+	if output := parser.feed("text <<<PA"); output != "text" {
+		t.Errorf("expected %q, got %q", "text", output)
+	}
+	if output := parser.feed("IR>>>{}"); output != "" || !parser.found {
+		t.Errorf("expected marker to be found without output, got %q", output)
+	}
+}
+
+// TestAnonymize_StreamSplits tests that the stream path matches the Generate path for every token split.
+func TestAnonymize_StreamSplits(t *testing.T) {
+	response := "<个人信息[0].姓名.全名>在<组织机构[0].公司.全名>工作<<<PAIR>>>{\"<个人信息[0].姓名.全名>\": [\"张三\"], \"<组织机构[0].公司.全名>\": [\"ABC\"]}"
+	expected := "<个人信息[0].姓名.全名>在<组织机构[0].公司.全名>工作"
+
+	for size := 1; size <= utf8.RuneCountInString(response); size++ {
+		mockLLM := anonymizertest.NewChatModel(anonymizertest.Tokens(anonymizertest.SplitTokens(response, size)...))
+		anon, err := NewHashHidePair(mockLLM)
+		if err != nil {
+			t.Fatalf("Failed to create anonymizer: %v", err)
+		}
+
+		var buf bytes.Buffer
+		entities, err := anon.Anonymize(context.Background(), []string{"个人信息", "组织机构"}, "张三在ABC工作", &buf)
+		if err != nil {
+			t.Fatalf("token size %d: Anonymize failed: %v", size, err)
+		}
+		if buf.String() != expected {
+			t.Fatalf("token size %d: expected %q, got %q", size, expected, buf.String())
+		}
+		if len(entities) != 2 {
+			t.Fatalf("token size %d: expected 2 entities, got %d", size, len(entities))
+		}
+	}
+}
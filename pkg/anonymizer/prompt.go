@@ -0,0 +1,252 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cloudwego/eino/components/prompt"
+	"github.com/cloudwego/eino/schema"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	// PromptFormatFString formats templates like Python str.format: {text}
+	PromptFormatFString = "fstring"
+	// PromptFormatJinja2 formats templates with Jinja2: {{ text }}
+	PromptFormatJinja2 = "jinja2"
+)
+
+// requiredPromptVariables must occur in the system or user template.
+var requiredPromptVariables = []string{"types", "text"}
+
+// PromptExample 是一个 few-shot 示例：Text 按用户模板渲染为用户消息，Response 原样作为助手回复。
+// Response 必须遵循 <<<PAIR>>> 格式。
+type PromptExample struct {
+	Text     string `json:"text" yaml:"text" mapstructure:"text"`
+	Response string `json:"response" yaml:"response" mapstructure:"response"`
+}
+
+// PromptTemplate 是一种语言的脱敏提示词：可选的系统消息、用户消息模板和 few-shot 示例。
+// 模板可以使用变量 types (实体类型 JSON 数组)、definitions (实体类型定义，可能为空)、
+// terms (词条白名单和黑名单，可能为空) 和 text (待脱敏文本)，
+// 其中 types 和 text 是必需的。
+type PromptTemplate struct {
+	System   string          `json:"system,omitempty" yaml:"system,omitempty" mapstructure:"system"`
+	User     string          `json:"user" yaml:"user" mapstructure:"user"`
+	Examples []PromptExample `json:"examples,omitempty" yaml:"examples,omitempty" mapstructure:"examples"`
+}
+
+// PromptTemplateSet 是一组按语言区分的提示词模板，可以从文件加载 (见 cli.LoadPromptTemplateSet)。
+type PromptTemplateSet struct {
+	// Format 是模板语法：fstring (默认) 或 jinja2
+	Format string `json:"format,omitempty" yaml:"format,omitempty" mapstructure:"format"`
+	// Language 是未指定语言时使用的变体，只有一种语言时可以省略
+	Language string `json:"language" yaml:"language" mapstructure:"language"`
+	// Languages 按语言 (不区分大小写) 保存模板变体
+	Languages map[string]*PromptTemplate `json:"languages" yaml:"languages" mapstructure:"languages"`
+}
+
+// DefaultPromptTemplate is the built-in prompt of HasHidePair.
+var DefaultPromptTemplate = &PromptTemplate{
+	User: `Anonymize the text with the given entity types, then output the tag-to-original mapping; if nothing is found, reply "None".
+Specified types: {types}
+{definitions}{terms}<text>{text}</text>`,
+}
+
+// formatType returns the eino format type of the set.
+func (s *PromptTemplateSet) formatType() (schema.FormatType, error) {
+	switch strings.ToLower(s.Format) {
+	case "", PromptFormatFString:
+		return schema.FString, nil
+	case PromptFormatJinja2:
+		return schema.Jinja2, nil
+	}
+	return 0, fmt.Errorf("unknown prompt format: %s (supported: %s, %s)", s.Format, PromptFormatFString, PromptFormatJinja2)
+}
+
+// Validate checks that the format is known, the default language exists and every variant
+// renders with the required variables.
+func (s *PromptTemplateSet) Validate() error {
+	formatType, err := s.formatType()
+	if err != nil {
+		return err
+	}
+	if len(s.Languages) == 0 {
+		return fmt.Errorf("prompt template set must define at least one language")
+	}
+	if _, err := s.Select(""); err != nil {
+		return err
+	}
+
+	languages := make([]string, 0, len(s.Languages))
+	for language := range s.Languages {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+
+	for _, language := range languages {
+		if _, err := compilePrompt(s.Languages[language], formatType); err != nil {
+			return eris.Wrapf(err, "invalid prompt template for language %s", language)
+		}
+	}
+	return nil
+}
+
+// Select returns the template of language, or of the default language if language is empty.
+// A set with a single language does not need a default language.
+func (s *PromptTemplateSet) Select(language string) (*PromptTemplate, error) {
+	if language == "" {
+		language = s.Language
+	}
+	if language == "" && len(s.Languages) == 1 {
+		for _, template := range s.Languages {
+			if template != nil {
+				return template, nil
+			}
+		}
+	}
+	for name, template := range s.Languages {
+		if strings.EqualFold(name, language) && template != nil {
+			return template, nil
+		}
+	}
+
+	available := make([]string, 0, len(s.Languages))
+	for name := range s.Languages {
+		available = append(available, name)
+	}
+	sort.Strings(available)
+	return nil, fmt.Errorf("no prompt template for language %q (available: %s)", language, strings.Join(available, ", "))
+}
+
+// anonymizePrompt is a validated prompt template ready to format requests.
+type anonymizePrompt struct {
+	formatType schema.FormatType
+	template   *prompt.DefaultChatTemplate
+	user       *schema.Message
+	examples   []PromptExample
+}
+
+// compilePrompt checks the required variables and renders the template once with sample values,
+// so that syntax errors are reported at startup instead of on the first request.
+func compilePrompt(t *PromptTemplate, formatType schema.FormatType) (*anonymizePrompt, error) {
+	if strings.TrimSpace(t.User) == "" {
+		return nil, fmt.Errorf("user template must not be empty")
+	}
+	for _, name := range requiredPromptVariables {
+		if !usesVariable(t.System, name, formatType) && !usesVariable(t.User, name, formatType) {
+			return nil, fmt.Errorf("prompt template must use the variable %s", variableSyntax(name, formatType))
+		}
+	}
+	for i, example := range t.Examples {
+		if example.Text == "" || example.Response == "" {
+			return nil, fmt.Errorf("example %d must have a text and a response", i)
+		}
+	}
+
+	var templates []schema.MessagesTemplate
+	if t.System != "" {
+		templates = append(templates, schema.SystemMessage(t.System))
+	}
+	user := schema.UserMessage(t.User)
+	templates = append(templates, schema.MessagesPlaceholder("examples", true), user)
+
+	p := &anonymizePrompt{
+		formatType: formatType,
+		template:   prompt.FromMessages(formatType, templates...),
+		user:       user,
+		examples:   t.Examples,
+	}
+
+	if _, err := p.format(context.Background(), `["个人信息"]`, "", "", "sample"); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// format renders the messages for one request; the examples are rendered with the same types, definitions and terms.
+func (p *anonymizePrompt) format(ctx context.Context, types, definitions, terms, text string) ([]*schema.Message, error) {
+	examples := make([]*schema.Message, 0, 2*len(p.examples))
+	for _, example := range p.examples {
+		rendered, err := p.user.Format(ctx, map[string]any{
+			"types":       types,
+			"definitions": definitions,
+			"terms":       terms,
+			"text":        example.Text,
+		}, p.formatType)
+		if err != nil {
+			return nil, eris.Wrap(err, "failed to format example")
+		}
+		examples = append(examples, rendered...)
+		examples = append(examples, schema.AssistantMessage(example.Response, nil))
+	}
+
+	messages, err := p.template.Format(ctx, map[string]any{
+		"types":       types,
+		"definitions": definitions,
+		"terms":       terms,
+		"text":        text,
+		"examples":    examples,
+	})
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to format message")
+	}
+	return messages, nil
+}
+
+// usesVariable returns true if the template references the variable.
+func usesVariable(template, name string, formatType schema.FormatType) bool {
+	var pattern string
+	switch formatType {
+	case schema.Jinja2:
+		pattern = `\{\{-?\s*` + name + `\b`
+	default:
+		pattern = `(^|[^{])\{` + name + `(:[^}]*)?\}`
+	}
+	return regexp.MustCompile(pattern).MatchString(template)
+}
+
+// variableSyntax returns how the variable is written in the format.
+func variableSyntax(name string, formatType schema.FormatType) string {
+	if formatType == schema.Jinja2 {
+		return "{{ " + name + " }}"
+	}
+	return "{" + name + "}"
+}
+
+// WithPromptTemplate replaces the built-in prompt with the template of language from set
+// (the default language of the set if empty). The set is validated by NewHashHidePair.
+func WithPromptTemplate(set *PromptTemplateSet, language string) Option {
+	return func(h *HasHidePair) {
+		h.promptSet = set
+		h.promptLanguage = language
+	}
+}
+
+// defaultPromptSet wraps DefaultPromptTemplate.
+func defaultPromptSet() *PromptTemplateSet {
+	return &PromptTemplateSet{
+		Format:    PromptFormatFString,
+		Language:  "default",
+		Languages: map[string]*PromptTemplate{"default": DefaultPromptTemplate},
+	}
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/mrlyc/inu/pkg/anonymizer/anonymizertest"
+)
+
+func TestPromptTemplateSet_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     *PromptTemplateSet
+		wantErr string
+	}{
+		{
+			name: "fstring template",
+			set: &PromptTemplateSet{Languages: map[string]*PromptTemplate{
+				"en": {System: "Types: {types}", User: "<text>{text}</text>"},
+			}},
+		},
+		{
+			name: "jinja2 template",
+			set: &PromptTemplateSet{Format: "jinja2", Languages: map[string]*PromptTemplate{
+				"en": {User: "{{ types }}{% if definitions %}{{ definitions }}{% endif %}<text>{{- text }}</text>"},
+			}},
+		},
+		{
+			name: "missing text variable",
+			set: &PromptTemplateSet{Languages: map[string]*PromptTemplate{
+				"en": {User: "Types: {types}"},
+			}},
+			wantErr: "{text}",
+		},
+		{
+			name: "escaped braces are not a variable",
+			set: &PromptTemplateSet{Languages: map[string]*PromptTemplate{
+				"en": {User: "{{types}} {text}"},
+			}},
+			wantErr: "{types}",
+		},
+		{
+			name: "jinja2 variable in fstring syntax",
+			set: &PromptTemplateSet{Format: "jinja2", Languages: map[string]*PromptTemplate{
+				"en": {User: "{types} {text}"},
+			}},
+			wantErr: "{{ types }}",
+		},
+		{
+			name: "unknown variable",
+			set: &PromptTemplateSet{Languages: map[string]*PromptTemplate{
+				"en": {User: "{types} {text} {language}"},
+			}},
+			wantErr: "invalid prompt template for language en",
+		},
+		{
+			name: "unknown format",
+			set: &PromptTemplateSet{Format: "mustache", Languages: map[string]*PromptTemplate{
+				"en": {User: "{types} {text}"},
+			}},
+			wantErr: "unknown prompt format",
+		},
+		{
+			name: "missing default language",
+			set: &PromptTemplateSet{Language: "fr", Languages: map[string]*PromptTemplate{
+				"en": {User: "{types} {text}"},
+				"zh": {User: "{types} {text}"},
+			}},
+			wantErr: `no prompt template for language "fr"`,
+		},
+		{
+			name: "example without response",
+			set: &PromptTemplateSet{Languages: map[string]*PromptTemplate{
+				"en": {User: "{types} {text}", Examples: []PromptExample{{Text: "张三"}}},
+			}},
+			wantErr: "example 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.set.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPromptTemplateSet_Select(t *testing.T) {
+	en := &PromptTemplate{User: "en {types} {text}"}
+	zh := &PromptTemplate{User: "zh {types} {text}"}
+	set := &PromptTemplateSet{Language: "en", Languages: map[string]*PromptTemplate{"en": en, "zh-cn": zh}}
+
+	if got, err := set.Select(""); err != nil || got != en {
+		t.Errorf("expected the default language, got %v, %v", got, err)
+	}
+	if got, err := set.Select("zh-CN"); err != nil || got != zh {
+		t.Errorf("expected a case-insensitive match, got %v, %v", got, err)
+	}
+	if _, err := set.Select("fr"); err == nil {
+		t.Error("expected an error for an unknown language")
+	}
+
+	single := &PromptTemplateSet{Languages: map[string]*PromptTemplate{"zh": zh}}
+	if got, err := single.Select(""); err != nil || got != zh {
+		t.Errorf("expected the only language, got %v, %v", got, err)
+	}
+}
+
+func TestAnonymize_PromptTemplate(t *testing.T) {
+	set := &PromptTemplateSet{
+		Format:   PromptFormatJinja2,
+		Language: "en",
+		Languages: map[string]*PromptTemplate{
+			"en": {User: "unused {{ types }} {{ text }}"},
+			"zh": {
+				System: "你是脱敏助手，实体类型：{{ types }}",
+				User:   "<text>{{ text }}</text>",
+				Examples: []PromptExample{{
+					Text:     "李四来了",
+					Response: "<个人信息[0].姓名.全名>来了\n<<<PAIR>>>\n{\"<个人信息[0].姓名.全名>\": [\"李四\"]}",
+				}},
+			},
+		},
+	}
+
+	chatModel := anonymizertest.NewChatModel(anonymizertest.Tokens("None"))
+	anon, err := NewHashHidePair(chatModel, WithPromptTemplate(set, "zh"), WithEntityTypeSchema(nil))
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	if _, err := anon.Anonymize(context.Background(), []string{"个人信息"}, "张三来了", io.Discard); err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+
+	messages := chatModel.Requests()[0]
+	expected := []struct {
+		role    schema.RoleType
+		content string
+	}{
+		{schema.System, `你是脱敏助手，实体类型：["个人信息"]`},
+		{schema.User, "<text>李四来了</text>"},
+		{schema.Assistant, set.Languages["zh"].Examples[0].Response},
+		{schema.User, "<text>张三来了</text>"},
+	}
+	if len(messages) != len(expected) {
+		t.Fatalf("expected %d messages, got %d: %v", len(expected), len(messages), messages)
+	}
+	for i, message := range messages {
+		if message.Role != expected[i].role || message.Content != expected[i].content {
+			t.Errorf("message %d: expected %s %q, got %s %q", i, expected[i].role, expected[i].content, message.Role, message.Content)
+		}
+	}
+}
+
+func TestNewHashHidePair_InvalidPromptTemplate(t *testing.T) {
+	set := &PromptTemplateSet{Languages: map[string]*PromptTemplate{"en": {User: "{text}"}}}
+
+	if _, err := NewHashHidePair(anonymizertest.NewChatModel(), WithPromptTemplate(set, "")); err == nil {
+		t.Error("expected an error for a template without {types}")
+	}
+
+	valid := &PromptTemplateSet{Languages: map[string]*PromptTemplate{"en": {User: "{types} {text}"}}}
+	if _, err := NewHashHidePair(anonymizertest.NewChatModel(), WithPromptTemplate(valid, "de")); err == nil {
+		t.Error("expected an error for an unknown language")
+	}
+}
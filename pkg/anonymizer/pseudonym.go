@@ -0,0 +1,462 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rotisserie/eris"
+)
+
+// ReplacementStrategy 决定脱敏文本中实体被替换成的形式。
+type ReplacementStrategy string
+
+const (
+	// ReplacePlaceholder 使用 <EntityType[ID].Category.Detail> 格式的占位符
+	ReplacePlaceholder ReplacementStrategy = "placeholder"
+	// ReplacePseudonym 使用保留格式的假值 (假名、格式合法的电话、example 域名的邮箱等)
+	ReplacePseudonym ReplacementStrategy = "pseudonym"
+)
+
+// ParseReplacementStrategy parses a strategy name; an empty name is ReplacePlaceholder.
+func ParseReplacementStrategy(name string) (ReplacementStrategy, error) {
+	switch strategy := ReplacementStrategy(name); strategy {
+	case "":
+		return ReplacePlaceholder, nil
+	case ReplacePlaceholder, ReplacePseudonym:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown replacement strategy: %s (supported: %s, %s)", name, ReplacePlaceholder, ReplacePseudonym)
+}
+
+// maxPseudonymAttempts is the number of candidates generated for an entity before falling back to its placeholder.
+const maxPseudonymAttempts = 20
+
+// minPseudonymRunes is the minimum length of a pseudonym. Pseudonyms are restored wherever they occur,
+// so a single character such as a surname would also be replaced inside unrelated words.
+const minPseudonymRunes = 2
+
+var (
+	emailShape    = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	mobileShape   = regexp.MustCompile(`^(\+?86[ -]?)?1[3-9]\d[ -]?\d{4}[ -]?\d{4}$`)
+	urlShape      = regexp.MustCompile(`(?i)^(https?://|www\.)`)
+	bankCardShape = regexp.MustCompile(`^\d[\d -]{11,}\d$`)
+)
+
+var (
+	pseudonymSurnames      = []rune("王李张刘陈杨黄赵吴周徐孙马朱胡郭何高林罗")
+	pseudonymGivenNames    = []rune("伟芳娜敏静丽强磊军洋勇艳杰娟涛明超秀霞平刚桂")
+	pseudonymHanCharacters = []rune("安柏辰达峰和华嘉景凯澜朗宁启瑞森泰文信雅远云泽志")
+	pseudonymFirstNames    = []string{"Alex", "Jamie", "Taylor", "Jordan", "Morgan", "Casey", "Riley", "Avery"}
+	pseudonymLastNames     = []string{"Smith", "Johnson", "Brown", "Miller", "Davis", "Wilson", "Moore", "Clark"}
+	pseudonymPhonePrefixes = []string{"130", "131", "132", "135", "136", "137", "150", "151", "152", "186", "187", "188"}
+	pseudonymEmailDomains  = []string{"example.com", "example.org", "example.net"}
+	pseudonymIDRegions     = []string{"110101", "310104", "440305", "330106", "510107"}
+	// pseudonymKeptSuffixes are kept by generic pseudonyms so that the value still reads like an organization,
+	// a project or a system; longer suffixes first
+	pseudonymKeptSuffixes = []string{"股份有限公司", "科技有限公司", "有限公司", "公司", "集团", "科技", "中心", "计划", "项目", "系统", "平台", "医院", "银行", "大学", "部", "组"}
+)
+
+// Pseudonymized 是把占位符替换为假值的 Anonymizer 包装。
+// 内部 Anonymizer 完成后，每个实体生成一个保留原值格式的假值 (记录在 Entity.Pseudonym 中)，
+// 脱敏文本中该实体的占位符全部替换为这个假值。假值不会出现在原文中，也不会互相包含，
+// 因此还原时按假值精确匹配即可 (见 Restore)。无法生成合适假值的实体保留占位符。
+// 替换需要完整的实体映射，因此输出会在内部 Anonymizer 完成后一次性写入 writer。
+type Pseudonymized struct {
+	inner Anonymizer
+	mu    sync.Mutex
+	rng   *rand.Rand
+}
+
+// Anonymize anonymizes the text with the wrapped Anonymizer and replaces the placeholders with pseudonyms.
+func (p *Pseudonymized) Anonymize(ctx context.Context, types []string, text string, writer io.Writer) ([]*Entity, error) {
+	var output bytes.Buffer
+	entities, err := p.inner.Anonymize(ctx, types, text, &output)
+	if err != nil {
+		return nil, err
+	}
+
+	anonymized, entities := p.pseudonymize(text, output.String(), entities)
+	if _, err := io.WriteString(writer, anonymized); err != nil {
+		return nil, eris.Wrap(err, "failed to write to output")
+	}
+
+	return entities, nil
+}
+
+// RestoreText restores pseudonyms and placeholders with the wrapped Anonymizer.
+func (p *Pseudonymized) RestoreText(ctx context.Context, entities []*Entity, text string, writer io.Writer) ([]RestoreFailure, error) {
+	return p.inner.RestoreText(ctx, entities, text, writer)
+}
+
+// pseudonymize assigns a pseudonym to every entity and replaces its placeholders in the anonymized text.
+// The given entities are not modified.
+func (p *Pseudonymized) pseudonymize(original, anonymized string, entities []*Entity) (string, []*Entity) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	generator := &pseudonymGenerator{rng: p.rng, texts: []string{original, anonymized}}
+	result := make([]*Entity, 0, len(entities))
+	for _, entity := range entities {
+		copied := *entity
+		result = append(result, &copied)
+		if copied.Pseudonym != "" {
+			generator.used = append(generator.used, copied.Pseudonym)
+		}
+	}
+
+	pseudonyms := make(map[string]string, len(result))
+	for _, entity := range result {
+		if entity.Pseudonym == "" && len(entity.Values) > 0 {
+			entity.Pseudonym = generator.generate(entity)
+		}
+		if entity.Pseudonym != "" {
+			pseudonyms[normalizePlaceholder(entity.Key)] = entity.Pseudonym
+		}
+	}
+
+	text := placeholderRegex.ReplaceAllStringFunc(anonymized, func(placeholder string) string {
+		if pseudonym, ok := pseudonyms[normalizePlaceholder(placeholder)]; ok {
+			return pseudonym
+		}
+		return placeholder
+	})
+	return text, result
+}
+
+// NewPseudonymized 创建一个把占位符替换为假值的 Anonymizer 包装。
+// seed 相同时生成相同的假值，为 0 时使用随机种子。
+func NewPseudonymized(inner Anonymizer, seed int64) (Anonymizer, error) {
+	if inner == nil {
+		return nil, fmt.Errorf("inner anonymizer must not be nil")
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	return &Pseudonymized{inner: inner, rng: rand.New(rand.NewSource(seed))}, nil
+}
+
+// pseudonymGenerator generates pseudonyms that occur in none of the texts and do not overlap each other.
+type pseudonymGenerator struct {
+	rng   *rand.Rand
+	texts []string
+	used  []string
+}
+
+// generate returns a pseudonym for the entity, or "" if no suitable one was found.
+func (g *pseudonymGenerator) generate(entity *Entity) string {
+	value := strings.TrimSpace(entity.Values[0])
+	// A Chinese surname would only be replaced by a single character, shorter than minPseudonymRunes
+	if entity.Detail == "姓氏" && containsHan(value) {
+		return ""
+	}
+	for i := 0; i < maxPseudonymAttempts; i++ {
+		candidate := g.fake(entity, value)
+		if g.available(candidate) {
+			g.used = append(g.used, candidate)
+			return candidate
+		}
+	}
+	return ""
+}
+
+// available returns true if the candidate can be restored unambiguously.
+func (g *pseudonymGenerator) available(candidate string) bool {
+	if utf8.RuneCountInString(strings.TrimSpace(candidate)) < minPseudonymRunes || strings.ContainsAny(candidate, "<>") {
+		return false
+	}
+	for _, text := range g.texts {
+		if strings.Contains(text, candidate) {
+			return false
+		}
+	}
+	for _, used := range g.used {
+		if strings.Contains(used, candidate) || strings.Contains(candidate, used) {
+			return false
+		}
+	}
+	return true
+}
+
+// fake generates a value with the format of value.
+func (g *pseudonymGenerator) fake(entity *Entity, value string) string {
+	switch {
+	case emailShape.MatchString(value):
+		return g.fakeEmail()
+	case isValidChineseIDCard(value):
+		return g.fakeChineseID()
+	case mobileShape.MatchString(value):
+		return g.fakeMobile(value)
+	case isValidIPv4(value):
+		return fmt.Sprintf("192.0.2.%d", 1+g.rng.Intn(254))
+	case isValidIPv6(value):
+		return fmt.Sprintf("2001:db8::%x", 1+g.rng.Intn(0xfffe))
+	case urlShape.MatchString(value):
+		return "https://www.example.com/" + g.letters(6, false)
+	case bankCardShape.MatchString(value) && isValidBankCard(value):
+		return g.fakeBankCard(value)
+	case strings.Contains(entity.Category, "姓名"):
+		return g.fakeName(value)
+	}
+	return g.fakeText(value)
+}
+
+// fakeEmail returns an address on a domain reserved for examples.
+func (g *pseudonymGenerator) fakeEmail() string {
+	first := strings.ToLower(g.pick(pseudonymFirstNames))
+	last := strings.ToLower(g.pick(pseudonymLastNames))
+	return fmt.Sprintf("%s.%s%02d@%s", first, last, g.rng.Intn(100), g.pick(pseudonymEmailDomains))
+}
+
+// fakeChineseID returns an ID card number with a valid check code.
+func (g *pseudonymGenerator) fakeChineseID() string {
+	birth := time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, g.rng.Intn(40*365))
+	id := fmt.Sprintf("%s%s%03d", g.pick(pseudonymIDRegions), birth.Format("20060102"), g.rng.Intn(1000))
+	return id + string(chineseIDCheckCode(id))
+}
+
+// fakeMobile returns a mobile number with the separators and country code of value.
+func (g *pseudonymGenerator) fakeMobile(value string) string {
+	digits := g.pick(pseudonymPhonePrefixes) + g.digits(8)
+	return replaceTrailingDigits(value, digits)
+}
+
+// fakeBankCard returns a card number with the length and separators of value and a valid Luhn check digit.
+func (g *pseudonymGenerator) fakeBankCard(value string) string {
+	count := 0
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			count++
+		}
+	}
+	digits := "6" + g.digits(count-2)
+	return replaceTrailingDigits(value, digits+string(luhnCheckDigit(digits)))
+}
+
+// fakeName returns a name in the script of value: a Chinese name of the same length
+// or English first and last names.
+func (g *pseudonymGenerator) fakeName(value string) string {
+	if !containsHan(value) {
+		if len(strings.Fields(value)) <= 1 {
+			return g.pick(pseudonymFirstNames)
+		}
+		return g.pick(pseudonymFirstNames) + " " + g.pick(pseudonymLastNames)
+	}
+
+	surname := string(pseudonymSurnames[g.rng.Intn(len(pseudonymSurnames))])
+	given := utf8.RuneCountInString(value) - 1
+	if given < 1 {
+		given = 1
+	} else if given > 2 {
+		given = 2
+	}
+	var builder strings.Builder
+	builder.WriteString(surname)
+	for i := 0; i < given; i++ {
+		builder.WriteRune(pseudonymGivenNames[g.rng.Intn(len(pseudonymGivenNames))])
+	}
+	return builder.String()
+}
+
+// fakeText replaces every digit, ASCII letter and Chinese character of value with a random one of
+// the same kind, keeping a known suffix such as 有限公司 and all other characters.
+func (g *pseudonymGenerator) fakeText(value string) string {
+	suffix := ""
+	for _, candidate := range pseudonymKeptSuffixes {
+		if strings.HasSuffix(value, candidate) && len(value) > len(candidate) {
+			suffix = candidate
+			break
+		}
+	}
+
+	var builder strings.Builder
+	for _, r := range strings.TrimSuffix(value, suffix) {
+		switch {
+		case r >= '0' && r <= '9':
+			builder.WriteByte(byte('0' + g.rng.Intn(10)))
+		case r >= 'a' && r <= 'z':
+			builder.WriteString(g.letters(1, false))
+		case r >= 'A' && r <= 'Z':
+			builder.WriteString(g.letters(1, true))
+		case unicode.Is(unicode.Han, r):
+			builder.WriteRune(pseudonymHanCharacters[g.rng.Intn(len(pseudonymHanCharacters))])
+		default:
+			builder.WriteRune(r)
+		}
+	}
+	builder.WriteString(suffix)
+	return builder.String()
+}
+
+func (g *pseudonymGenerator) pick(values []string) string {
+	return values[g.rng.Intn(len(values))]
+}
+
+func (g *pseudonymGenerator) digits(n int) string {
+	var builder strings.Builder
+	for i := 0; i < n; i++ {
+		builder.WriteByte(byte('0' + g.rng.Intn(10)))
+	}
+	return builder.String()
+}
+
+func (g *pseudonymGenerator) letters(n int, upper bool) string {
+	base := byte('a')
+	if upper {
+		base = 'A'
+	}
+	var builder strings.Builder
+	for i := 0; i < n; i++ {
+		builder.WriteByte(base + byte(g.rng.Intn(26)))
+	}
+	return builder.String()
+}
+
+// replaceTrailingDigits replaces the last len(digits) digits of value with digits, keeping all other characters.
+func replaceTrailingDigits(value, digits string) string {
+	result := []byte(value)
+	j := len(digits) - 1
+	for i := len(result) - 1; i >= 0 && j >= 0; i-- {
+		if result[i] >= '0' && result[i] <= '9' {
+			result[i] = digits[j]
+			j--
+		}
+	}
+	return string(result)
+}
+
+// luhnCheckDigit returns the digit that makes digits followed by it pass the Luhn checksum.
+func luhnCheckDigit(digits string) byte {
+	for d := byte('0'); d <= '9'; d++ {
+		if luhnValid(digits + string(d)) {
+			return d
+		}
+	}
+	return '0'
+}
+
+func containsHan(value string) bool {
+	for _, r := range value {
+		if unicode.Is(unicode.Han, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// entityMark is a placeholder or a pseudonym found in an anonymized text.
+type entityMark struct {
+	start, end int
+	// placeholder is the placeholder text, or the entity key of a pseudonym
+	placeholder string
+}
+
+// findEntityMarks returns the placeholders and the pseudonyms of entities in text, in order.
+// Pseudonyms are matched exactly, the longest first; text inside placeholders is not searched.
+func findEntityMarks(text string, entities []*Entity) []entityMark {
+	matcher := newPseudonymMatcher(entities)
+
+	var marks []entityMark
+	lastIndex := 0
+	for _, match := range placeholderRegex.FindAllStringIndex(text, -1) {
+		marks = append(marks, matcher.find(text, lastIndex, match[0])...)
+		marks = append(marks, entityMark{start: match[0], end: match[1], placeholder: text[match[0]:match[1]]})
+		lastIndex = match[1]
+	}
+	return append(marks, matcher.find(text, lastIndex, len(text))...)
+}
+
+// pseudonymMatcher finds the pseudonyms of entities.
+type pseudonymMatcher struct {
+	// pseudonyms are sorted longest first
+	pseudonyms []string
+	keys       map[string]string
+}
+
+// newPseudonymMatcher returns a matcher for the pseudonyms of entities, nil if no entity has one.
+func newPseudonymMatcher(entities []*Entity) *pseudonymMatcher {
+	m := &pseudonymMatcher{keys: make(map[string]string)}
+	for _, entity := range entities {
+		if entity.Pseudonym == "" {
+			continue
+		}
+		if _, ok := m.keys[entity.Pseudonym]; !ok {
+			m.pseudonyms = append(m.pseudonyms, entity.Pseudonym)
+		}
+		m.keys[entity.Pseudonym] = entity.Key
+	}
+	if len(m.pseudonyms) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(m.pseudonyms, func(i, j int) bool {
+		return len(m.pseudonyms[i]) > len(m.pseudonyms[j])
+	})
+	return m
+}
+
+// match returns the longest pseudonym text starts with, "" if none.
+func (m *pseudonymMatcher) match(text []byte) string {
+	for _, pseudonym := range m.pseudonyms {
+		if bytes.HasPrefix(text, []byte(pseudonym)) {
+			return pseudonym
+		}
+	}
+	return ""
+}
+
+// isPartial returns true if text is a proper prefix of a pseudonym.
+func (m *pseudonymMatcher) isPartial(text []byte) bool {
+	for _, pseudonym := range m.pseudonyms {
+		if len(text) < len(pseudonym) && bytes.HasPrefix([]byte(pseudonym), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// find returns the pseudonyms in text[start:end].
+func (m *pseudonymMatcher) find(text string, start, end int) []entityMark {
+	if m == nil {
+		return nil
+	}
+
+	var marks []entityMark
+	segment := []byte(text[:end])
+	for i := start; i < end; {
+		if pseudonym := m.match(segment[i:]); pseudonym != "" {
+			marks = append(marks, entityMark{start: i, end: i + len(pseudonym), placeholder: m.keys[pseudonym]})
+			i += len(pseudonym)
+			continue
+		}
+		_, size := utf8.DecodeRune(segment[i:])
+		i += size
+	}
+	return marks
+}
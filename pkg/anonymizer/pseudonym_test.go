@@ -0,0 +1,241 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/mrlyc/inu/pkg/anonymizer/anonymizertest"
+)
+
+func newTestPseudonymized(t *testing.T, inner Anonymizer, seed int64) Anonymizer {
+	t.Helper()
+
+	anon, err := NewPseudonymized(inner, seed)
+	if err != nil {
+		t.Fatalf("Failed to create pseudonymized anonymizer: %v", err)
+	}
+	return anon
+}
+
+func TestPseudonymized_StructuredValues(t *testing.T) {
+	ctx := context.Background()
+	rules, err := NewRuleBased(nil)
+	if err != nil {
+		t.Fatalf("Failed to create rule-based anonymizer: %v", err)
+	}
+	anon := newTestPseudonymized(t, rules, 1)
+
+	text := "电话 +86 13800138000，邮箱 zhangsan@corp.cn，身份证 11010519491231002X，服务器 10.0.0.8"
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(ctx, DefaultEntityTypes, text, &buf)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+	anonymized := buf.String()
+
+	if placeholderRegex.MatchString(anonymized) {
+		t.Errorf("expected no placeholders, got %q", anonymized)
+	}
+	byCategory := make(map[string]string)
+	for _, entity := range entities {
+		if entity.Pseudonym == "" {
+			t.Fatalf("expected a pseudonym for %s", entity.Key)
+		}
+		if strings.Contains(anonymized, entity.Values[0]) {
+			t.Errorf("original value %q left in %q", entity.Values[0], anonymized)
+		}
+		byCategory[entity.Category] = entity.Pseudonym
+	}
+
+	if phone := byCategory["电话"]; !regexp.MustCompile(`^\+86 1[3-9]\d{9}$`).MatchString(phone) {
+		t.Errorf("expected a phone number in the original format, got %q", phone)
+	}
+	if email := byCategory["邮箱"]; !regexp.MustCompile(`@example\.(com|org|net)$`).MatchString(email) {
+		t.Errorf("expected an email on an example domain, got %q", email)
+	}
+	if id := byCategory["身份证"]; !isValidChineseIDCard(id) {
+		t.Errorf("expected a valid ID card number, got %q", id)
+	}
+	if ip := byCategory["IP"]; !strings.HasPrefix(ip, "192.0.2.") {
+		t.Errorf("expected a documentation IP address, got %q", ip)
+	}
+
+	// Post-processing works on pseudonyms like on placeholders
+	if _, issues := ValidateEntities(text, anonymized, entities); len(issues) != 0 {
+		t.Errorf("expected no validation issues, got %v", issues)
+	}
+	ComputeSpans(text, anonymized, entities)
+	for _, entity := range entities {
+		if len(entity.Spans) != 1 {
+			t.Errorf("expected one span for %s, got %+v", entity.Key, entity.Spans)
+		}
+	}
+
+	var restored bytes.Buffer
+	failures, err := anon.RestoreText(ctx, entities, anonymized, &restored)
+	if err != nil {
+		t.Fatalf("RestoreText failed: %v", err)
+	}
+	if len(failures) != 0 || restored.String() != text {
+		t.Errorf("expected %q, got %q (failures: %v)", text, restored.String(), failures)
+	}
+}
+
+func TestPseudonymized_Names(t *testing.T) {
+	chatModel := anonymizertest.NewChatModel(anonymizertest.PairResponse(
+		"<个人信息[0].姓名.全名>和 <个人信息[1].姓名.全名> 讨论了<业务信息[0].项目.名称>，<个人信息[0].姓名.全名>负责",
+		map[string][]string{
+			"<个人信息[0].姓名.全名>": {"张三丰"},
+			"<个人信息[1].姓名.全名>": {"John Smith"},
+			"<业务信息[0].项目.名称>": {"星火计划"},
+		},
+		3,
+	))
+	llm, err := NewHashHidePair(chatModel)
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+	anon := newTestPseudonymized(t, llm, 1)
+
+	text := "张三丰和 John Smith 讨论了星火计划，张三丰负责"
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(context.Background(), []string{"个人信息", "业务信息"}, text, &buf)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+
+	pseudonyms := make(map[string]string)
+	for _, entity := range entities {
+		pseudonyms[entity.Key] = entity.Pseudonym
+	}
+	if name := pseudonyms["<个人信息[0].姓名.全名>"]; utf8.RuneCountInString(name) != 3 || !containsHan(name) {
+		t.Errorf("expected a three character Chinese name, got %q", name)
+	}
+	if name := pseudonyms["<个人信息[1].姓名.全名>"]; len(strings.Fields(name)) != 2 || containsHan(name) {
+		t.Errorf("expected an English first and last name, got %q", name)
+	}
+	if project := pseudonyms["<业务信息[0].项目.名称>"]; !strings.HasSuffix(project, "计划") || project == "星火计划" {
+		t.Errorf("expected a fake project name keeping its suffix, got %q", project)
+	}
+	if strings.Count(buf.String(), pseudonyms["<个人信息[0].姓名.全名>"]) != 2 {
+		t.Errorf("expected every occurrence to use the same pseudonym, got %q", buf.String())
+	}
+
+	// Streaming restoration with pseudonyms split across writes
+	var restored bytes.Buffer
+	writer := NewRestoreWriter(&restored, entities, DefaultRestorePolicy)
+	for _, token := range anonymizertest.SplitTokens(buf.String(), 1) {
+		if _, err := writer.Write([]byte(token)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if restored.String() != text {
+		t.Errorf("expected %q, got %q", text, restored.String())
+	}
+}
+
+func TestPseudonymized_SingleCharacterFallsBack(t *testing.T) {
+	chatModel := anonymizertest.NewChatModel(anonymizertest.PairResponse(
+		"<个人信息[0].姓名.姓氏>先生和<个人信息[1].姓名.全名>",
+		map[string][]string{
+			"<个人信息[0].姓名.姓氏>": {"赵"},
+			"<个人信息[1].姓名.全名>": {"钱多多"},
+		},
+		3,
+	))
+	llm, err := NewHashHidePair(chatModel)
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+	anon := newTestPseudonymized(t, llm, 1)
+
+	text := "赵先生和钱多多"
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(context.Background(), []string{"个人信息"}, text, &buf)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+
+	for _, entity := range entities {
+		if entity.Detail == "姓氏" && entity.Pseudonym != "" {
+			t.Errorf("expected the surname to keep its placeholder, got pseudonym %q", entity.Pseudonym)
+		}
+	}
+	if !strings.HasPrefix(buf.String(), "<个人信息[0].姓名.姓氏>先生和") {
+		t.Errorf("expected the surname placeholder in %q", buf.String())
+	}
+
+	// Surname characters elsewhere in a later reply are left alone
+	var surnames strings.Builder
+	for _, surname := range pseudonymSurnames {
+		surnames.WriteString(string(surname) + "国")
+	}
+	var restored bytes.Buffer
+	if _, err := anon.RestoreText(context.Background(), entities, buf.String()+"，"+surnames.String(), &restored); err != nil {
+		t.Fatalf("RestoreText failed: %v", err)
+	}
+	if expected := text + "，" + surnames.String(); restored.String() != expected {
+		t.Errorf("expected %q, got %q", expected, restored.String())
+	}
+}
+
+func TestPseudonymized_Reproducible(t *testing.T) {
+	rules, err := NewRuleBased(nil)
+	if err != nil {
+		t.Fatalf("Failed to create rule-based anonymizer: %v", err)
+	}
+
+	text := "联系 13800138000 或 zhangsan@corp.cn"
+	var outputs []string
+	for i := 0; i < 2; i++ {
+		var buf bytes.Buffer
+		if _, err := newTestPseudonymized(t, rules, 42).Anonymize(context.Background(), DefaultEntityTypes, text, &buf); err != nil {
+			t.Fatalf("Anonymize failed: %v", err)
+		}
+		outputs = append(outputs, buf.String())
+	}
+
+	if outputs[0] != outputs[1] {
+		t.Errorf("expected identical output for the same seed, got %q and %q", outputs[0], outputs[1])
+	}
+}
+
+func TestParseReplacementStrategy(t *testing.T) {
+	for name, expected := range map[string]ReplacementStrategy{
+		"":            ReplacePlaceholder,
+		"placeholder": ReplacePlaceholder,
+		"pseudonym":   ReplacePseudonym,
+	} {
+		strategy, err := ParseReplacementStrategy(name)
+		if err != nil || strategy != expected {
+			t.Errorf("ParseReplacementStrategy(%q) = %q, %v", name, strategy, err)
+		}
+	}
+
+	if _, err := ParseReplacementStrategy("fake"); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+}
@@ -0,0 +1,292 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/rotisserie/eris"
+)
+
+// RestorePolicy 决定多值实体 (一个占位符对应多个原始值) 的还原方式。
+type RestorePolicy string
+
+const (
+	// RestoreFirst 总是使用实体的第一个值还原
+	RestoreFirst RestorePolicy = "first"
+	// RestoreOrdered 按出现顺序还原：占位符的第 k 次出现还原为 Spans[k] 记录的原始写法，
+	// 没有对应 span 时使用第一个值
+	RestoreOrdered RestorePolicy = "ordered"
+)
+
+// DefaultRestorePolicy is the policy used by the RestoreText methods.
+const DefaultRestorePolicy = RestoreOrdered
+
+// ParseRestorePolicy parses a policy name.
+func ParseRestorePolicy(name string) (RestorePolicy, error) {
+	switch policy := RestorePolicy(name); policy {
+	case RestoreFirst, RestoreOrdered:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown restore policy: %s (supported: %s, %s)", name, RestoreFirst, RestoreOrdered)
+}
+
+// restoreEntry holds the values used to restore one placeholder.
+type restoreEntry struct {
+	first       string
+	occurrences []string
+	next        int
+}
+
+// value returns the value for the next occurrence of the placeholder.
+func (e *restoreEntry) value(policy RestorePolicy) string {
+	if policy != RestoreOrdered || e.next >= len(e.occurrences) {
+		return e.first
+	}
+	value := e.occurrences[e.next]
+	e.next++
+	return value
+}
+
+// restorer maps placeholders to entity values and records the placeholders that cannot be restored.
+type restorer struct {
+	policy    RestorePolicy
+	entries   map[string]*restoreEntry
+	emptyKeys map[string]bool
+	failures  []RestoreFailure
+	seen      map[string]bool
+}
+
+// newRestorer creates a restorer for the entities.
+func newRestorer(entities []*Entity, policy RestorePolicy) *restorer {
+	// Build two maps: one for entities with values, one for entities without values
+	r := &restorer{
+		policy:    policy,
+		entries:   make(map[string]*restoreEntry),
+		emptyKeys: make(map[string]bool),
+		seen:      make(map[string]bool),
+	}
+
+	for _, entity := range entities {
+		normalizedKey := normalizePlaceholder(entity.Key)
+		if len(entity.Values) == 0 {
+			r.emptyKeys[normalizedKey] = true
+			continue
+		}
+
+		entry := &restoreEntry{first: entity.Values[0]}
+		for _, span := range entity.Spans {
+			entry.occurrences = append(entry.occurrences, span.Value)
+		}
+		r.entries[normalizedKey] = entry
+	}
+
+	return r
+}
+
+// replace returns the restored value of a placeholder.
+// If it cannot be restored, the placeholder is returned unchanged and recorded as a failure.
+func (r *restorer) replace(placeholder string) string {
+	normalizedKey := normalizePlaceholder(placeholder)
+	if entry, exists := r.entries[normalizedKey]; exists {
+		return entry.value(r.policy)
+	}
+
+	// Record failure reason once per placeholder
+	if !r.seen[normalizedKey] {
+		reason := "not_found"
+		if r.emptyKeys[normalizedKey] {
+			reason = "empty_values"
+		}
+		r.failures = append(r.failures, RestoreFailure{
+			Placeholder: normalizedKey,
+			Reason:      reason,
+		})
+		r.seen[normalizedKey] = true
+	}
+	return placeholder
+}
+
+// Restore replaces placeholders and pseudonyms in text with entity values according to policy and writes the result to writer.
+// Placeholders are matched fuzzily (see normalizePlaceholder), pseudonyms exactly; placeholders that cannot be restored are
+// kept unchanged and returned as failures.
+func Restore(entities []*Entity, text string, writer io.Writer, policy RestorePolicy) ([]RestoreFailure, error) {
+	r := newRestorer(entities, policy)
+
+	// Stream replacement
+	lastIndex := 0
+	for _, mark := range findEntityMarks(text, entities) {
+		// Write text before placeholder, then the restored value
+		if _, err := io.WriteString(writer, text[lastIndex:mark.start]); err != nil {
+			return nil, eris.Wrap(err, "failed to write to output")
+		}
+		if _, err := io.WriteString(writer, r.replace(mark.placeholder)); err != nil {
+			return nil, eris.Wrap(err, "failed to write to output")
+		}
+		lastIndex = mark.end
+	}
+
+	// Write remaining text
+	if _, err := io.WriteString(writer, text[lastIndex:]); err != nil {
+		return nil, eris.Wrap(err, "failed to write to output")
+	}
+
+	return r.failures, nil
+}
+
+// maxPendingPlaceholder is the minimum number of bytes after a '<' that RestoreWriter waits for the closing '>'.
+// Longer candidates are written unchanged, so that a stray '<' cannot hold back the stream forever.
+const maxPendingPlaceholder = 256
+
+// pendingPlaceholderLimit returns how many bytes RestoreWriter waits for the closing '>': twice the
+// longest entity key, which leaves room for whitespace and full-width variants, and at least maxPendingPlaceholder.
+func pendingPlaceholderLimit(entities []*Entity) int {
+	limit := maxPendingPlaceholder
+	for _, entity := range entities {
+		if n := 2 * len(entity.Key); n > limit {
+			limit = n
+		}
+	}
+	return limit
+}
+
+// RestoreWriter 是流式还原的 io.Writer 包装。
+// 写入的脱敏文本 (可以是任意切分的 token 流) 会被即时还原并写入底层 writer，
+// 只有尚未闭合的 "<..." 片段和可能是假值开头的片段会被暂存，直到能够判断它是否为占位符或假值。
+// 写入结束后必须调用 Close 输出暂存的片段。
+type RestoreWriter struct {
+	writer     io.Writer
+	restorer   *restorer
+	pseudonyms *pseudonymMatcher
+	// maxPending is the number of bytes after a '<' waited for the closing '>'
+	maxPending int
+	// held is the tail that may be the start of a pseudonym
+	held    []byte
+	pending []byte
+}
+
+// NewRestoreWriter 创建一个流式还原 writer，按 policy 将占位符和假值还原后写入 writer。
+func NewRestoreWriter(writer io.Writer, entities []*Entity, policy RestorePolicy) *RestoreWriter {
+	return &RestoreWriter{
+		writer:     writer,
+		restorer:   newRestorer(entities, policy),
+		pseudonyms: newPseudonymMatcher(entities),
+		maxPending: pendingPlaceholderLimit(entities),
+	}
+}
+
+// Write restores the complete placeholders in p and writes everything that can be decided.
+func (w *RestoreWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, w.replacePseudonyms(p, false)...)
+	if err := w.flush(false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close writes the held back tail unchanged. It does not close the underlying writer.
+func (w *RestoreWriter) Close() error {
+	w.pending = append(w.pending, w.replacePseudonyms(nil, true)...)
+	return w.flush(true)
+}
+
+// replacePseudonyms replaces the pseudonyms in p by the keys of their entities, which are then restored
+// like placeholders. A tail that may be the start of a pseudonym is held back unless final is set.
+func (w *RestoreWriter) replacePseudonyms(p []byte, final bool) []byte {
+	if w.pseudonyms == nil {
+		return p
+	}
+
+	data := append(w.held, p...)
+	var output bytes.Buffer
+	i := 0
+	for i < len(data) {
+		if !final && w.pseudonyms.isPartial(data[i:]) {
+			break
+		}
+		if pseudonym := w.pseudonyms.match(data[i:]); pseudonym != "" {
+			output.WriteString(w.pseudonyms.keys[pseudonym])
+			i += len(pseudonym)
+			continue
+		}
+		output.WriteByte(data[i])
+		i++
+	}
+	w.held = append([]byte(nil), data[i:]...)
+	return output.Bytes()
+}
+
+// Failures returns the placeholders that could not be restored so far.
+func (w *RestoreWriter) Failures() []RestoreFailure {
+	return w.restorer.failures
+}
+
+// flush writes pending data up to the first undecided '<'; with final set everything is written.
+// Placeholders are recognized like placeholderRegex: a '<' followed by at least one character up to the first '>'.
+func (w *RestoreWriter) flush(final bool) error {
+	var output bytes.Buffer
+
+	for len(w.pending) > 0 {
+		start := bytes.IndexByte(w.pending, '<')
+		if start < 0 {
+			output.Write(w.pending)
+			w.pending = w.pending[:0]
+			break
+		}
+		output.Write(w.pending[:start])
+		w.pending = w.pending[start:]
+
+		end := bytes.IndexByte(w.pending[1:], '>') + 1
+		switch {
+		case end == 1:
+			// "<>" is not a placeholder
+			output.WriteByte('<')
+			w.pending = w.pending[1:]
+		case end > 0 && end < w.maxPending:
+			output.WriteString(w.restorer.replace(string(w.pending[:end+1])))
+			w.pending = w.pending[end+1:]
+		case final || end > 0 || len(w.pending) >= w.maxPending:
+			// Not a placeholder, continue after the '<'
+			output.WriteByte('<')
+			w.pending = w.pending[1:]
+		default:
+			// Wait for more data to decide
+			return w.write(output.Bytes())
+		}
+	}
+
+	w.pending = w.pending[:0]
+	return w.write(output.Bytes())
+}
+
+func (w *RestoreWriter) write(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if _, err := w.writer.Write(data); err != nil {
+		return eris.Wrap(err, "failed to write to output")
+	}
+	return nil
+}
+
+// restoreText restores text with the default policy.
+// It is shared by all Anonymizer implementations that use tag placeholders.
+func restoreText(entities []*Entity, text string, writer io.Writer) ([]RestoreFailure, error) {
+	return Restore(entities, text, writer, DefaultRestorePolicy)
+}
@@ -0,0 +1,211 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestRestore_Policies tests restoration of multi-valued entities with each policy.
+func TestRestore_Policies(t *testing.T) {
+	original := "张三说老张明天来，张三确认了"
+	anonymized := "<个人信息[0].姓名.全名>说<个人信息[0].姓名.全名>明天来，<个人信息[0].姓名.全名>确认了"
+	entities := []*Entity{
+		{Key: "<个人信息[0].姓名.全名>", Values: []string{"张三", "老张"}},
+	}
+	ComputeSpans(original, anonymized, entities)
+
+	tests := []struct {
+		name     string
+		policy   RestorePolicy
+		text     string
+		expected string
+	}{
+		{
+			name:     "Ordered restores the original wording",
+			policy:   RestoreOrdered,
+			text:     anonymized,
+			expected: original,
+		},
+		{
+			name:     "First always uses the first value",
+			policy:   RestoreFirst,
+			text:     anonymized,
+			expected: "张三说张三明天来，张三确认了",
+		},
+		{
+			name:     "Ordered falls back to the first value for extra occurrences",
+			policy:   RestoreOrdered,
+			text:     anonymized + "<个人信息[0].姓名.全名>",
+			expected: original + "张三",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			failures, err := Restore(entities, tt.text, &buf, tt.policy)
+			if err != nil {
+				t.Fatalf("Restore failed: %v", err)
+			}
+			if len(failures) != 0 {
+				t.Errorf("unexpected failures: %+v", failures)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+// TestRestore_OrderedWithoutSpans tests that entities without spans use the first value.
+func TestRestore_OrderedWithoutSpans(t *testing.T) {
+	entities := []*Entity{
+		{Key: "<个人信息[0].姓名.全名>", Values: []string{"张三", "老张"}},
+	}
+
+	var buf bytes.Buffer
+	if _, err := Restore(entities, "<个人信息[0].姓名.全名>和<个人信息[0].姓名.全名>", &buf, RestoreOrdered); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if buf.String() != "张三和张三" {
+		t.Errorf("expected %q, got %q", "张三和张三", buf.String())
+	}
+}
+
+// TestParseRestorePolicy tests parsing of policy names.
+func TestParseRestorePolicy(t *testing.T) {
+	for _, name := range []string{"first", "ordered"} {
+		if policy, err := ParseRestorePolicy(name); err != nil || string(policy) != name {
+			t.Errorf("ParseRestorePolicy(%q) = %q, %v", name, policy, err)
+		}
+	}
+	if _, err := ParseRestorePolicy("random"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
+
+// TestRestoreWriter_Splits tests that streaming restore matches Restore for every chunk size.
+func TestRestoreWriter_Splits(t *testing.T) {
+	entities := []*Entity{
+		{Key: "<个人信息[0].姓名.全名>", Values: []string{"张三", "老张"}},
+		{Key: "<组织机构[0].公司.全名>", Values: []string{"ABC Tech"}},
+		{Key: "<个人信息[1].电话.号码>"},
+	}
+	ComputeSpans("张三和老张在 ABC Tech", "<个人信息[0].姓名.全名>和<个人信息[0].姓名.全名>在 <组织机构[0].公司.全名>", entities)
+
+	texts := []string{
+		"<个人信息[0].姓名.全名>和<个人信息[0].姓名.全名>在 <组织机构[0].公司.全名>",
+		"< 个人信息 [0]. 姓名. 全名 >说 a<b 和 <> 还有 <个人信息[1].电话.号码> 及 <未知[0].x.y>",
+		"末尾未闭合 <个人信息[0].姓名",
+		"<<组织机构[0].公司.全名>>",
+	}
+
+	for _, text := range texts {
+		var expected bytes.Buffer
+		expectedFailures, err := Restore(entities, text, &expected, RestoreOrdered)
+		if err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+
+		for size := 1; size <= len(text); size++ {
+			var buf bytes.Buffer
+			w := NewRestoreWriter(&buf, entities, RestoreOrdered)
+			for i := 0; i < len(text); i += size {
+				end := i + size
+				if end > len(text) {
+					end = len(text)
+				}
+				if _, err := w.Write([]byte(text[i:end])); err != nil {
+					t.Fatalf("Write failed: %v", err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			if buf.String() != expected.String() {
+				t.Fatalf("text %q, chunk size %d: expected %q, got %q", text, size, expected.String(), buf.String())
+			}
+			if len(w.Failures()) != len(expectedFailures) {
+				t.Fatalf("text %q, chunk size %d: expected failures %+v, got %+v", text, size, expectedFailures, w.Failures())
+			}
+		}
+	}
+}
+
+// TestRestoreWriter_HoldsBackOnlyPartialPlaceholder tests that output is written as soon as it can be decided.
+func TestRestoreWriter_HoldsBackOnlyPartialPlaceholder(t *testing.T) {
+	entities := []*Entity{{Key: "<个人信息[0].姓名.全名>", Values: []string{"张三"}}}
+
+	var buf bytes.Buffer
+	w := NewRestoreWriter(&buf, entities, RestoreFirst)
+
+	_, _ = w.Write([]byte("你好，<个人信息[0]"))
+	if buf.String() != "你好，" {
+		t.Errorf("expected only the text before the partial placeholder, got %q", buf.String())
+	}
+
+	_, _ = w.Write([]byte(".姓名.全名>！"))
+	if buf.String() != "你好，张三！" {
+		t.Errorf("expected the restored placeholder, got %q", buf.String())
+	}
+
+	// A '<' that is never closed is released once it gets too long
+	_, _ = w.Write([]byte("a < b " + strings.Repeat("x", maxPendingPlaceholder)))
+	if !strings.HasPrefix(buf.String(), "你好，张三！a < b x") {
+		t.Errorf("expected a stray '<' to be released, got %q", buf.String())
+	}
+}
+
+// TestRestoreWriter_LongKey tests that placeholders longer than maxPendingPlaceholder are restored like Restore does.
+func TestRestoreWriter_LongKey(t *testing.T) {
+	key := "<业务信息[0]." + strings.Repeat("项目", 60) + ".名称>"
+	if len(key) <= maxPendingPlaceholder {
+		t.Fatalf("expected a key longer than %d bytes, got %d", maxPendingPlaceholder, len(key))
+	}
+	entities := []*Entity{{Key: key, Values: []string{"星火计划"}}}
+	text := "启动 " + key + " 和 " + strings.Replace(key, ".名称", " . 名称 ", 1) + "。"
+
+	var expected bytes.Buffer
+	if _, err := Restore(entities, text, &expected, RestoreFirst); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if expected.String() != "启动 星火计划 和 星火计划。" {
+		t.Fatalf("unexpected Restore result: %q", expected.String())
+	}
+
+	for _, size := range []int{1, 7, len(text)} {
+		var buf bytes.Buffer
+		w := NewRestoreWriter(&buf, entities, RestoreFirst)
+		for i := 0; i < len(text); i += size {
+			end := i + size
+			if end > len(text) {
+				end = len(text)
+			}
+			_, _ = w.Write([]byte(text[i:end]))
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if buf.String() != expected.String() {
+			t.Errorf("chunk size %d: expected %q, got %q", size, expected.String(), buf.String())
+		}
+	}
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/rotisserie/eris"
+)
+
+// repairPrompt is sent after a reply that could not be used, together with the error.
+const repairPrompt = `Your previous reply could not be used: %s
+Reply again with the complete anonymized text, then a line containing only <<<PAIR>>>, then a JSON object mapping every tag in the format <EntityType[ID].Category.Detail> to the list of original values.`
+
+// RetryConfig holds the configuration for retrying malformed LLM responses.
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of LLM calls per Anonymize (1 disables retries)
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, doubled for every further retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries (0 means no cap)
+	MaxBackoff time.Duration
+}
+
+// Validate checks if the configuration is valid.
+func (c *RetryConfig) Validate() error {
+	if c.MaxAttempts <= 0 {
+		return fmt.Errorf("max attempts must be positive, got %d", c.MaxAttempts)
+	}
+	if c.InitialBackoff < 0 {
+		return fmt.Errorf("initial backoff must not be negative, got %s", c.InitialBackoff)
+	}
+	if c.MaxBackoff < 0 {
+		return fmt.Errorf("max backoff must not be negative, got %s", c.MaxBackoff)
+	}
+	return nil
+}
+
+// WithRetry makes Anonymize retry when the LLM response is malformed (missing <<<PAIR>>>,
+// invalid JSON or invalid keys) or, with WithStrictValidation, fails validation.
+// Each retry sends the previous reply and a repair message containing the error back to the model.
+// When more than one attempt is allowed the anonymized text is buffered and only written
+// once an attempt succeeds, so that a failed attempt never reaches the writer.
+func WithRetry(config *RetryConfig) Option {
+	return func(h *HasHidePair) {
+		h.retry = config
+	}
+}
+
+// maxAttempts returns the number of allowed LLM calls, 1 if retries are not configured.
+func (c *RetryConfig) maxAttempts() int {
+	if c == nil {
+		return 1
+	}
+	return c.MaxAttempts
+}
+
+// backoff returns the delay before the given retry (1 for the first retry).
+func (c *RetryConfig) backoff(retry int) time.Duration {
+	delay := c.InitialBackoff
+	for i := 1; i < retry && delay > 0; i++ {
+		delay *= 2
+		if c.MaxBackoff > 0 && delay >= c.MaxBackoff {
+			break
+		}
+	}
+	if c.MaxBackoff > 0 && delay > c.MaxBackoff {
+		delay = c.MaxBackoff
+	}
+	return delay
+}
+
+// wait sleeps before the given retry, returning early if ctx is done.
+func (c *RetryConfig) wait(ctx context.Context, retry int) error {
+	delay := c.backoff(retry)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return eris.Wrap(ctx.Err(), "retry canceled")
+	case <-timer.C:
+		return nil
+	}
+}
+
+// responseFormatError is returned when the LLM response cannot be parsed.
+type responseFormatError struct {
+	err error
+}
+
+func (e *responseFormatError) Error() string {
+	return e.err.Error()
+}
+
+func (e *responseFormatError) Unwrap() error {
+	return e.err
+}
+
+// isRepairable returns true if the error can be fixed by asking the model again.
+func isRepairable(err error) bool {
+	var formatErr *responseFormatError
+	var validationErr *ValidationError
+	return errors.As(err, &formatErr) || errors.As(err, &validationErr)
+}
+
+// repairMessages appends the failed reply and a repair request to messages.
+func repairMessages(messages []*schema.Message, response string, err error) []*schema.Message {
+	repaired := make([]*schema.Message, 0, len(messages)+2)
+	repaired = append(repaired, messages...)
+	return append(repaired,
+		schema.AssistantMessage(response, nil),
+		schema.UserMessage(fmt.Sprintf(repairPrompt, err)),
+	)
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/mrlyc/inu/pkg/anonymizer/anonymizertest"
+)
+
+// TestAnonymize_RetryRepairsMalformedResponse tests that a malformed response is repaired by a retry.
+func TestAnonymize_RetryRepairsMalformedResponse(t *testing.T) {
+	mockLLM := newMockChatModel(
+		&schema.Message{Role: schema.Assistant, Content: "<个人信息[0].姓名.全名> lives in Beijing"},
+		newMockAnonymizeResponse("<个人信息[0].姓名.全名> lives in Beijing", map[string][]string{
+			"<个人信息[0].姓名.全名>": {"张三"},
+		}),
+	)
+
+	anon, err := NewHashHidePair(mockLLM, WithRetry(&RetryConfig{MaxAttempts: 3}))
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(context.Background(), []string{"个人信息"}, "张三 lives in Beijing", &buf)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+
+	if mockLLM.Calls() != 2 {
+		t.Errorf("expected 2 LLM calls, got %d", mockLLM.Calls())
+	}
+	if len(entities) != 1 {
+		t.Errorf("expected 1 entity, got %d", len(entities))
+	}
+	if buf.String() != "<个人信息[0].姓名.全名> lives in Beijing" {
+		t.Errorf("failed attempt must not reach the writer, got %q", buf.String())
+	}
+
+	// The repair request contains the failed reply and the parse error
+	repair := lastRequest(mockLLM)
+	if len(repair) != 3 {
+		t.Fatalf("expected 3 messages in repair request, got %d", len(repair))
+	}
+	if repair[1].Role != schema.Assistant || repair[1].Content != "<个人信息[0].姓名.全名> lives in Beijing" {
+		t.Errorf("expected the failed reply as assistant message, got %+v", repair[1])
+	}
+	if !strings.Contains(repair[2].Content, "invalid response format") {
+		t.Errorf("expected the parse error in the repair message, got %q", repair[2].Content)
+	}
+}
+
+// TestAnonymize_RetryGivesUp tests that Anonymize fails after the maximum number of attempts.
+func TestAnonymize_RetryGivesUp(t *testing.T) {
+	invalid := &schema.Message{Role: schema.Assistant, Content: "text\n<<<PAIR>>>\n{\"<invalid>\": [\"x\"]}"}
+	mockLLM := newMockChatModel(invalid, invalid, invalid)
+
+	anon, err := NewHashHidePair(mockLLM, WithRetry(&RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond}))
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	var buf bytes.Buffer
+	_, err = anon.Anonymize(context.Background(), []string{"个人信息"}, "text", &buf)
+	if err == nil {
+		t.Fatal("expected error after all attempts failed")
+	}
+	if mockLLM.Calls() != 3 {
+		t.Errorf("expected 3 LLM calls, got %d", mockLLM.Calls())
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no output, got %q", buf.String())
+	}
+}
+
+// TestAnonymize_RetrySkipsLLMErrors tests that errors from the LLM call itself are not retried.
+func TestAnonymize_RetrySkipsLLMErrors(t *testing.T) {
+	mockLLM := newMockErrorResponse(errors.New("connection refused"))
+
+	anon, err := NewHashHidePair(mockLLM, WithRetry(&RetryConfig{MaxAttempts: 3}))
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := anon.Anonymize(context.Background(), []string{"个人信息"}, "text", &buf); err == nil {
+		t.Fatal("expected error")
+	}
+	if mockLLM.Calls() != 1 {
+		t.Errorf("expected 1 LLM call, got %d", mockLLM.Calls())
+	}
+}
+
+// TestAnonymize_RetryOnValidationError tests that strict validation failures are retried.
+func TestAnonymize_RetryOnValidationError(t *testing.T) {
+	mockLLM := newMockChatModel(
+		newMockAnonymizeResponse("<个人信息[0].姓名.全名> lives in Beijing", map[string][]string{
+			"<个人信息[0].姓名.全名>": {"王五"},
+		}),
+		newMockAnonymizeResponse("<个人信息[0].姓名.全名> lives in Beijing", map[string][]string{
+			"<个人信息[0].姓名.全名>": {"张三"},
+		}),
+	)
+
+	anon, err := NewHashHidePair(mockLLM, WithStrictValidation(), WithRetry(&RetryConfig{MaxAttempts: 2}))
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(context.Background(), []string{"个人信息"}, "张三 lives in Beijing", &buf)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+	if len(entities) != 1 || entities[0].Values[0] != "张三" {
+		t.Errorf("expected entities of the second attempt, got %+v", entities)
+	}
+	if !strings.Contains(lastRequest(mockLLM)[2].Content, "does not occur in the original text") {
+		t.Errorf("expected the validation issues in the repair message, got %q", lastRequest(mockLLM)[2].Content)
+	}
+}
+
+// TestRetryConfig_Backoff tests the exponential backoff with cap.
+func TestRetryConfig_Backoff(t *testing.T) {
+	config := &RetryConfig{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, want := range expected {
+		if got := config.backoff(i + 1); got != want {
+			t.Errorf("retry %d: expected %s, got %s", i+1, want, got)
+		}
+	}
+}
+
+// TestRetryConfig_Validate tests retry configuration validation.
+func TestRetryConfig_Validate(t *testing.T) {
+	if _, err := NewHashHidePair(anonymizertest.NewChatModel(), WithRetry(&RetryConfig{MaxAttempts: 0})); err == nil {
+		t.Error("expected error for zero max attempts")
+	}
+	if _, err := NewHashHidePair(anonymizertest.NewChatModel(), WithRetry(&RetryConfig{MaxAttempts: 1, InitialBackoff: -time.Second})); err == nil {
+		t.Error("expected error for negative backoff")
+	}
+}
@@ -0,0 +1,358 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"context"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rotisserie/eris"
+)
+
+// Rule 描述一条基于正则表达式的实体识别规则。
+type Rule struct {
+	// Name 是规则名称 (如 "phone", "email")
+	Name string
+	// EntityType 是生成占位符使用的实体类型 (如 "个人信息")
+	EntityType string
+	// Category 是占位符中的类别 (如 "电话")
+	Category string
+	// Detail 是占位符中的细节 (如 "号码")
+	Detail string
+	// Pattern 是匹配实体的正则表达式
+	Pattern *regexp.Regexp
+	// Validate 对匹配结果做进一步校验 (如 Luhn 校验)，为 nil 时不校验
+	Validate func(match string) bool
+}
+
+// DefaultRules returns the built-in rule set for structured entities.
+// Rules earlier in the list win when two rules match the same span.
+func DefaultRules() []*Rule {
+	return []*Rule{
+		{
+			Name:       "url",
+			EntityType: "资产信息",
+			Category:   "网址",
+			Detail:     "链接",
+			Pattern:    regexp.MustCompile(`https?://[^\s<>"'，。、；：！？）]*[^\s<>"'，。、；：！？）.,;:!?)]`),
+		},
+		{
+			Name:       "email",
+			EntityType: "个人信息",
+			Category:   "邮箱",
+			Detail:     "地址",
+			Pattern:    regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		},
+		{
+			Name:       "id_card",
+			EntityType: "个人信息",
+			Category:   "身份证",
+			Detail:     "号码",
+			Pattern:    regexp.MustCompile(`[1-9]\d{5}(?:18|19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]`),
+			Validate:   isValidChineseIDCard,
+		},
+		{
+			Name:       "bank_card",
+			EntityType: "账户信息",
+			Category:   "银行卡",
+			Detail:     "号码",
+			Pattern:    regexp.MustCompile(`[1-9]\d{3}(?:[ -]?\d{4}){2,3}(?:[ -]?\d{1,3})?`),
+			Validate:   isValidBankCard,
+		},
+		{
+			Name:       "phone",
+			EntityType: "个人信息",
+			Category:   "电话",
+			Detail:     "号码",
+			Pattern:    regexp.MustCompile(`(?:\+?86[ -]?)?1[3-9]\d{9}|0\d{2,3}-\d{7,8}`),
+		},
+		{
+			Name:       "ipv4",
+			EntityType: "资产信息",
+			Category:   "IP",
+			Detail:     "地址",
+			Pattern:    regexp.MustCompile(`(?:\d{1,3}\.){3}\d{1,3}`),
+			Validate:   isValidIPv4,
+		},
+		{
+			Name:       "ipv6",
+			EntityType: "资产信息",
+			Category:   "IP",
+			Detail:     "地址",
+			Pattern:    regexp.MustCompile(`(?:[0-9A-Fa-f]{0,4}:){2,7}[0-9A-Fa-f]{0,4}`),
+			Validate:   isValidIPv6,
+		},
+		{
+			Name:       "license_plate",
+			EntityType: "资产信息",
+			Category:   "车牌",
+			Detail:     "号码",
+			Pattern:    regexp.MustCompile(`[京津沪渝冀豫云辽黑湘皖鲁新苏浙赣鄂桂甘晋蒙陕吉闽贵粤青藏川宁琼][A-HJ-NP-Z][·•]?(?:[A-HJ-NP-Z0-9]{5,6}|[A-HJ-NP-Z0-9]{4}[挂学警港澳])`),
+		},
+	}
+}
+
+// RuleBased 是基于正则规则的 Anonymizer 实现，无需调用 LLM。
+// 它适合识别手机号、邮箱、身份证号、银行卡号、IP、网址、车牌等结构化实体，
+// 生成与 HasHidePair 相同的 <EntityType[ID].Category.Detail> 占位符和 Entity 结构。
+type RuleBased struct {
+	rules []*Rule
+}
+
+// ruleMatch is a validated match of a rule in the text.
+type ruleMatch struct {
+	start, end int
+	rule       *Rule
+	priority   int
+}
+
+// Anonymize replaces every rule match with a placeholder and writes the result to writer.
+// Only rules whose entity type is listed in types are applied; an empty types list applies all rules.
+func (r *RuleBased) Anonymize(ctx context.Context, types []string, text string, writer io.Writer) ([]*Entity, error) {
+	matches := r.findMatches(types, text)
+	anonymizedText, entities := replaceMatches(text, matches)
+
+	if _, err := writer.Write([]byte(anonymizedText)); err != nil {
+		return nil, eris.Wrap(err, "failed to write to output")
+	}
+
+	return entities, nil
+}
+
+// RestoreText restores placeholders in text using the entities.
+func (r *RuleBased) RestoreText(ctx context.Context, entities []*Entity, text string, writer io.Writer) ([]RestoreFailure, error) {
+	return restoreText(entities, text, writer)
+}
+
+// findMatches returns non-overlapping rule matches ordered by position.
+// On overlap the earliest and then longest match wins, ties are broken by rule order.
+func (r *RuleBased) findMatches(types []string, text string) []ruleMatch {
+	enabled := make(map[string]bool, len(types))
+	for _, t := range types {
+		enabled[t] = true
+	}
+
+	var candidates []ruleMatch
+	for priority, rule := range r.rules {
+		if len(types) > 0 && !enabled[rule.EntityType] {
+			continue
+		}
+		for _, loc := range rule.Pattern.FindAllStringIndex(text, -1) {
+			match := text[loc[0]:loc[1]]
+			if !isTokenBoundary(text, loc[0], loc[1]) {
+				continue
+			}
+			if rule.Validate != nil && !rule.Validate(match) {
+				continue
+			}
+			candidates = append(candidates, ruleMatch{start: loc[0], end: loc[1], rule: rule, priority: priority})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.start != b.start {
+			return a.start < b.start
+		}
+		if a.end != b.end {
+			return a.end > b.end
+		}
+		return a.priority < b.priority
+	})
+
+	var matches []ruleMatch
+	lastEnd := 0
+	for _, candidate := range candidates {
+		if candidate.start < lastEnd {
+			continue
+		}
+		matches = append(matches, candidate)
+		lastEnd = candidate.end
+	}
+
+	return matches
+}
+
+// replaceMatches replaces matches with placeholders, assigning one ID per distinct value and entity type.
+func replaceMatches(text string, matches []ruleMatch) (string, []*Entity) {
+	var builder strings.Builder
+	var entities []*Entity
+	byValue := make(map[string]*Entity)
+	nextID := make(map[string]int)
+
+	lastIndex := 0
+	for _, match := range matches {
+		value := text[match.start:match.end]
+		rule := match.rule
+
+		valueKey := rule.EntityType + "\x00" + rule.Category + "\x00" + value
+		entity, ok := byValue[valueKey]
+		if !ok {
+			// IDs are numbered from 1 per entity type, like the placeholders of the LLM engine
+			nextID[rule.EntityType]++
+			id := strconv.Itoa(nextID[rule.EntityType])
+			entity = &Entity{
+				Key:        formatEntityKey(rule.EntityType, id, rule.Category, rule.Detail),
+				EntityType: rule.EntityType,
+				ID:         id,
+				Category:   rule.Category,
+				Detail:     rule.Detail,
+				Values:     []string{value},
+			}
+			byValue[valueKey] = entity
+			entities = append(entities, entity)
+		}
+
+		builder.WriteString(text[lastIndex:match.start])
+		builder.WriteString(entity.Key)
+		lastIndex = match.end
+	}
+	builder.WriteString(text[lastIndex:])
+
+	return builder.String(), entities
+}
+
+// isTokenBoundary reports whether the match is not glued to surrounding ASCII letters or digits,
+// e.g. a phone number inside a longer digit sequence is rejected.
+func isTokenBoundary(text string, start, end int) bool {
+	if start > 0 {
+		prev, _ := utf8.DecodeLastRuneInString(text[:start])
+		first, _ := utf8.DecodeRuneInString(text[start:])
+		if isASCIIAlnum(prev) && isASCIIAlnum(first) {
+			return false
+		}
+	}
+	if end < len(text) {
+		next, _ := utf8.DecodeRuneInString(text[end:])
+		last, _ := utf8.DecodeLastRuneInString(text[:end])
+		if isASCIIAlnum(next) && isASCIIAlnum(last) {
+			return false
+		}
+	}
+	return true
+}
+
+func isASCIIAlnum(r rune) bool {
+	return r <= unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// isValidChineseIDCard validates the checksum of an 18-digit Chinese resident ID card number.
+func isValidChineseIDCard(id string) bool {
+	if len(id) != 18 {
+		return false
+	}
+
+	return chineseIDCheckCode(id[:17]) == byte(unicode.ToUpper(rune(id[17])))
+}
+
+// chineseIDCheckCode computes the check code of the first 17 digits of an ID card number.
+func chineseIDCheckCode(digits string) byte {
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	checkCodes := "10X98765432"
+
+	sum := 0
+	for i, weight := range weights {
+		sum += int(digits[i]-'0') * weight
+	}
+
+	return checkCodes[sum%11]
+}
+
+// isValidBankCard validates a bank card number (13-19 digits) with the Luhn algorithm.
+func isValidBankCard(card string) bool {
+	digits := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, card)
+
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	return luhnValid(digits)
+}
+
+// luhnValid reports whether a digit string passes the Luhn checksum.
+func luhnValid(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func isValidIPv4(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && parsed.To4() != nil
+}
+
+// isValidIPv6 requires, besides parsing, enough hex groups that "::", "a::b" or "ns::name" in code are not
+// taken for addresses: three groups, or two with a full four-digit group and a decimal digit (e.g. fe80::1).
+func isValidIPv6(ip string) bool {
+	if !strings.Contains(ip, ":") || net.ParseIP(ip) == nil {
+		return false
+	}
+
+	groups, longest := 0, 0
+	for _, group := range strings.Split(ip, ":") {
+		if group == "" {
+			continue
+		}
+		groups++
+		if len(group) > longest {
+			longest = len(group)
+		}
+	}
+	return groups >= 3 || (groups == 2 && longest == 4 && strings.ContainsAny(ip, "0123456789"))
+}
+
+// NewRuleBased 创建一个基于正则规则的 Anonymizer 实现。
+// rules 为空时使用 DefaultRules。
+func NewRuleBased(rules []*Rule) (Anonymizer, error) {
+	if len(rules) == 0 {
+		rules = DefaultRules()
+	}
+
+	for _, rule := range rules {
+		if rule.Pattern == nil {
+			return nil, eris.Errorf("rule %q has no pattern", rule.Name)
+		}
+		if rule.EntityType == "" || rule.Category == "" || rule.Detail == "" {
+			return nil, eris.Errorf("rule %q must define entity type, category and detail", rule.Name)
+		}
+	}
+
+	return &RuleBased{rules: rules}, nil
+}
@@ -0,0 +1,222 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"testing"
+)
+
+// TestRuleBased_Detection tests detection of each built-in rule.
+func TestRuleBased_Detection(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		values   []string
+	}{
+		{
+			name:     "Mobile phone",
+			input:    "电话：13800138000，请回电",
+			expected: "电话：<个人信息[1].电话.号码>，请回电",
+			values:   []string{"13800138000"},
+		},
+		{
+			name:     "Phone with country code",
+			input:    "call +86 13912345678 now",
+			expected: "call <个人信息[1].电话.号码> now",
+			values:   []string{"+86 13912345678"},
+		},
+		{
+			name:     "Email",
+			input:    "邮箱 zhangsan@example.com 已验证",
+			expected: "邮箱 <个人信息[1].邮箱.地址> 已验证",
+			values:   []string{"zhangsan@example.com"},
+		},
+		{
+			name:     "Chinese ID card",
+			input:    "身份证号11010519491231002X。",
+			expected: "身份证号<个人信息[1].身份证.号码>。",
+			values:   []string{"11010519491231002X"},
+		},
+		{
+			name:     "Bank card with spaces",
+			input:    "卡号 4111 1111 1111 1111",
+			expected: "卡号 <账户信息[1].银行卡.号码>",
+			values:   []string{"4111 1111 1111 1111"},
+		},
+		{
+			name:     "IPv4 and IPv6",
+			input:    "hosts 192.168.1.10 and 2001:db8::1, gateway fe80::1",
+			expected: "hosts <资产信息[1].IP.地址> and <资产信息[2].IP.地址>, gateway <资产信息[3].IP.地址>",
+			values:   []string{"192.168.1.10", "2001:db8::1", "fe80::1"},
+		},
+		{
+			name:     "URL without trailing punctuation",
+			input:    "见 https://intranet.example.com/wiki?id=1.",
+			expected: "见 <资产信息[1].网址.链接>.",
+			values:   []string{"https://intranet.example.com/wiki?id=1"},
+		},
+		{
+			name:     "License plate",
+			input:    "车牌京A12345停在楼下",
+			expected: "车牌<资产信息[1].车牌.号码>停在楼下",
+			values:   []string{"京A12345"},
+		},
+	}
+
+	anon, err := NewRuleBased(nil)
+	if err != nil {
+		t.Fatalf("Failed to create rule-based anonymizer: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			entities, err := anon.Anonymize(context.Background(), nil, tt.input, &buf)
+			if err != nil {
+				t.Fatalf("Anonymize failed: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, buf.String())
+			}
+			if len(entities) != len(tt.values) {
+				t.Fatalf("expected %d entities, got %d", len(tt.values), len(entities))
+			}
+			for i, value := range tt.values {
+				if entities[i].Values[0] != value {
+					t.Errorf("entity %d: expected value %q, got %q", i, value, entities[i].Values[0])
+				}
+			}
+		})
+	}
+}
+
+// TestRuleBased_RejectsInvalid tests that validators and token boundaries reject false positives.
+func TestRuleBased_RejectsInvalid(t *testing.T) {
+	anon, err := NewRuleBased(nil)
+	if err != nil {
+		t.Fatalf("Failed to create rule-based anonymizer: %v", err)
+	}
+
+	inputs := []string{
+		"订单号 4111111111111112",   // fails Luhn
+		"身份证号110105194912310021", // bad checksum
+		"版本 999.1.2.3",           // invalid IPv4 octet
+		"编号 A13800138000B",       // phone glued to letters
+		"时间 12:30:45",            // not an IPv6 address
+		"ns :: x",                // bare "::"
+		"a::b",                   // single-letter groups
+		"ns::name",               // C++ scope resolution
+		"std::cout << x",         // C++ scope resolution
+		"cafe::beef",             // hex words without digits
+	}
+
+	for _, input := range inputs {
+		var buf bytes.Buffer
+		entities, err := anon.Anonymize(context.Background(), nil, input, &buf)
+		if err != nil {
+			t.Fatalf("Anonymize failed: %v", err)
+		}
+		if len(entities) != 0 || buf.String() != input {
+			t.Errorf("expected no detection in %q, got %q with %d entities", input, buf.String(), len(entities))
+		}
+	}
+}
+
+// TestRuleBased_SameValueSameKey tests that repeated values share one placeholder.
+func TestRuleBased_SameValueSameKey(t *testing.T) {
+	anon, err := NewRuleBased(nil)
+	if err != nil {
+		t.Fatalf("Failed to create rule-based anonymizer: %v", err)
+	}
+
+	input := "a@example.com 与 13800138000，再次联系 a@example.com"
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(context.Background(), nil, input, &buf)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+
+	expected := "<个人信息[1].邮箱.地址> 与 <个人信息[2].电话.号码>，再次联系 <个人信息[1].邮箱.地址>"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+	if len(entities) != 2 {
+		t.Errorf("expected 2 entities, got %d", len(entities))
+	}
+
+	var restored bytes.Buffer
+	failures, err := anon.RestoreText(context.Background(), entities, buf.String(), &restored)
+	if err != nil {
+		t.Fatalf("RestoreText failed: %v", err)
+	}
+	if restored.String() != input || len(failures) != 0 {
+		t.Errorf("round trip failed: %q, failures: %v", restored.String(), failures)
+	}
+}
+
+// TestRuleBased_EntityTypeFilter tests that only rules of the requested types are applied.
+func TestRuleBased_EntityTypeFilter(t *testing.T) {
+	anon, err := NewRuleBased(nil)
+	if err != nil {
+		t.Fatalf("Failed to create rule-based anonymizer: %v", err)
+	}
+
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(context.Background(), []string{"账户信息"}, "13800138000 / 6222021001123456789", &buf)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+
+	if buf.String() != "13800138000 / <账户信息[1].银行卡.号码>" {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+	if len(entities) != 1 {
+		t.Errorf("expected 1 entity, got %d", len(entities))
+	}
+}
+
+// TestNewRuleBased_CustomRules tests custom rule sets and their validation.
+func TestNewRuleBased_CustomRules(t *testing.T) {
+	rule := &Rule{
+		Name:       "employee_id",
+		EntityType: "个人信息",
+		Category:   "工号",
+		Detail:     "编号",
+		Pattern:    regexp.MustCompile(`EMP-\d{6}`),
+	}
+
+	anon, err := NewRuleBased([]*Rule{rule})
+	if err != nil {
+		t.Fatalf("Failed to create rule-based anonymizer: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := anon.Anonymize(context.Background(), nil, "工号 EMP-001234，电话 13800138000", &buf); err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+	if buf.String() != "工号 <个人信息[1].工号.编号>，电话 13800138000" {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+
+	if _, err := NewRuleBased([]*Rule{{Name: "broken", EntityType: "个人信息"}}); err == nil {
+		t.Error("Expected error for rule without pattern, got nil")
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// ComputeSpans sets the Spans of every entity by aligning the anonymized text with the original.
+// Placeholders and pseudonyms are processed in order: each one is matched with the earliest occurrence of one
+// of its entity values in the original text after the previous match (the longest value wins on ties).
+// Placeholders that are not in the mapping or whose values cannot be located get no span.
+func ComputeSpans(original, anonymized string, entities []*Entity) {
+	entityMap := make(map[string]*Entity, len(entities))
+	for _, entity := range entities {
+		entity.Spans = nil
+		entityMap[normalizePlaceholder(entity.Key)] = entity
+	}
+
+	originalOffsets := &runeOffsets{text: original}
+	anonymizedOffsets := &runeOffsets{text: anonymized}
+
+	cursor := 0
+	for _, mark := range findEntityMarks(anonymized, entities) {
+		entity, ok := entityMap[normalizePlaceholder(mark.placeholder)]
+		if !ok {
+			continue
+		}
+
+		index, length := -1, 0
+		for _, value := range entity.Values {
+			if value == "" {
+				continue
+			}
+			i := strings.Index(original[cursor:], value)
+			if i < 0 {
+				continue
+			}
+			if index < 0 || i < index || (i == index && len(value) > length) {
+				index, length = i, len(value)
+			}
+		}
+		if index < 0 {
+			continue
+		}
+
+		start := cursor + index
+		end := start + length
+		entity.Spans = append(entity.Spans, Span{
+			Value:           original[start:end],
+			Start:           originalOffsets.at(start),
+			End:             originalOffsets.at(end),
+			AnonymizedStart: anonymizedOffsets.at(mark.start),
+			AnonymizedEnd:   anonymizedOffsets.at(mark.end),
+		})
+		cursor = end
+	}
+}
+
+// runeOffsets converts byte offsets into character offsets.
+// It is optimized for increasing byte offsets.
+type runeOffsets struct {
+	text      string
+	byteIndex int
+	runeIndex int
+}
+
+// at returns the character offset of the given byte offset.
+func (r *runeOffsets) at(byteIndex int) int {
+	if byteIndex < r.byteIndex {
+		r.byteIndex, r.runeIndex = 0, 0
+	}
+	r.runeIndex += utf8.RuneCountInString(r.text[r.byteIndex:byteIndex])
+	r.byteIndex = byteIndex
+	return r.runeIndex
+}
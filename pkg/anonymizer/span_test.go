@@ -0,0 +1,75 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestComputeSpans tests alignment of placeholders with the original text.
+func TestComputeSpans(t *testing.T) {
+	original := "张三在 ABC 工作，老张说张三很好"
+	anonymized := "<个人信息[0].姓名.全名>在 <组织机构[0].公司.全名> 工作，<个人信息[0].姓名.全名>说< 个人信息[0].姓名.全名 >很好<个人信息[9].姓名.全名>"
+	entities := []*Entity{
+		{Key: "<个人信息[0].姓名.全名>", Values: []string{"张三", "老张"}},
+		{Key: "<组织机构[0].公司.全名>", Values: []string{"ABC"}},
+	}
+
+	ComputeSpans(original, anonymized, entities)
+
+	expectedPerson := []Span{
+		{Value: "张三", Start: 0, End: 2, AnonymizedStart: 0, AnonymizedEnd: 15},
+		{Value: "老张", Start: 11, End: 13, AnonymizedStart: 36, AnonymizedEnd: 51},
+		{Value: "张三", Start: 14, End: 16, AnonymizedStart: 52, AnonymizedEnd: 69},
+	}
+	if !reflect.DeepEqual(entities[0].Spans, expectedPerson) {
+		t.Errorf("unexpected person spans:\n got  %+v\n want %+v", entities[0].Spans, expectedPerson)
+	}
+
+	expectedOrg := []Span{{Value: "ABC", Start: 4, End: 7, AnonymizedStart: 17, AnonymizedEnd: 32}}
+	if !reflect.DeepEqual(entities[1].Spans, expectedOrg) {
+		t.Errorf("unexpected org spans:\n got  %+v\n want %+v", entities[1].Spans, expectedOrg)
+	}
+
+	// Offsets are character offsets into both texts
+	originalRunes, anonymizedRunes := []rune(original), []rune(anonymized)
+	for _, span := range entities[0].Spans {
+		if string(originalRunes[span.Start:span.End]) != span.Value {
+			t.Errorf("original offsets [%d:%d] do not match %q", span.Start, span.End, span.Value)
+		}
+		if normalizePlaceholder(string(anonymizedRunes[span.AnonymizedStart:span.AnonymizedEnd])) != entities[0].Key {
+			t.Errorf("anonymized offsets [%d:%d] do not match the placeholder", span.AnonymizedStart, span.AnonymizedEnd)
+		}
+	}
+}
+
+// TestComputeSpans_Recompute tests that previous spans are replaced.
+func TestComputeSpans_Recompute(t *testing.T) {
+	entities := []*Entity{{Key: "<个人信息[0].姓名.全名>", Values: []string{"张三"}}}
+
+	ComputeSpans("张三", "<个人信息[0].姓名.全名>", entities)
+	ComputeSpans("张三", "<个人信息[0].姓名.全名>", entities)
+	if len(entities[0].Spans) != 1 {
+		t.Errorf("expected 1 span, got %d", len(entities[0].Spans))
+	}
+
+	ComputeSpans("李四", "<个人信息[0].姓名.全名>", entities)
+	if len(entities[0].Spans) != 0 {
+		t.Errorf("expected no span for a value missing from the original, got %+v", entities[0].Spans)
+	}
+}
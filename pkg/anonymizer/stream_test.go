@@ -0,0 +1,152 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mrlyc/inu/pkg/anonymizer/anonymizertest"
+)
+
+// notifyWriter signals every write on a channel; writes block until the signal is received.
+type notifyWriter struct {
+	buf    bytes.Buffer
+	writes chan string
+}
+
+func (w *notifyWriter) Write(p []byte) (int, error) {
+	w.writes <- string(p)
+	return w.buf.Write(p)
+}
+
+// TestAnonymize_StreamsBeforeCompletion tests that text is written while the stream is still running.
+func TestAnonymize_StreamsBeforeCompletion(t *testing.T) {
+	response := anonymizertest.PairResponse("<个人信息[0].姓名.全名>来了", map[string][]string{
+		"<个人信息[0].姓名.全名>": {"张三"},
+	}, 2)
+	response.Delay = 10 * time.Millisecond
+	chatModel := anonymizertest.NewChatModel(response)
+
+	anon, err := NewHashHidePair(chatModel)
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	writer := &notifyWriter{writes: make(chan string)}
+	done := make(chan error, 1)
+	go func() {
+		_, err := anon.Anonymize(context.Background(), []string{"个人信息"}, "张三来了", writer)
+		done <- err
+	}()
+
+	select {
+	case <-writer.writes:
+	case err := <-done:
+		t.Fatalf("expected output before the stream completed, got %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for streamed output")
+	}
+
+	// Drain the remaining writes
+	go func() {
+		for range writer.writes {
+		}
+	}()
+	err = <-done
+	close(writer.writes)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+	if writer.buf.String() != "<个人信息[0].姓名.全名>来了" {
+		t.Errorf("unexpected output: %q", writer.buf.String())
+	}
+}
+
+// TestAnonymize_StreamError tests that a mid-stream error is returned.
+func TestAnonymize_StreamError(t *testing.T) {
+	streamErr := errors.New("connection reset")
+	chatModel := anonymizertest.NewChatModel(anonymizertest.Response{
+		Tokens:    []string{"<个人信息[0].姓名.全名>", "来了\n"},
+		StreamErr: streamErr,
+	})
+
+	anon, err := NewHashHidePair(chatModel)
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	var buf bytes.Buffer
+	_, err = anon.Anonymize(context.Background(), []string{"个人信息"}, "张三来了", &buf)
+	if !errors.Is(err, streamErr) {
+		t.Errorf("expected stream error, got %v", err)
+	}
+}
+
+// TestAnonymize_StreamCanceled tests that canceling the context stops a slow stream.
+func TestAnonymize_StreamCanceled(t *testing.T) {
+	response := anonymizertest.PairResponse("<个人信息[0].姓名.全名>来了", nil, 1)
+	response.Delay = time.Second
+	chatModel := anonymizertest.NewChatModel(response)
+
+	anon, err := NewHashHidePair(chatModel)
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	var buf bytes.Buffer
+	_, err = anon.Anonymize(ctx, []string{"个人信息"}, "张三来了", &buf)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+// TestAnonymize_StreamRetry tests that a malformed streamed reply is retried over the stream path.
+func TestAnonymize_StreamRetry(t *testing.T) {
+	chatModel := anonymizertest.NewChatModel(
+		anonymizertest.Tokens("<个人信息[0].姓名.全名>", "来了"),
+		anonymizertest.PairResponse("<个人信息[0].姓名.全名>来了", map[string][]string{
+			"<个人信息[0].姓名.全名>": {"张三"},
+		}, 3),
+	)
+
+	anon, err := NewHashHidePair(chatModel, WithRetry(&RetryConfig{MaxAttempts: 2}))
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(context.Background(), []string{"个人信息"}, "张三来了", &buf)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+	if chatModel.Calls() != 2 || len(entities) != 1 {
+		t.Errorf("expected 2 calls and 1 entity, got %d calls and %d entities", chatModel.Calls(), len(entities))
+	}
+	if buf.String() != "<个人信息[0].姓名.全名>来了" {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+	if requests := chatModel.Requests(); len(requests[1]) != 3 {
+		t.Errorf("expected the repair request to contain 3 messages, got %d", len(requests[1]))
+	}
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/prompt"
+	"github.com/cloudwego/eino/schema"
+	"github.com/rotisserie/eris"
+)
+
+// structuredToolName is the name of the tool the model must call with the anonymization result.
+const structuredToolName = "submit_anonymization"
+
+// structuredResult is the argument object of the submit_anonymization tool call.
+type structuredResult struct {
+	AnonymizedText *string           `json:"anonymized_text"`
+	Mapping        []structuredEntry `json:"mapping"`
+}
+
+// structuredEntry is one placeholder and its original values.
+type structuredEntry struct {
+	Key    string   `json:"key"`
+	Values []string `json:"values"`
+}
+
+// Structured 是基于工具调用 (结构化输出) 的 Anonymizer 实现。
+// 它强制模型调用 submit_anonymization 工具，以 JSON 对象返回脱敏文本和实体映射：
+//
+//	{"anonymized_text": "...", "mapping": [{"key": "<个人信息[0].姓名.全名>", "values": ["张三"]}]}
+//
+// 与 HasHidePair 相比不依赖 <<<PAIR>>> 文本协议，但不支持流式输出，
+// 脱敏文本在模型返回完整结果后一次性写入。模型必须支持工具调用。
+type Structured struct {
+	anonymizeTemplate *prompt.DefaultChatTemplate
+	llm               model.ToolCallingChatModel
+	entityTypes       *EntityTypeSchema
+	terms             *TermLists
+}
+
+// StructuredOption configures a Structured.
+type StructuredOption func(*Structured)
+
+// WithStructuredEntityTypeSchema sets the definitions of the entity types described in the prompt
+// (DefaultEntityTypeSchema by default), like WithEntityTypeSchema does for HasHidePair.
+func WithStructuredEntityTypeSchema(entityTypes *EntityTypeSchema) StructuredOption {
+	return func(s *Structured) {
+		s.entityTypes = entityTypes
+	}
+}
+
+// WithStructuredTermLists describes the allow and deny terms in the prompt, like WithTermLists does for HasHidePair.
+func WithStructuredTermLists(lists *TermLists) StructuredOption {
+	return func(s *Structured) {
+		s.terms = lists
+	}
+}
+
+// structuredTool describes the submit_anonymization tool.
+func structuredTool() *schema.ToolInfo {
+	return &schema.ToolInfo{
+		Name: structuredToolName,
+		Desc: "Submit the anonymized text and the tag-to-original mapping.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"anonymized_text": {
+				Type:     schema.String,
+				Desc:     "The input text with every sensitive entity replaced by its tag.",
+				Required: true,
+			},
+			"mapping": {
+				Type:     schema.Array,
+				Desc:     "One item per tag used in anonymized_text; empty if nothing was found.",
+				Required: true,
+				ElemInfo: &schema.ParameterInfo{
+					Type: schema.Object,
+					SubParams: map[string]*schema.ParameterInfo{
+						"key": {
+							Type:     schema.String,
+							Desc:     "The tag in the format <EntityType[ID].Category.Detail>.",
+							Required: true,
+						},
+						"values": {
+							Type:     schema.Array,
+							Desc:     "The original values replaced by the tag.",
+							Required: true,
+							ElemInfo: &schema.ParameterInfo{Type: schema.String},
+						},
+					},
+				},
+			},
+		}),
+	}
+}
+
+// Anonymize anonymizes the given text by forcing the model to call the submit_anonymization tool.
+// The anonymized text is written to writer once the complete result has been received and validated.
+func (s *Structured) Anonymize(ctx context.Context, types []string, text string, writer io.Writer) ([]*Entity, error) {
+	encodedTypes, err := json.Marshal(types)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to marshal types")
+	}
+
+	messages, err := s.anonymizeTemplate.Format(ctx, map[string]any{
+		"types":       string(encodedTypes),
+		"definitions": s.entityTypes.describe(types),
+		"terms":       s.terms.describe(),
+		"text":        text,
+	})
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to format message")
+	}
+
+	response, err := s.llm.Generate(ctx, messages, model.WithToolChoice(schema.ToolChoiceForced))
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to generate response")
+	}
+
+	anonymizedText, entities, err := parseStructuredResponse(response)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.WriteString(writer, anonymizedText); err != nil {
+		return nil, eris.Wrap(err, "failed to write to output")
+	}
+
+	return entities, nil
+}
+
+// RestoreText restores the original text from the anonymized text using the provided entities.
+func (s *Structured) RestoreText(ctx context.Context, entities []*Entity, text string, writer io.Writer) ([]RestoreFailure, error) {
+	return restoreText(entities, text, writer)
+}
+
+// parseStructuredResponse extracts and validates the tool call arguments.
+// Models that ignore the forced tool choice and reply with the JSON object as content are accepted as well.
+func parseStructuredResponse(response *schema.Message) (string, []*Entity, error) {
+	arguments := strings.TrimSpace(response.Content)
+	for _, call := range response.ToolCalls {
+		if call.Function.Name == structuredToolName {
+			arguments = call.Function.Arguments
+			break
+		}
+	}
+	if arguments == "" {
+		return "", nil, fmt.Errorf("model did not call %s", structuredToolName)
+	}
+
+	var result structuredResult
+	if err := json.Unmarshal([]byte(arguments), &result); err != nil {
+		return "", nil, eris.Wrapf(err, "failed to unmarshal %s arguments: %s", structuredToolName, arguments)
+	}
+	if result.AnonymizedText == nil {
+		return "", nil, fmt.Errorf("missing anonymized_text in %s arguments", structuredToolName)
+	}
+
+	entities := make([]*Entity, 0, len(result.Mapping))
+	seen := make(map[string]*Entity, len(result.Mapping))
+	for _, entry := range result.Mapping {
+		matches := entityKeyRegex.FindStringSubmatch(entry.Key)
+		if len(matches) != 5 {
+			return "", nil, fmt.Errorf("invalid key format: %s", entry.Key)
+		}
+
+		// The same tag may be listed more than once, merge its values
+		if entity, ok := seen[entry.Key]; ok {
+			entity.Values = append(entity.Values, entry.Values...)
+			continue
+		}
+
+		entity := &Entity{
+			Key:        entry.Key,
+			EntityType: matches[1],
+			ID:         matches[2],
+			Category:   matches[3],
+			Detail:     matches[4],
+			Values:     append([]string{}, entry.Values...),
+		}
+		seen[entry.Key] = entity
+		entities = append(entities, entity)
+	}
+
+	return *result.AnonymizedText, entities, nil
+}
+
+// NewStructured 创建一个基于工具调用 (结构化输出) 的 Anonymizer 实现。
+// chatModel 必须实现 model.ToolCallingChatModel；不支持工具调用的模型请使用 NewHashHidePair。
+func NewStructured(chatModel model.BaseChatModel, opts ...StructuredOption) (Anonymizer, error) {
+	toolModel, ok := chatModel.(model.ToolCallingChatModel)
+	if !ok {
+		return nil, fmt.Errorf("chat model %T does not support tool calling", chatModel)
+	}
+
+	llm, err := toolModel.WithTools([]*schema.ToolInfo{structuredTool()})
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to bind anonymization tool")
+	}
+
+	anonymizeTemplate := prompt.FromMessages(schema.FString,
+		schema.UserMessage(`Anonymize the text with the given entity types by replacing every sensitive entity with a tag in the format <EntityType[ID].Category.Detail>, then call `+structuredToolName+` with the anonymized text and the tag-to-original mapping; if nothing is found, submit the text unchanged with an empty mapping.
+Specified types: {types}
+{definitions}{terms}<text>{text}</text>`),
+	)
+
+	s := &Structured{
+		anonymizeTemplate: anonymizeTemplate,
+		llm:               llm,
+		entityTypes:       DefaultEntityTypeSchema,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.terms != nil {
+		if err := s.terms.Validate(); err != nil {
+			return nil, eris.Wrap(err, "invalid term lists")
+		}
+	}
+
+	return s, nil
+}
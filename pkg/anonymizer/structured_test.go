@@ -0,0 +1,125 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// TestStructured_Anonymize tests anonymization through the submit_anonymization tool call.
+func TestStructured_Anonymize(t *testing.T) {
+	mockLLM := newMockWithResponse(newMockToolCallResponse(structuredToolName, `{
+		"anonymized_text": "<个人信息[0].姓名.全名>在<组织机构[0].公司.全名>工作",
+		"mapping": [
+			{"key": "<个人信息[0].姓名.全名>", "values": ["张三"]},
+			{"key": "<组织机构[0].公司.全名>", "values": ["ABC Tech"]},
+			{"key": "<个人信息[0].姓名.全名>", "values": ["老张"]}
+		]
+	}`))
+
+	anon, err := NewStructured(mockLLM)
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+	if len(mockLLM.Tools()) != 1 || mockLLM.Tools()[0].Name != structuredToolName {
+		t.Fatalf("expected the %s tool to be bound, got %+v", structuredToolName, mockLLM.Tools())
+	}
+
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(context.Background(), []string{"个人信息", "组织机构"}, "张三在 ABC Tech 工作", &buf)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+
+	if buf.String() != "<个人信息[0].姓名.全名>在<组织机构[0].公司.全名>工作" {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+	if len(entities) != 2 {
+		t.Fatalf("expected 2 entities, got %d", len(entities))
+	}
+	if entities[0].EntityType != "个人信息" || len(entities[0].Values) != 2 {
+		t.Errorf("expected duplicate keys to be merged, got %+v", entities[0])
+	}
+}
+
+// TestStructured_ContentFallback tests that a JSON object in the content is accepted.
+func TestStructured_ContentFallback(t *testing.T) {
+	mockLLM := newMockWithResponse(&schema.Message{
+		Role:    schema.Assistant,
+		Content: `{"anonymized_text": "nothing here", "mapping": []}`,
+	})
+
+	anon, err := NewStructured(mockLLM)
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(context.Background(), []string{"个人信息"}, "nothing here", &buf)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+	if buf.String() != "nothing here" || len(entities) != 0 {
+		t.Errorf("unexpected result: %q, %+v", buf.String(), entities)
+	}
+}
+
+// TestStructured_InvalidResponse tests that malformed tool arguments are rejected.
+func TestStructured_InvalidResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response *schema.Message
+	}{
+		{
+			name:     "No tool call",
+			response: &schema.Message{Role: schema.Assistant},
+		},
+		{
+			name:     "Invalid JSON",
+			response: newMockToolCallResponse(structuredToolName, `{"anonymized_text": `),
+		},
+		{
+			name:     "Missing anonymized text",
+			response: newMockToolCallResponse(structuredToolName, `{"mapping": []}`),
+		},
+		{
+			name:     "Invalid key",
+			response: newMockToolCallResponse(structuredToolName, `{"anonymized_text": "x", "mapping": [{"key": "<bad>", "values": ["x"]}]}`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anon, err := NewStructured(newMockWithResponse(tt.response))
+			if err != nil {
+				t.Fatalf("Failed to create anonymizer: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if _, err := anon.Anonymize(context.Background(), []string{"个人信息"}, "x", &buf); err == nil {
+				t.Error("expected error")
+			}
+			if buf.Len() != 0 {
+				t.Errorf("expected no output, got %q", buf.String())
+			}
+		})
+	}
+}
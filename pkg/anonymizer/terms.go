@@ -0,0 +1,371 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rotisserie/eris"
+)
+
+const (
+	// DefaultDenyCategory is the placeholder category of deny terms that do not set one
+	DefaultDenyCategory = "词条"
+	// DefaultDenyDetail is the placeholder detail of deny terms that do not set one
+	DefaultDenyDetail = "名称"
+)
+
+// DenyTerm 是一个必须脱敏的词条，以及替换它的占位符的实体类型、类别和细节。
+type DenyTerm struct {
+	Value string `json:"value" yaml:"value" mapstructure:"value"`
+	Type  string `json:"type" yaml:"type" mapstructure:"type"`
+	// Category 和 Detail 为空时使用 DefaultDenyCategory 和 DefaultDenyDetail
+	Category string `json:"category,omitempty" yaml:"category,omitempty" mapstructure:"category"`
+	Detail   string `json:"detail,omitempty" yaml:"detail,omitempty" mapstructure:"detail"`
+}
+
+// TermLists 是覆盖检测结果的词条名单，可以从文件加载 (见 cli.LoadTermLists)。
+//   - Allow (白名单) 中的词条永远不脱敏，如公司名称和公开的产品名称
+//   - Deny (黑名单) 中的词条总是以指定的实体类型脱敏，如内部项目代号
+//
+// 名单既写入提示词，也由 ApplyTermLists 在脱敏结果上确定性地执行。
+// 比较时忽略空白、全半角和大小写的差异。
+type TermLists struct {
+	Allow []string   `json:"allow,omitempty" yaml:"allow,omitempty" mapstructure:"allow"`
+	Deny  []DenyTerm `json:"deny,omitempty" yaml:"deny,omitempty" mapstructure:"deny"`
+}
+
+// Validate checks if the lists are valid.
+func (l *TermLists) Validate() error {
+	allowed := make(map[string]bool, len(l.Allow))
+	for i, term := range l.Allow {
+		normalized := normalizeValue(term)
+		if normalized == "" {
+			return fmt.Errorf("allow term %d must not be empty", i)
+		}
+		allowed[normalized] = true
+	}
+
+	denied := make(map[string]string, len(l.Deny))
+	for i, term := range l.Deny {
+		normalized := normalizeValue(term.Value)
+		if normalized == "" {
+			return fmt.Errorf("deny term %d must have a value", i)
+		}
+		if strings.TrimSpace(term.Type) == "" {
+			return fmt.Errorf("deny term %s must have a type", term.Value)
+		}
+		for _, part := range []string{term.Type, term.Category, term.Detail} {
+			if strings.ContainsAny(part, "<>[].") {
+				return fmt.Errorf("type, category and detail of deny term %s must not contain <, >, [, ] or '.': %s", term.Value, part)
+			}
+		}
+		if allowed[normalized] {
+			return fmt.Errorf("term is both allowed and denied: %s", term.Value)
+		}
+		if entityType, ok := denied[normalized]; ok && entityType != term.Type {
+			return fmt.Errorf("deny term %s has conflicting types: %s, %s", term.Value, entityType, term.Type)
+		}
+		denied[normalized] = term.Type
+	}
+	return nil
+}
+
+// IsEmpty returns true if the lists contain no term.
+func (l *TermLists) IsEmpty() bool {
+	return l == nil || (len(l.Allow) == 0 && len(l.Deny) == 0)
+}
+
+// isAllowed returns true if the value matches an allow term.
+func (l *TermLists) isAllowed(value string) bool {
+	normalized := normalizeValue(value)
+	for _, term := range l.Allow {
+		if normalizeValue(term) == normalized {
+			return true
+		}
+	}
+	return false
+}
+
+// describe renders the lists for the prompt, an empty string if there is no term.
+func (l *TermLists) describe() string {
+	if l.IsEmpty() {
+		return ""
+	}
+
+	var builder strings.Builder
+	if len(l.Allow) > 0 {
+		encoded, _ := json.Marshal(l.Allow)
+		fmt.Fprintf(&builder, "Never anonymize these terms, keep them unchanged: %s\n", encoded)
+	}
+	if len(l.Deny) > 0 {
+		builder.WriteString("Always anonymize these terms with the given tag:\n")
+		for _, term := range l.Deny {
+			category, detail := term.placeholderParts()
+			fmt.Fprintf(&builder, "- %s: <%s[ID].%s.%s>\n", term.Value, term.Type, category, detail)
+		}
+	}
+	return builder.String()
+}
+
+// placeholderParts returns the category and detail of the placeholder, with defaults.
+func (t *DenyTerm) placeholderParts() (string, string) {
+	category, detail := t.Category, t.Detail
+	if category == "" {
+		category = DefaultDenyCategory
+	}
+	if detail == "" {
+		detail = DefaultDenyDetail
+	}
+	return category, detail
+}
+
+// ApplyTermLists 在脱敏结果上确定性地执行词条名单，返回修正后的脱敏文本和实体：
+//   - 值在白名单中的占位符还原为原文，这些值从实体中移除，没有剩余值的实体被删除
+//   - 脱敏文本中残留的黑名单词条替换为占位符：已有同类型实体包含该值时复用其占位符，否则新建实体
+//
+// 白名单按实体值整体匹配，不会拆分包含白名单词条的更长实体值；黑名单按子串匹配，
+// 不会改写占位符内部的文本。传入的实体不会被修改，返回的实体不带 Spans。
+func ApplyTermLists(original, anonymized string, entities []*Entity, lists *TermLists) (string, []*Entity) {
+	result := make([]*Entity, 0, len(entities))
+	for _, entity := range entities {
+		copied := *entity
+		copied.Values = append([]string(nil), entity.Values...)
+		copied.Spans = nil
+		result = append(result, &copied)
+	}
+	if lists.IsEmpty() {
+		return anonymized, result
+	}
+
+	text, result := applyAllowList(original, anonymized, result, lists)
+	return applyDenyList(text, result, lists)
+}
+
+// applyAllowList restores the placeholders of allowed values and removes the values from the entities.
+func applyAllowList(original, anonymized string, entities []*Entity, lists *TermLists) (string, []*Entity) {
+	if len(lists.Allow) == 0 {
+		return anonymized, entities
+	}
+
+	// Entities with at least one allowed value, by normalized key
+	affected := make(map[string]*Entity)
+	fullyAllowed := make(map[*Entity]bool)
+	for _, entity := range entities {
+		allowed := 0
+		for _, value := range entity.Values {
+			if lists.isAllowed(value) {
+				allowed++
+			}
+		}
+		if allowed > 0 {
+			affected[normalizePlaceholder(entity.Key)] = entity
+			fullyAllowed[entity] = allowed == len(entity.Values)
+		}
+	}
+	if len(affected) == 0 {
+		return anonymized, entities
+	}
+
+	// Spans tell which value each occurrence of a placeholder replaced
+	ComputeSpans(original, anonymized, entities)
+	occurrences := make(map[int]string)
+	for _, entity := range affected {
+		for _, span := range entity.Spans {
+			occurrences[span.AnonymizedStart] = span.Value
+		}
+	}
+
+	offsets := &runeOffsets{text: anonymized}
+	var builder strings.Builder
+	lastIndex := 0
+	for _, match := range placeholderRegex.FindAllStringIndex(anonymized, -1) {
+		entity, ok := affected[normalizePlaceholder(anonymized[match[0]:match[1]])]
+		if !ok {
+			continue
+		}
+
+		value, located := occurrences[offsets.at(match[0])]
+		switch {
+		case located && lists.isAllowed(value):
+			// Restore the exact text the placeholder replaced
+		case !located && fullyAllowed[entity]:
+			value = entity.Values[0]
+		default:
+			continue
+		}
+
+		builder.WriteString(anonymized[lastIndex:match[0]])
+		builder.WriteString(value)
+		lastIndex = match[1]
+	}
+	builder.WriteString(anonymized[lastIndex:])
+
+	kept := make([]*Entity, 0, len(entities))
+	for _, entity := range entities {
+		entity.Spans = nil
+		if _, ok := affected[normalizePlaceholder(entity.Key)]; !ok {
+			kept = append(kept, entity)
+			continue
+		}
+
+		values := entity.Values[:0]
+		for _, value := range entity.Values {
+			if !lists.isAllowed(value) {
+				values = append(values, value)
+			}
+		}
+		entity.Values = values
+		if len(values) > 0 {
+			kept = append(kept, entity)
+		}
+	}
+
+	return builder.String(), kept
+}
+
+// applyDenyList masks the deny terms left in the anonymized text.
+func applyDenyList(text string, entities []*Entity, lists *TermLists) (string, []*Entity) {
+	if len(lists.Deny) == 0 {
+		return text, entities
+	}
+
+	ids := newEntityMerger()
+	for _, entity := range entities {
+		ids.claimID(entity.EntityType, entity.ID)
+	}
+
+	// Candidates searched in the text, by key; new entities are only added when their term occurs
+	targets := make(map[string]*Entity, len(lists.Deny))
+	candidates := make([]*Entity, 0, len(lists.Deny))
+	var added []*Entity
+	for _, term := range lists.Deny {
+		target := findEntityByValue(entities, term.Type, term.Value)
+		if target == nil {
+			target = findEntityByValue(added, term.Type, term.Value)
+		}
+		if target == nil {
+			category, detail := term.placeholderParts()
+			// IDs start at 1 like the IDs of the engines
+			id := ids.nextID(term.Type)
+			target = &Entity{
+				Key:        formatEntityKey(term.Type, id, category, detail),
+				EntityType: term.Type,
+				ID:         id,
+				Category:   category,
+				Detail:     detail,
+				Values:     []string{term.Value},
+			}
+			added = append(added, target)
+		}
+
+		targets[target.Key] = target
+		candidates = append(candidates, &Entity{Key: target.Key, Values: []string{term.Value}})
+	}
+
+	remasked, report := VerifyAnonymized(text, candidates, true)
+	if !report.HasLeaks() {
+		return text, entities
+	}
+
+	used := make(map[*Entity]bool)
+	for _, leak := range report.Leaks {
+		target := targets[leak.Placeholder]
+		used[target] = true
+		if !containsString(target.Values, leak.Text) {
+			target.Values = append(target.Values, leak.Text)
+		}
+	}
+	for _, entity := range added {
+		if used[entity] {
+			entities = append(entities, entity)
+		}
+	}
+
+	return remasked, entities
+}
+
+// findEntityByValue returns the entity of the type having the value, compared like normalizeValue.
+func findEntityByValue(entities []*Entity, entityType, value string) *Entity {
+	normalized := normalizeValue(value)
+	for _, entity := range entities {
+		if entity.EntityType != entityType {
+			continue
+		}
+		for _, v := range entity.Values {
+			if normalizeValue(v) == normalized {
+				return entity
+			}
+		}
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// TermFiltered 是执行词条名单的 Anonymizer 包装：它把内部 Anonymizer 的结果交给 ApplyTermLists 修正。
+// 修正需要完整的脱敏文本和实体映射，因此输出会在内部 Anonymizer 完成后一次性写入 writer。
+type TermFiltered struct {
+	inner Anonymizer
+	lists *TermLists
+}
+
+// Anonymize anonymizes the text with the wrapped Anonymizer and applies the term lists to the result.
+func (f *TermFiltered) Anonymize(ctx context.Context, types []string, text string, writer io.Writer) ([]*Entity, error) {
+	var output bytes.Buffer
+	entities, err := f.inner.Anonymize(ctx, types, text, &output)
+	if err != nil {
+		return nil, err
+	}
+
+	anonymized, entities := ApplyTermLists(text, output.String(), entities, f.lists)
+	if _, err := io.WriteString(writer, anonymized); err != nil {
+		return nil, eris.Wrap(err, "failed to write to output")
+	}
+
+	return entities, nil
+}
+
+// RestoreText restores the text with the wrapped Anonymizer.
+func (f *TermFiltered) RestoreText(ctx context.Context, entities []*Entity, text string, writer io.Writer) ([]RestoreFailure, error) {
+	return f.inner.RestoreText(ctx, entities, text, writer)
+}
+
+// NewTermFiltered 创建一个执行词条名单的 Anonymizer 包装。
+// 名单同时写入 LLM 提示词时效果更好，见 WithTermLists 和 WithStructuredTermLists。
+func NewTermFiltered(inner Anonymizer, lists *TermLists) (Anonymizer, error) {
+	if lists == nil {
+		return nil, fmt.Errorf("term lists must not be nil")
+	}
+	if err := lists.Validate(); err != nil {
+		return nil, eris.Wrap(err, "invalid term lists")
+	}
+
+	return &TermFiltered{inner: inner, lists: lists}, nil
+}
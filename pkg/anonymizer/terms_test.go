@@ -0,0 +1,228 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mrlyc/inu/pkg/anonymizer/anonymizertest"
+)
+
+func TestTermLists_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		lists   *TermLists
+		wantErr bool
+	}{
+		{
+			name:  "valid lists",
+			lists: &TermLists{Allow: []string{"某某科技"}, Deny: []DenyTerm{{Value: "星火计划", Type: "业务信息"}}},
+		},
+		{
+			name:    "empty allow term",
+			lists:   &TermLists{Allow: []string{" "}},
+			wantErr: true,
+		},
+		{
+			name:    "deny term without type",
+			lists:   &TermLists{Deny: []DenyTerm{{Value: "星火计划"}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid placeholder part",
+			lists:   &TermLists{Deny: []DenyTerm{{Value: "星火计划", Type: "业务信息", Category: "项目.代号"}}},
+			wantErr: true,
+		},
+		{
+			name:    "term both allowed and denied",
+			lists:   &TermLists{Allow: []string{"Apollo"}, Deny: []DenyTerm{{Value: "apollo", Type: "业务信息"}}},
+			wantErr: true,
+		},
+		{
+			name: "deny term with conflicting types",
+			lists: &TermLists{Deny: []DenyTerm{
+				{Value: "星火计划", Type: "业务信息"},
+				{Value: "星火计划", Type: "组织机构"},
+			}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.lists.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyTermLists_Allow(t *testing.T) {
+	original := "张三在某某科技工作，某某科技和风控部合作"
+	anonymized := "<个人信息[0].姓名.全名>在<组织机构[0].公司.名称>工作，<组织机构[0].公司.名称>和<组织机构[1].部门.名称>合作"
+	entities := []*Entity{
+		{Key: "<个人信息[0].姓名.全名>", EntityType: "个人信息", ID: "0", Category: "姓名", Detail: "全名", Values: []string{"张三"}},
+		{Key: "<组织机构[0].公司.名称>", EntityType: "组织机构", ID: "0", Category: "公司", Detail: "名称", Values: []string{"某某科技"}},
+		{Key: "<组织机构[1].部门.名称>", EntityType: "组织机构", ID: "1", Category: "部门", Detail: "名称", Values: []string{"风控部"}},
+	}
+	lists := &TermLists{Allow: []string{"某某 科技"}}
+
+	text, result := ApplyTermLists(original, anonymized, entities, lists)
+
+	expected := "<个人信息[0].姓名.全名>在某某科技工作，某某科技和<组织机构[1].部门.名称>合作"
+	if text != expected {
+		t.Errorf("expected %q, got %q", expected, text)
+	}
+	if len(result) != 2 || result[0].Key != "<个人信息[0].姓名.全名>" || result[1].Key != "<组织机构[1].部门.名称>" {
+		t.Errorf("expected the allowed entity to be removed, got %+v", result)
+	}
+	if len(entities) != 3 || len(entities[1].Values) != 1 {
+		t.Errorf("expected the input entities to be unchanged, got %+v", entities)
+	}
+}
+
+func TestApplyTermLists_AllowOneValueOfEntity(t *testing.T) {
+	original := "Inu 也叫 inu-internal"
+	anonymized := "<业务信息[0].系统.名称> 也叫 <业务信息[0].系统.名称>"
+	entities := []*Entity{
+		{Key: "<业务信息[0].系统.名称>", EntityType: "业务信息", ID: "0", Category: "系统", Detail: "名称", Values: []string{"Inu", "inu-internal"}},
+	}
+
+	text, result := ApplyTermLists(original, anonymized, entities, &TermLists{Allow: []string{"inu"}})
+
+	if text != "Inu 也叫 <业务信息[0].系统.名称>" {
+		t.Errorf("unexpected text: %q", text)
+	}
+	if len(result) != 1 || !reflect.DeepEqual(result[0].Values, []string{"inu-internal"}) {
+		t.Errorf("expected only the allowed value to be removed, got %+v", result)
+	}
+}
+
+func TestApplyTermLists_Deny(t *testing.T) {
+	original := "张三负责星火计划，星火 计划下周上线，Apollo 已暂停"
+	anonymized := "<个人信息[0].姓名.全名>负责星火计划，星火 计划下周上线，Apollo 已暂停"
+	entities := []*Entity{
+		{Key: "<个人信息[0].姓名.全名>", EntityType: "个人信息", ID: "0", Category: "姓名", Detail: "全名", Values: []string{"张三"}},
+		{Key: "<业务信息[1].项目.代号>", EntityType: "业务信息", ID: "0", Category: "项目", Detail: "代号", Values: []string{"apollo"}},
+	}
+	lists := &TermLists{Deny: []DenyTerm{
+		{Value: "星火计划", Type: "业务信息"},
+		{Value: "Apollo", Type: "业务信息"},
+		{Value: "天枢", Type: "业务信息"},
+	}}
+
+	text, result := ApplyTermLists(original, anonymized, entities, lists)
+
+	expected := "<个人信息[0].姓名.全名>负责<业务信息[1].词条.名称>，<业务信息[1].词条.名称>下周上线，<业务信息[1].项目.代号> 已暂停"
+	if text != expected {
+		t.Errorf("expected %q, got %q", expected, text)
+	}
+
+	// The existing entity is reused, only the deny terms found in the text add an entity
+	if len(result) != 3 {
+		t.Fatalf("expected 3 entities, got %+v", result)
+	}
+	if !reflect.DeepEqual(result[1].Values, []string{"apollo", "Apollo"}) {
+		t.Errorf("expected the leaked text to be added to the existing entity, got %v", result[1].Values)
+	}
+	added := result[2]
+	if added.Key != "<业务信息[1].词条.名称>" || !reflect.DeepEqual(added.Values, []string{"星火计划", "星火 计划"}) {
+		t.Errorf("unexpected new entity: %+v", added)
+	}
+}
+
+func TestTermFiltered_Anonymize(t *testing.T) {
+	chatModel := anonymizertest.NewChatModel(anonymizertest.PairResponse(
+		"<组织机构[0].公司.名称>的星火计划",
+		map[string][]string{"<组织机构[0].公司.名称>": {"某某科技"}},
+		2,
+	))
+	lists := &TermLists{
+		Allow: []string{"某某科技"},
+		Deny:  []DenyTerm{{Value: "星火计划", Type: "业务信息", Category: "项目", Detail: "代号"}},
+	}
+
+	llm, err := NewHashHidePair(chatModel, WithTermLists(lists))
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+	anon, err := NewTermFiltered(llm, lists)
+	if err != nil {
+		t.Fatalf("Failed to create term filter: %v", err)
+	}
+
+	text := "某某科技的星火计划"
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(context.Background(), []string{"组织机构", "业务信息"}, text, &buf)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+
+	if buf.String() != "某某科技的<业务信息[1].项目.代号>" {
+		t.Errorf("unexpected anonymized text: %q", buf.String())
+	}
+	if len(entities) != 1 || entities[0].Key != "<业务信息[1].项目.代号>" {
+		t.Errorf("unexpected entities: %+v", entities)
+	}
+
+	prompt := chatModel.Requests()[0][0].Content
+	if !strings.Contains(prompt, `Never anonymize these terms, keep them unchanged: ["某某科技"]`) ||
+		!strings.Contains(prompt, "- 星火计划: <业务信息[ID].项目.代号>\n<text>") {
+		t.Errorf("expected the terms in the prompt, got %q", prompt)
+	}
+
+	var restored bytes.Buffer
+	if _, err := anon.RestoreText(context.Background(), entities, buf.String(), &restored); err != nil {
+		t.Fatalf("RestoreText failed: %v", err)
+	}
+	if restored.String() != text {
+		t.Errorf("expected %q, got %q", text, restored.String())
+	}
+}
+
+func TestStructured_PromptDescribesTerms(t *testing.T) {
+	chatModel := anonymizertest.NewChatModel(anonymizertest.Tokens(`{"anonymized_text": "某某科技", "mapping": []}`))
+	anon, err := NewStructured(chatModel, WithStructuredTermLists(&TermLists{Allow: []string{"某某科技"}}))
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	if _, err := anon.Anonymize(context.Background(), []string{"组织机构"}, "某某科技", io.Discard); err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+	prompt := chatModel.Requests()[0][0].Content
+	if !strings.Contains(prompt, `keep them unchanged: ["某某科技"]`) {
+		t.Errorf("expected the allow terms in the prompt, got %q", prompt)
+	}
+}
+
+func TestNewTermFiltered_InvalidLists(t *testing.T) {
+	rules, err := NewRuleBased(nil)
+	if err != nil {
+		t.Fatalf("Failed to create rule-based anonymizer: %v", err)
+	}
+
+	if _, err := NewTermFiltered(rules, &TermLists{Deny: []DenyTerm{{Value: "星火计划"}}}); err == nil {
+		t.Error("expected an error for a deny term without type")
+	}
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Validation issue kinds.
+const (
+	// IssueMissingMapping 表示脱敏文本中的占位符在实体映射中不存在，无法还原
+	IssueMissingMapping = "missing_mapping"
+	// IssueHallucinatedValue 表示实体值没有出现在原始文本中
+	IssueHallucinatedValue = "hallucinated_value"
+	// IssueUnusedMapping 表示实体映射中的占位符没有出现在脱敏文本中
+	IssueUnusedMapping = "unused_mapping"
+)
+
+// ValidationIssue 描述 LLM 返回的实体映射与文本之间的一处不一致。
+type ValidationIssue struct {
+	// Kind 是问题类型: "missing_mapping", "hallucinated_value" 或 "unused_mapping"
+	Kind string `json:"kind"`
+	// Placeholder 是相关的占位符
+	Placeholder string `json:"placeholder"`
+	// Value 是相关的实体值 (仅 hallucinated_value)
+	Value string `json:"value,omitempty"`
+}
+
+// IsFatal returns true if the issue makes the result unrestorable or wrong.
+// Unused mappings are harmless for restoration and only reported as warnings.
+func (i ValidationIssue) IsFatal() bool {
+	return i.Kind != IssueUnusedMapping
+}
+
+// String returns a human readable description of the issue.
+func (i ValidationIssue) String() string {
+	switch i.Kind {
+	case IssueMissingMapping:
+		return fmt.Sprintf("%s is not in the entity mapping", i.Placeholder)
+	case IssueHallucinatedValue:
+		return fmt.Sprintf("%s maps to %q which does not occur in the original text", i.Placeholder, i.Value)
+	case IssueUnusedMapping:
+		return fmt.Sprintf("%s does not occur in the anonymized text", i.Placeholder)
+	}
+	return fmt.Sprintf("%s: %s", i.Kind, i.Placeholder)
+}
+
+// ValidationError is returned when the LLM result fails validation.
+type ValidationError struct {
+	Issues []ValidationIssue
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		messages = append(messages, issue.String())
+	}
+	return fmt.Sprintf("invalid entity mapping: %s", strings.Join(messages, "; "))
+}
+
+// ValidateEntities cross-checks the entity mapping against the original and anonymized text:
+//   - every entity-key placeholder in the anonymized text must exist in the mapping (pseudonyms count as
+//     occurrences of their entity)
+//     (placeholders that already occur verbatim in the original text are ignored)
+//   - every entity value must occur in the original text (ignoring width, case and whitespace)
+//   - every mapping key should occur in the anonymized text
+//
+// It returns the entities with hallucinated values removed (entities left without values are dropped)
+// together with all issues found.
+func ValidateEntities(original, anonymized string, entities []*Entity) ([]*Entity, []ValidationIssue) {
+	var issues []ValidationIssue
+	normalizedOriginal := normalizeValue(original)
+
+	// Placeholders present in the anonymized text
+	used := make(map[string]bool)
+	var usedOrder []string
+	for _, mark := range findEntityMarks(anonymized, entities) {
+		placeholder := mark.placeholder
+		if !entityKeyRegex.MatchString(placeholder) || strings.Contains(original, placeholder) {
+			continue
+		}
+		key := normalizePlaceholder(placeholder)
+		if !used[key] {
+			used[key] = true
+			usedOrder = append(usedOrder, key)
+		}
+	}
+
+	valid := make([]*Entity, 0, len(entities))
+	mapped := make(map[string]bool, len(entities))
+	for _, entity := range entities {
+		key := normalizePlaceholder(entity.Key)
+
+		values := make([]string, 0, len(entity.Values))
+		for _, value := range entity.Values {
+			if strings.Contains(normalizedOriginal, normalizeValue(value)) {
+				values = append(values, value)
+				continue
+			}
+			issues = append(issues, ValidationIssue{Kind: IssueHallucinatedValue, Placeholder: entity.Key, Value: value})
+		}
+
+		if !used[key] {
+			issues = append(issues, ValidationIssue{Kind: IssueUnusedMapping, Placeholder: entity.Key})
+		}
+
+		if len(values) == 0 && len(entity.Values) > 0 {
+			continue
+		}
+		mapped[key] = true
+
+		copied := *entity
+		copied.Values = values
+		valid = append(valid, &copied)
+	}
+
+	for _, key := range usedOrder {
+		if !mapped[key] {
+			issues = append(issues, ValidationIssue{Kind: IssueMissingMapping, Placeholder: key})
+		}
+	}
+
+	return valid, issues
+}
+
+// fatalIssues returns the issues that make the result unrestorable or wrong.
+func fatalIssues(issues []ValidationIssue) []ValidationIssue {
+	var fatal []ValidationIssue
+	for _, issue := range issues {
+		if issue.IsFatal() {
+			fatal = append(fatal, issue)
+		}
+	}
+	return fatal
+}
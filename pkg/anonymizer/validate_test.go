@@ -0,0 +1,128 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+// TestValidateEntities tests cross-checking of the mapping against original and anonymized text.
+func TestValidateEntities(t *testing.T) {
+	original := "张三在 ABC Tech 工作，<br> 保留"
+	anonymized := "<个人信息[0].姓名.全名>在<组织机构[0].公司.全名>工作，<br> 保留<个人信息[2].电话.号码>"
+	entities := []*Entity{
+		{Key: "<个人信息[0].姓名.全名>", Values: []string{"张三", "李四"}},
+		{Key: "<组织机构[0].公司.全名>", Values: []string{"abc tech"}},
+		{Key: "<个人信息[1].邮箱.地址>", Values: []string{"a@example.com"}},
+	}
+
+	valid, issues := ValidateEntities(original, anonymized, entities)
+
+	expected := []ValidationIssue{
+		{Kind: IssueHallucinatedValue, Placeholder: "<个人信息[0].姓名.全名>", Value: "李四"},
+		{Kind: IssueHallucinatedValue, Placeholder: "<个人信息[1].邮箱.地址>", Value: "a@example.com"},
+		{Kind: IssueUnusedMapping, Placeholder: "<个人信息[1].邮箱.地址>"},
+		{Kind: IssueMissingMapping, Placeholder: "<个人信息[2].电话.号码>"},
+	}
+	if len(issues) != len(expected) {
+		t.Fatalf("expected %d issues, got %d: %+v", len(expected), len(issues), issues)
+	}
+	for i := range expected {
+		if issues[i] != expected[i] {
+			t.Errorf("issue %d: expected %+v, got %+v", i, expected[i], issues[i])
+		}
+	}
+
+	if len(valid) != 2 {
+		t.Fatalf("expected 2 valid entities, got %d", len(valid))
+	}
+	if len(valid[0].Values) != 1 || valid[0].Values[0] != "张三" {
+		t.Errorf("expected hallucinated value to be removed, got %v", valid[0].Values)
+	}
+	if len(entities[0].Values) != 2 {
+		t.Error("ValidateEntities must not modify the input entities")
+	}
+}
+
+// TestValidateEntities_Clean tests that a consistent result has no issues.
+func TestValidateEntities_Clean(t *testing.T) {
+	entities := []*Entity{{Key: "<个人信息[0].姓名.全名>", Values: []string{"张三"}}}
+
+	valid, issues := ValidateEntities("张三来了", "< 个人信息 [0]. 姓名. 全名 >来了", entities)
+	if len(issues) != 0 {
+		t.Errorf("expected no issues, got %+v", issues)
+	}
+	if len(valid) != 1 {
+		t.Errorf("expected 1 entity, got %d", len(valid))
+	}
+}
+
+// TestAnonymize_StrictValidation tests that strict mode returns a typed error for hallucinated values.
+func TestAnonymize_StrictValidation(t *testing.T) {
+	mockLLM := newMockWithResponse(newMockAnonymizeResponse(
+		"<个人信息[0].姓名.全名> lives in Beijing",
+		map[string][]string{
+			"<个人信息[0].姓名.全名>": {"王五"},
+		},
+	))
+
+	anon, err := NewHashHidePair(mockLLM, WithStrictValidation())
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	var buf bytes.Buffer
+	_, err = anon.Anonymize(context.Background(), []string{"个人信息"}, "张三 lives in Beijing", &buf)
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+	// The only value is hallucinated, so the entity is dropped and its placeholder becomes unmapped
+	if len(validationErr.Issues) != 2 ||
+		validationErr.Issues[0].Kind != IssueHallucinatedValue ||
+		validationErr.Issues[1].Kind != IssueMissingMapping {
+		t.Errorf("unexpected issues: %+v", validationErr.Issues)
+	}
+}
+
+// TestAnonymize_StrictValidationPasses tests that strict mode accepts a consistent result.
+func TestAnonymize_StrictValidationPasses(t *testing.T) {
+	mockLLM := newMockWithResponse(newMockAnonymizeResponse(
+		"<个人信息[0].姓名.全名> lives in Beijing",
+		map[string][]string{
+			"<个人信息[0].姓名.全名>": {"张三"},
+		},
+	))
+
+	anon, err := NewHashHidePair(mockLLM, WithStrictValidation())
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(context.Background(), []string{"个人信息"}, "张三 lives in Beijing", &buf)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+	if len(entities) != 1 || buf.String() != "<个人信息[0].姓名.全名> lives in Beijing" {
+		t.Errorf("unexpected result: %q, %d entities", buf.String(), len(entities))
+	}
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/rotisserie/eris"
+)
+
+// ErrNotInVault is returned for projects, placeholders and values that are not in the vault.
+var ErrNotInVault = errors.New("not found in vault")
+
+// VaultProject 描述保险库中的一个项目。
+type VaultProject struct {
+	Name      string    `json:"name" yaml:"name"`
+	Entities  int       `json:"entities" yaml:"entities"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" yaml:"updated_at"`
+}
+
+// Vault 定义持久保存实体映射的保险库接口。
+// 实体按项目（如一个长期项目或一个 Web 会话）分组保存，原始值加密存储，
+// 可以按占位符或按原始值查找。实体的 Spans 只对应单个文本，不会被保存。
+type Vault interface {
+	// Put 将实体保存到项目中，项目不存在时自动创建
+	// 占位符已存在时，新的值追加到已有实体
+	Put(ctx context.Context, project string, entities []*Entity) error
+
+	// Entities 返回项目的全部实体，按占位符排序
+	Entities(ctx context.Context, project string) ([]*Entity, error)
+
+	// LookupKey 按占位符查找实体
+	LookupKey(ctx context.Context, project, key string) (*Entity, error)
+
+	// LookupValue 按原始值查找实体，忽略全角/半角、大小写和空白差异
+	LookupValue(ctx context.Context, project, value string) (*Entity, error)
+
+	// Project 返回项目的信息
+	Project(ctx context.Context, project string) (*VaultProject, error)
+
+	// Projects 返回全部项目的信息，按名称排序
+	Projects(ctx context.Context) ([]*VaultProject, error)
+
+	// DeleteProject 删除项目及其全部实体
+	DeleteProject(ctx context.Context, project string) error
+
+	// Close 关闭保险库
+	Close() error
+}
+
+// Vaulted 是沿用保险库中已有占位符的 Anonymizer 包装。
+// 内部 Anonymizer 完成后，值已在项目中出现过的实体改用保险库中的占位符，
+// 与保险库中占位符冲突的新实体重新编号，因此同一项目的所有文档使用一致的占位符。
+// 它不写入保险库：调用方在校验实体后用 Vault.Put 保存。
+// 改写需要完整的实体映射，因此输出会在内部 Anonymizer 完成后一次性写入 writer。
+type Vaulted struct {
+	inner   Anonymizer
+	vault   Vault
+	project string
+}
+
+// Anonymize anonymizes the text with the wrapped Anonymizer and renames the entities to the placeholders of the vault.
+func (v *Vaulted) Anonymize(ctx context.Context, types []string, text string, writer io.Writer) ([]*Entity, error) {
+	var output bytes.Buffer
+	entities, err := v.inner.Anonymize(ctx, types, text, &output)
+	if err != nil {
+		return nil, err
+	}
+
+	known, err := v.vault.Entities(ctx, v.project)
+	if err != nil && !errors.Is(err, ErrNotInVault) {
+		return nil, err
+	}
+
+	// The entities of the vault keep their keys, the new entities are merged into them
+	merger := newEntityMerger()
+	merger.merge(known)
+	keyMap := merger.merge(entities)
+
+	byKey := make(map[string]*Entity, len(entities))
+	result := make([]*Entity, 0, len(entities))
+	for _, entity := range entities {
+		key, ok := keyMap[normalizePlaceholder(entity.Key)]
+		if !ok {
+			key = entity.Key
+		}
+		if existing, ok := byKey[key]; ok {
+			for _, value := range entity.Values {
+				if !containsString(existing.Values, value) {
+					existing.Values = append(existing.Values, value)
+				}
+			}
+			continue
+		}
+
+		merged, ok := merger.byKey[normalizePlaceholder(key)]
+		if !ok {
+			merged = entity
+		}
+		renamed := &Entity{
+			Key:        key,
+			EntityType: merged.EntityType,
+			ID:         merged.ID,
+			Category:   merged.Category,
+			Detail:     merged.Detail,
+			Values:     append([]string(nil), entity.Values...),
+		}
+		byKey[key] = renamed
+		result = append(result, renamed)
+	}
+
+	if _, err := io.WriteString(writer, rewritePlaceholders(output.String(), keyMap)); err != nil {
+		return nil, eris.Wrap(err, "failed to write to output")
+	}
+
+	return result, nil
+}
+
+// RestoreText restores the text with the wrapped Anonymizer.
+func (v *Vaulted) RestoreText(ctx context.Context, entities []*Entity, text string, writer io.Writer) ([]RestoreFailure, error) {
+	return v.inner.RestoreText(ctx, entities, text, writer)
+}
+
+// NewVaulted 创建一个沿用保险库项目中已有占位符的 Anonymizer 包装。
+func NewVaulted(inner Anonymizer, vault Vault, project string) (Anonymizer, error) {
+	if vault == nil {
+		return nil, eris.New("vault cannot be nil")
+	}
+	if project == "" {
+		return nil, eris.New("vault project cannot be empty")
+	}
+
+	return &Vaulted{
+		inner:   inner,
+		vault:   vault,
+		project: project,
+	}, nil
+}
@@ -0,0 +1,524 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rotisserie/eris"
+	bolt "go.etcd.io/bbolt"
+	bolterrors "go.etcd.io/bbolt/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// VaultKeySize is the size in bytes of the key of a vault
+	VaultKeySize = 32
+	// DefaultVaultTimeout is how long to wait for another process to release the vault
+	DefaultVaultTimeout = time.Second
+)
+
+// Layout of the bbolt database:
+//
+//	meta/kdf                      key derivation: raw key, or scrypt parameters and salt
+//	meta/check                    sealed marker, to detect a wrong key when opening
+//	projects/<name>/info          creation and update time of the project
+//	projects/<name>/entities/<k>  sealed entity, by normalized placeholder
+//	projects/<name>/values/<h>    normalized placeholder, by keyed hash of the normalized value
+//
+// Placeholders and project names are stored in clear; values only appear sealed or hashed.
+var (
+	vaultMetaBucket     = []byte("meta")
+	vaultProjectsBucket = []byte("projects")
+	vaultEntitiesBucket = []byte("entities")
+	vaultValuesBucket   = []byte("values")
+	vaultKDFKey         = []byte("kdf")
+	vaultCheckKey       = []byte("check")
+	vaultInfoKey        = []byte("info")
+	vaultCheckValue     = []byte("inu vault v1")
+)
+
+const (
+	vaultKDFNone   = 0
+	vaultKDFScrypt = 1
+
+	vaultSaltSize   = 16
+	vaultScryptLogN = 15
+	vaultScryptR    = 8
+	vaultScryptP    = 1
+)
+
+// BoltVaultConfig holds the configuration of a vault stored in a bbolt database.
+type BoltVaultConfig struct {
+	// Path is the database file, created if it does not exist
+	Path string
+	// Key is a VaultKeySize-byte secret; exactly one of Key and Passphrase must be set
+	Key []byte
+	// Passphrase is stretched with scrypt and a random salt stored in the vault
+	Passphrase []byte
+	// Timeout is how long to wait for another process to release the vault (DefaultVaultTimeout if 0)
+	Timeout time.Duration
+}
+
+// Validate checks if the configuration is valid.
+func (c *BoltVaultConfig) Validate() error {
+	if c.Path == "" {
+		return fmt.Errorf("vault path cannot be empty")
+	}
+	if (len(c.Key) == 0) == (len(c.Passphrase) == 0) {
+		return fmt.Errorf("exactly one of vault key and passphrase must be set")
+	}
+	if len(c.Key) != 0 && len(c.Key) != VaultKeySize {
+		return fmt.Errorf("vault key must be %d bytes, got %d", VaultKeySize, len(c.Key))
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("vault timeout cannot be negative")
+	}
+	return nil
+}
+
+// vaultProjectInfo is the clear-text record of a project.
+type vaultProjectInfo struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BoltVault 是保存在 bbolt 嵌入式数据库文件中的 Vault 实现，无需 CGO 或外部服务。
+// 实体以 AES-256-GCM 加密保存，原始值的索引使用带密钥的 HMAC，因此没有密钥无法读取或猜测原始值。
+// 数据库文件同一时间只能由一个进程打开。
+type BoltVault struct {
+	db       *bolt.DB
+	aead     cipher.AEAD
+	indexKey []byte
+	now      func() time.Time
+}
+
+// OpenBoltVault 打开或创建一个 bbolt 保险库，密钥错误时返回错误。
+func OpenBoltVault(config *BoltVaultConfig) (*BoltVault, error) {
+	if err := config.Validate(); err != nil {
+		return nil, eris.Wrap(err, "invalid vault config")
+	}
+
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = DefaultVaultTimeout
+	}
+	db, err := bolt.Open(config.Path, 0600, &bolt.Options{Timeout: timeout})
+	if errors.Is(err, bolterrors.ErrTimeout) {
+		return nil, eris.Errorf("vault is in use by another process: %s", config.Path)
+	} else if err != nil {
+		return nil, eris.Wrapf(err, "failed to open vault: %s", config.Path)
+	}
+
+	vault := &BoltVault{db: db, now: time.Now}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		return vault.unlock(tx, config)
+	}); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return vault, nil
+}
+
+// unlock derives the keys of the vault, initializing the key derivation of a new vault.
+func (v *BoltVault) unlock(tx *bolt.Tx, config *BoltVaultConfig) error {
+	meta, err := tx.CreateBucketIfNotExists(vaultMetaBucket)
+	if err != nil {
+		return eris.Wrap(err, "failed to initialize vault")
+	}
+	if _, err := tx.CreateBucketIfNotExists(vaultProjectsBucket); err != nil {
+		return eris.Wrap(err, "failed to initialize vault")
+	}
+
+	kdf := meta.Get(vaultKDFKey)
+	if kdf == nil {
+		kdf = []byte{vaultKDFNone}
+		if config.Key == nil {
+			salt := make([]byte, vaultSaltSize)
+			if _, err := rand.Read(salt); err != nil {
+				return eris.Wrap(err, "failed to generate salt")
+			}
+			kdf = append([]byte{vaultKDFScrypt, vaultScryptLogN, vaultScryptR, vaultScryptP}, salt...)
+		}
+		if err := meta.Put(vaultKDFKey, kdf); err != nil {
+			return eris.Wrap(err, "failed to initialize vault")
+		}
+	}
+
+	master, err := deriveVaultMasterKey(kdf, config)
+	if err != nil {
+		return err
+	}
+	if err := v.setKeys(master); err != nil {
+		return err
+	}
+
+	check := meta.Get(vaultCheckKey)
+	if check == nil {
+		sealed, err := v.seal(vaultCheckValue, vaultCheckKey)
+		if err != nil {
+			return err
+		}
+		return meta.Put(vaultCheckKey, sealed)
+	}
+	if _, err := v.open(check, vaultCheckKey); err != nil {
+		return eris.New("failed to unlock vault: wrong key or passphrase")
+	}
+	return nil
+}
+
+// deriveVaultMasterKey returns the raw key, or stretches the passphrase with the stored scrypt parameters.
+func deriveVaultMasterKey(kdf []byte, config *BoltVaultConfig) ([]byte, error) {
+	switch kdf[0] {
+	case vaultKDFNone:
+		if config.Key == nil {
+			return nil, eris.New("vault was created with a key file, not a passphrase")
+		}
+		return config.Key, nil
+	case vaultKDFScrypt:
+		if config.Passphrase == nil {
+			return nil, eris.New("vault was created with a passphrase, not a key file")
+		}
+		if len(kdf) != 4+vaultSaltSize || kdf[1] == 0 || kdf[1] > 20 || kdf[2] == 0 || kdf[3] == 0 {
+			return nil, eris.New("invalid key derivation in vault")
+		}
+		key, err := scrypt.Key(config.Passphrase, kdf[4:], 1<<kdf[1], int(kdf[2]), int(kdf[3]), VaultKeySize)
+		if err != nil {
+			return nil, eris.Wrap(err, "failed to derive key from passphrase")
+		}
+		return key, nil
+	default:
+		return nil, eris.Errorf("unsupported key derivation in vault: %d", kdf[0])
+	}
+}
+
+// setKeys derives separate keys for sealing entities and for indexing values.
+func (v *BoltVault) setKeys(master []byte) error {
+	sealKey, err := hkdf.Key(sha256.New, master, nil, "inu vault entities", VaultKeySize)
+	if err != nil {
+		return eris.Wrap(err, "failed to derive vault keys")
+	}
+	v.indexKey, err = hkdf.Key(sha256.New, master, nil, "inu vault values", VaultKeySize)
+	if err != nil {
+		return eris.Wrap(err, "failed to derive vault keys")
+	}
+
+	block, err := aes.NewCipher(sealKey)
+	if err != nil {
+		return eris.Wrap(err, "failed to create cipher")
+	}
+	v.aead, err = cipher.NewGCM(block)
+	if err != nil {
+		return eris.Wrap(err, "failed to create cipher")
+	}
+	return nil
+}
+
+// seal encrypts plaintext; aad binds the record to its location so that records cannot be swapped.
+func (v *BoltVault) seal(plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, eris.Wrap(err, "failed to generate nonce")
+	}
+	return v.aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// open decrypts a record sealed by seal.
+func (v *BoltVault) open(data, aad []byte) ([]byte, error) {
+	if len(data) < v.aead.NonceSize() {
+		return nil, eris.New("vault record is truncated")
+	}
+	nonce := data[:v.aead.NonceSize()]
+	plaintext, err := v.aead.Open(nil, nonce, data[len(nonce):], aad)
+	if err != nil {
+		return nil, eris.New("failed to decrypt vault record: wrong key or corrupted vault")
+	}
+	return plaintext, nil
+}
+
+// valueIndex returns the keyed hash indexing a value.
+func (v *BoltVault) valueIndex(value string) []byte {
+	mac := hmac.New(sha256.New, v.indexKey)
+	mac.Write([]byte(normalizeValue(value)))
+	return mac.Sum(nil)
+}
+
+func entityAAD(project string, key []byte) []byte {
+	return append(append([]byte(project), 0), key...)
+}
+
+// Put saves entities to the project, creating it if needed.
+func (v *BoltVault) Put(ctx context.Context, project string, entities []*Entity) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if project == "" {
+		return eris.New("vault project cannot be empty")
+	}
+
+	now := v.now()
+	return v.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(vaultProjectsBucket).CreateBucketIfNotExists([]byte(project))
+		if err != nil {
+			return eris.Wrapf(err, "failed to create vault project: %s", project)
+		}
+		entitiesBucket, err := bucket.CreateBucketIfNotExists(vaultEntitiesBucket)
+		if err != nil {
+			return eris.Wrapf(err, "failed to create vault project: %s", project)
+		}
+		valuesBucket, err := bucket.CreateBucketIfNotExists(vaultValuesBucket)
+		if err != nil {
+			return eris.Wrapf(err, "failed to create vault project: %s", project)
+		}
+
+		info := vaultProjectInfo{CreatedAt: now}
+		if data := bucket.Get(vaultInfoKey); data != nil {
+			if err := json.Unmarshal(data, &info); err != nil {
+				return eris.Wrapf(err, "invalid vault project: %s", project)
+			}
+		}
+		info.UpdatedAt = now
+		data, err := json.Marshal(info)
+		if err != nil {
+			return eris.Wrap(err, "failed to encode vault project")
+		}
+		if err := bucket.Put(vaultInfoKey, data); err != nil {
+			return eris.Wrapf(err, "failed to update vault project: %s", project)
+		}
+
+		for _, entity := range entities {
+			if err := v.putEntity(entitiesBucket, valuesBucket, project, entity); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// putEntity adds the entity to the project, merging its values into the stored entity with the same placeholder.
+func (v *BoltVault) putEntity(entitiesBucket, valuesBucket *bolt.Bucket, project string, entity *Entity) error {
+	key := []byte(normalizePlaceholder(entity.Key))
+
+	stored, err := v.getEntity(entitiesBucket, project, key)
+	if errors.Is(err, ErrNotInVault) {
+		stored = &Entity{
+			Key:        entity.Key,
+			EntityType: entity.EntityType,
+			ID:         entity.ID,
+			Category:   entity.Category,
+			Detail:     entity.Detail,
+		}
+	} else if err != nil {
+		return err
+	}
+	for _, value := range entity.Values {
+		if !containsString(stored.Values, value) {
+			stored.Values = append(stored.Values, value)
+		}
+	}
+	if stored.Pseudonym == "" {
+		stored.Pseudonym = entity.Pseudonym
+	}
+
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return eris.Wrap(err, "failed to encode entity")
+	}
+	sealed, err := v.seal(data, entityAAD(project, key))
+	if err != nil {
+		return err
+	}
+	if err := entitiesBucket.Put(key, sealed); err != nil {
+		return eris.Wrapf(err, "failed to save entity: %s", entity.Key)
+	}
+
+	// A value keeps the placeholder it was first saved with
+	for _, value := range stored.Values {
+		index := v.valueIndex(value)
+		if valuesBucket.Get(index) == nil {
+			if err := valuesBucket.Put(index, key); err != nil {
+				return eris.Wrapf(err, "failed to index entity: %s", entity.Key)
+			}
+		}
+	}
+	return nil
+}
+
+// getEntity decrypts the entity with the normalized placeholder key.
+func (v *BoltVault) getEntity(entitiesBucket *bolt.Bucket, project string, key []byte) (*Entity, error) {
+	sealed := entitiesBucket.Get(key)
+	if sealed == nil {
+		return nil, ErrNotInVault
+	}
+	data, err := v.open(sealed, entityAAD(project, key))
+	if err != nil {
+		return nil, err
+	}
+
+	var entity Entity
+	if err := json.Unmarshal(data, &entity); err != nil {
+		return nil, eris.Wrapf(err, "invalid entity in vault: %s", key)
+	}
+	return &entity, nil
+}
+
+// viewProject runs fn with the buckets of the project, or returns ErrNotInVault if it does not exist.
+func (v *BoltVault) viewProject(ctx context.Context, project string, fn func(bucket, entitiesBucket, valuesBucket *bolt.Bucket) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return v.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(vaultProjectsBucket).Bucket([]byte(project))
+		if bucket == nil {
+			return eris.Wrapf(ErrNotInVault, "project %s", project)
+		}
+		return fn(bucket, bucket.Bucket(vaultEntitiesBucket), bucket.Bucket(vaultValuesBucket))
+	})
+}
+
+// Entities returns all entities of the project, sorted by placeholder.
+func (v *BoltVault) Entities(ctx context.Context, project string) ([]*Entity, error) {
+	var entities []*Entity
+	err := v.viewProject(ctx, project, func(_, entitiesBucket, _ *bolt.Bucket) error {
+		return entitiesBucket.ForEach(func(key, _ []byte) error {
+			entity, err := v.getEntity(entitiesBucket, project, key)
+			if err != nil {
+				return err
+			}
+			entities = append(entities, entity)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entities, nil
+}
+
+// LookupKey returns the entity of a placeholder.
+func (v *BoltVault) LookupKey(ctx context.Context, project, key string) (*Entity, error) {
+	var entity *Entity
+	err := v.viewProject(ctx, project, func(_, entitiesBucket, _ *bolt.Bucket) error {
+		var err error
+		entity, err = v.getEntity(entitiesBucket, project, []byte(normalizePlaceholder(key)))
+		if errors.Is(err, ErrNotInVault) {
+			return eris.Wrapf(ErrNotInVault, "placeholder %s", key)
+		}
+		return err
+	})
+	return entity, err
+}
+
+// LookupValue returns the entity of an original value.
+func (v *BoltVault) LookupValue(ctx context.Context, project, value string) (*Entity, error) {
+	var entity *Entity
+	err := v.viewProject(ctx, project, func(_, entitiesBucket, valuesBucket *bolt.Bucket) error {
+		key := valuesBucket.Get(v.valueIndex(value))
+		if key == nil {
+			return eris.Wrap(ErrNotInVault, "value")
+		}
+		var err error
+		entity, err = v.getEntity(entitiesBucket, project, key)
+		return err
+	})
+	return entity, err
+}
+
+// Project returns the information of the project.
+func (v *BoltVault) Project(ctx context.Context, project string) (*VaultProject, error) {
+	var info *VaultProject
+	err := v.viewProject(ctx, project, func(bucket, entitiesBucket, _ *bolt.Bucket) error {
+		var err error
+		info, err = readVaultProject(project, bucket, entitiesBucket)
+		return err
+	})
+	return info, err
+}
+
+// Projects returns the information of all projects, sorted by name.
+func (v *BoltVault) Projects(ctx context.Context) ([]*VaultProject, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var projects []*VaultProject
+	err := v.db.View(func(tx *bolt.Tx) error {
+		projectsBucket := tx.Bucket(vaultProjectsBucket)
+		return projectsBucket.ForEachBucket(func(name []byte) error {
+			bucket := projectsBucket.Bucket(name)
+			info, err := readVaultProject(string(name), bucket, bucket.Bucket(vaultEntitiesBucket))
+			if err != nil {
+				return err
+			}
+			projects = append(projects, info)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
+func readVaultProject(name string, bucket, entitiesBucket *bolt.Bucket) (*VaultProject, error) {
+	var info vaultProjectInfo
+	if err := json.Unmarshal(bucket.Get(vaultInfoKey), &info); err != nil {
+		return nil, eris.Wrapf(err, "invalid vault project: %s", name)
+	}
+
+	return &VaultProject{
+		Name:      name,
+		Entities:  entitiesBucket.Stats().KeyN,
+		CreatedAt: info.CreatedAt,
+		UpdatedAt: info.UpdatedAt,
+	}, nil
+}
+
+// DeleteProject deletes the project and all its entities.
+func (v *BoltVault) DeleteProject(ctx context.Context, project string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return v.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(vaultProjectsBucket).DeleteBucket([]byte(project))
+		if errors.Is(err, bolterrors.ErrBucketNotFound) {
+			return eris.Wrapf(ErrNotInVault, "project %s", project)
+		} else if err != nil {
+			return eris.Wrapf(err, "failed to delete vault project: %s", project)
+		}
+		return nil
+	})
+}
+
+// Close closes the database file.
+func (v *BoltVault) Close() error {
+	if err := v.db.Close(); err != nil {
+		return eris.Wrap(err, "failed to close vault")
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testVaultKey = []byte("0123456789abcdef0123456789abcdef")
+
+func openTestVault(t *testing.T, config *BoltVaultConfig) *BoltVault {
+	t.Helper()
+
+	vault, err := OpenBoltVault(config)
+	if err != nil {
+		t.Fatalf("Failed to open vault: %v", err)
+	}
+	t.Cleanup(func() { _ = vault.Close() })
+	return vault
+}
+
+func testVaultEntities() []*Entity {
+	return []*Entity{
+		{Key: "<个人信息[0].姓名.全名>", EntityType: "个人信息", ID: "0", Category: "姓名", Detail: "全名", Values: []string{"张三"},
+			Spans: []Span{{Value: "张三", Start: 0, End: 2}}},
+		{Key: "<个人信息[1].电话.号码>", EntityType: "个人信息", ID: "1", Category: "电话", Detail: "号码", Values: []string{"13800138000"}},
+	}
+}
+
+func TestBoltVault_PutAndLookup(t *testing.T) {
+	ctx := context.Background()
+	vault := openTestVault(t, &BoltVaultConfig{Path: filepath.Join(t.TempDir(), "vault.db"), Key: testVaultKey})
+
+	if err := vault.Put(ctx, "alpha", testVaultEntities()); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	entities, err := vault.Entities(ctx, "alpha")
+	if err != nil {
+		t.Fatalf("Entities failed: %v", err)
+	}
+	if len(entities) != 2 {
+		t.Fatalf("Expected 2 entities, got %d", len(entities))
+	}
+	for _, entity := range entities {
+		if len(entity.Spans) != 0 {
+			t.Errorf("Expected spans not to be stored, got %+v", entity.Spans)
+		}
+	}
+
+	entity, err := vault.LookupKey(ctx, "alpha", "< 个人信息 [0]. 姓名。全名 >")
+	if err != nil {
+		t.Fatalf("LookupKey failed: %v", err)
+	}
+	if entity.Key != "<个人信息[0].姓名.全名>" || entity.Values[0] != "张三" {
+		t.Errorf("Unexpected entity: %+v", entity)
+	}
+
+	entity, err = vault.LookupValue(ctx, "alpha", "１３８ ００１３ ８０００")
+	if err != nil {
+		t.Fatalf("LookupValue failed: %v", err)
+	}
+	if entity.Key != "<个人信息[1].电话.号码>" {
+		t.Errorf("Unexpected entity: %+v", entity)
+	}
+
+	if _, err := vault.LookupValue(ctx, "alpha", "李四"); !errors.Is(err, ErrNotInVault) {
+		t.Errorf("Expected ErrNotInVault for unknown value, got %v", err)
+	}
+	if _, err := vault.LookupKey(ctx, "beta", "<个人信息[0].姓名.全名>"); !errors.Is(err, ErrNotInVault) {
+		t.Errorf("Expected ErrNotInVault for unknown project, got %v", err)
+	}
+}
+
+func TestBoltVault_PutMergesValues(t *testing.T) {
+	ctx := context.Background()
+	vault := openTestVault(t, &BoltVaultConfig{Path: filepath.Join(t.TempDir(), "vault.db"), Key: testVaultKey})
+
+	if err := vault.Put(ctx, "alpha", testVaultEntities()); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := vault.Put(ctx, "alpha", []*Entity{
+		{Key: "<个人信息[0].姓名.全名>", EntityType: "个人信息", ID: "0", Category: "姓名", Detail: "全名", Values: []string{"张三", "小张"}},
+	}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	entity, err := vault.LookupKey(ctx, "alpha", "<个人信息[0].姓名.全名>")
+	if err != nil {
+		t.Fatalf("LookupKey failed: %v", err)
+	}
+	if len(entity.Values) != 2 || entity.Values[1] != "小张" {
+		t.Errorf("Expected merged values, got %v", entity.Values)
+	}
+	if found, err := vault.LookupValue(ctx, "alpha", "小张"); err != nil || found.Key != entity.Key {
+		t.Errorf("Expected new value to be indexed, got %+v, %v", found, err)
+	}
+}
+
+func TestBoltVault_Projects(t *testing.T) {
+	ctx := context.Background()
+	vault := openTestVault(t, &BoltVaultConfig{Path: filepath.Join(t.TempDir(), "vault.db"), Key: testVaultKey})
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	vault.now = func() time.Time { return created }
+
+	if err := vault.Put(ctx, "beta", nil); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := vault.Put(ctx, "alpha", testVaultEntities()); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	vault.now = func() time.Time { return created.Add(time.Hour) }
+	if err := vault.Put(ctx, "alpha", nil); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	projects, err := vault.Projects(ctx)
+	if err != nil {
+		t.Fatalf("Projects failed: %v", err)
+	}
+	if len(projects) != 2 || projects[0].Name != "alpha" || projects[1].Name != "beta" {
+		t.Fatalf("Unexpected projects: %+v", projects)
+	}
+	if projects[0].Entities != 2 || projects[1].Entities != 0 {
+		t.Errorf("Unexpected entity counts: %d, %d", projects[0].Entities, projects[1].Entities)
+	}
+	if !projects[0].CreatedAt.Equal(created) || !projects[0].UpdatedAt.Equal(created.Add(time.Hour)) {
+		t.Errorf("Unexpected project times: %+v", projects[0])
+	}
+
+	if err := vault.DeleteProject(ctx, "alpha"); err != nil {
+		t.Fatalf("DeleteProject failed: %v", err)
+	}
+	if _, err := vault.Project(ctx, "alpha"); !errors.Is(err, ErrNotInVault) {
+		t.Errorf("Expected ErrNotInVault after delete, got %v", err)
+	}
+	if err := vault.DeleteProject(ctx, "alpha"); !errors.Is(err, ErrNotInVault) {
+		t.Errorf("Expected ErrNotInVault for second delete, got %v", err)
+	}
+}
+
+func TestBoltVault_EncryptedAtRest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.db")
+	vault, err := OpenBoltVault(&BoltVaultConfig{Path: path, Key: testVaultKey})
+	if err != nil {
+		t.Fatalf("Failed to open vault: %v", err)
+	}
+	if err := vault.Put(context.Background(), "alpha", testVaultEntities()); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := vault.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read vault: %v", err)
+	}
+	for _, value := range []string{"张三", "13800138000"} {
+		if bytes.Contains(data, []byte(value)) {
+			t.Errorf("Vault file contains the value %q in clear", value)
+		}
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected vault file mode 0600, got %v, %v", info.Mode().Perm(), err)
+	}
+}
+
+func TestBoltVault_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.db")
+	passphrase := []byte("correct horse battery staple")
+
+	vault, err := OpenBoltVault(&BoltVaultConfig{Path: path, Passphrase: passphrase})
+	if err != nil {
+		t.Fatalf("Failed to open vault: %v", err)
+	}
+	if err := vault.Put(context.Background(), "alpha", testVaultEntities()); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	// The database file is locked while the vault is open
+	if _, err := OpenBoltVault(&BoltVaultConfig{Path: path, Passphrase: passphrase, Timeout: 10 * time.Millisecond}); err == nil {
+		t.Error("Expected error when opening a vault in use")
+	}
+	if err := vault.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if _, err := OpenBoltVault(&BoltVaultConfig{Path: path, Passphrase: []byte("wrong")}); err == nil {
+		t.Error("Expected error for wrong passphrase")
+	}
+	if _, err := OpenBoltVault(&BoltVaultConfig{Path: path, Key: testVaultKey}); err == nil {
+		t.Error("Expected error for key on a passphrase vault")
+	}
+
+	reopened := openTestVault(t, &BoltVaultConfig{Path: path, Passphrase: passphrase})
+	entity, err := reopened.LookupValue(context.Background(), "alpha", "张三")
+	if err != nil {
+		t.Fatalf("LookupValue failed: %v", err)
+	}
+	if entity.Key != "<个人信息[0].姓名.全名>" {
+		t.Errorf("Unexpected entity: %+v", entity)
+	}
+}
+
+func TestBoltVaultConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  BoltVaultConfig
+		wantErr bool
+	}{
+		{name: "key", config: BoltVaultConfig{Path: "vault.db", Key: testVaultKey}},
+		{name: "passphrase", config: BoltVaultConfig{Path: "vault.db", Passphrase: []byte("secret")}},
+		{name: "empty path", config: BoltVaultConfig{Key: testVaultKey}, wantErr: true},
+		{name: "no secret", config: BoltVaultConfig{Path: "vault.db"}, wantErr: true},
+		{name: "key and passphrase", config: BoltVaultConfig{Path: "vault.db", Key: testVaultKey, Passphrase: []byte("secret")}, wantErr: true},
+		{name: "short key", config: BoltVaultConfig{Path: "vault.db", Key: []byte("short")}, wantErr: true},
+		{name: "negative timeout", config: BoltVaultConfig{Path: "vault.db", Key: testVaultKey, Timeout: -time.Second}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVaulted_ConsistentAcrossDocuments(t *testing.T) {
+	ctx := context.Background()
+	vault := openTestVault(t, &BoltVaultConfig{Path: filepath.Join(t.TempDir(), "vault.db"), Key: testVaultKey})
+
+	rules, err := NewRuleBased(nil)
+	if err != nil {
+		t.Fatalf("Failed to create rule-based anonymizer: %v", err)
+	}
+	anon, err := NewVaulted(rules, vault, "alpha")
+	if err != nil {
+		t.Fatalf("Failed to create vaulted anonymizer: %v", err)
+	}
+
+	// The first document fills the vault
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(ctx, DefaultEntityTypes, "联系 zhangsan@corp.cn", &buf)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+	if len(entities) != 1 {
+		t.Fatalf("expected 1 entity, got %d", len(entities))
+	}
+	if err := vault.Put(ctx, "alpha", entities); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	// In the second document the known email is no longer the first entity
+	anonymized, second := anonymizeEntityKeys(t, anon, "联系 lisi@corp.cn 或 zhangsan@corp.cn")
+
+	key := entities[0].Key
+	if key != second["zhangsan@corp.cn"] {
+		t.Errorf("expected the vault placeholder %q, got %q", key, second["zhangsan@corp.cn"])
+	}
+	if second["lisi@corp.cn"] == key || second["lisi@corp.cn"] == "" {
+		t.Errorf("expected a new placeholder for the new value, got %q", second["lisi@corp.cn"])
+	}
+	if !strings.Contains(anonymized, key) || !strings.Contains(anonymized, second["lisi@corp.cn"]) {
+		t.Errorf("expected the renamed placeholders in %q", anonymized)
+	}
+}
+
+func TestVaulted_Restore(t *testing.T) {
+	ctx := context.Background()
+	vault := openTestVault(t, &BoltVaultConfig{Path: filepath.Join(t.TempDir(), "vault.db"), Key: testVaultKey})
+	if err := vault.Put(ctx, "alpha", testVaultEntities()); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	rules, err := NewRuleBased(nil)
+	if err != nil {
+		t.Fatalf("Failed to create rule-based anonymizer: %v", err)
+	}
+	anon, err := NewVaulted(rules, vault, "alpha")
+	if err != nil {
+		t.Fatalf("Failed to create vaulted anonymizer: %v", err)
+	}
+
+	text := "电话 13800138000，邮箱 wangwu@corp.cn"
+	var buf bytes.Buffer
+	entities, err := anon.Anonymize(ctx, DefaultEntityTypes, text, &buf)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "<个人信息[1].电话.号码>") {
+		t.Errorf("expected the vault placeholder of the phone number in %q", buf.String())
+	}
+	if err := vault.Put(ctx, "alpha", entities); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	// The whole project restores the text
+	stored, err := vault.Entities(ctx, "alpha")
+	if err != nil {
+		t.Fatalf("Entities failed: %v", err)
+	}
+	var restored bytes.Buffer
+	failures, err := Restore(stored, buf.String(), &restored, DefaultRestorePolicy)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if len(failures) != 0 || restored.String() != text {
+		t.Errorf("expected %q, got %q (failures: %v)", text, restored.String(), failures)
+	}
+}
+
+func TestNewVaulted_InvalidArguments(t *testing.T) {
+	vault := openTestVault(t, &BoltVaultConfig{Path: filepath.Join(t.TempDir(), "vault.db"), Key: testVaultKey})
+	rules, err := NewRuleBased(nil)
+	if err != nil {
+		t.Fatalf("Failed to create rule-based anonymizer: %v", err)
+	}
+
+	if _, err := NewVaulted(rules, nil, "alpha"); err == nil {
+		t.Error("expected error for nil vault")
+	}
+	if _, err := NewVaulted(rules, vault, ""); err == nil {
+		t.Error("expected error for empty project")
+	}
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Leak 表示脱敏文本中残留的一处原始实体值。
+type Leak struct {
+	// Placeholder 是该值所属实体的占位符
+	Placeholder string `json:"placeholder"`
+	// Value 是实体映射中记录的原始值
+	Value string `json:"value"`
+	// Text 是脱敏文本中实际出现的片段 (可能与 Value 存在宽度、大小写、空白差异)
+	Text string `json:"text"`
+	// Start 和 End 是该片段在脱敏文本中的字节偏移
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// LeakReport 是脱敏结果的泄漏检查报告。
+type LeakReport struct {
+	// Leaks 是检测到的残留原始值
+	Leaks []Leak `json:"leaks"`
+	// Remasked 表示残留值是否已被替换为占位符
+	Remasked bool `json:"remasked"`
+}
+
+// HasLeaks returns true if any leaked value was found.
+func (r *LeakReport) HasLeaks() bool {
+	return r != nil && len(r.Leaks) > 0
+}
+
+// leakCandidate is an entity value searched for in the anonymized text.
+type leakCandidate struct {
+	entity     *Entity
+	value      string
+	normalized string
+}
+
+// VerifyAnonymized searches the anonymized text for every value of every entity.
+// Matching ignores differences in whitespace, character width and case, and
+// occurrences inside placeholders and pseudonyms are not reported.
+// If remask is true, the leaked occurrences are replaced by the entity placeholders
+// (or pseudonyms) in the returned text; otherwise the text is returned unchanged.
+func VerifyAnonymized(text string, entities []*Entity, remask bool) (string, *LeakReport) {
+	report := &LeakReport{Leaks: []Leak{}}
+
+	var candidates []leakCandidate
+	for _, entity := range entities {
+		for _, value := range entity.Values {
+			normalized := normalizeValue(value)
+			if normalized == "" {
+				continue
+			}
+			candidates = append(candidates, leakCandidate{entity: entity, value: value, normalized: normalized})
+		}
+	}
+	if len(candidates) == 0 {
+		return text, report
+	}
+
+	// Longer values first so that a value contained in another one is not reported twice
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return len(candidates[i].normalized) > len(candidates[j].normalized)
+	})
+
+	normalized, starts, ends := normalizeWithOffsets(text)
+	occupied := markSpans(findEntityMarks(text, entities))
+
+	for _, candidate := range candidates {
+		offset := 0
+		for {
+			index := strings.Index(normalized[offset:], candidate.normalized)
+			if index < 0 {
+				break
+			}
+			normStart := offset + index
+			normEnd := normStart + len(candidate.normalized)
+			offset = normStart + 1
+			for offset < len(normalized) && !utf8.RuneStart(normalized[offset]) {
+				offset++
+			}
+
+			start, end := starts[normStart], ends[normEnd]
+			if overlapsAny(occupied, start, end) {
+				continue
+			}
+
+			occupied = append(occupied, [2]int{start, end})
+			report.Leaks = append(report.Leaks, Leak{
+				Placeholder: candidate.entity.Key,
+				Value:       candidate.value,
+				Text:        text[start:end],
+				Start:       start,
+				End:         end,
+			})
+			offset = normEnd
+		}
+	}
+
+	sort.Slice(report.Leaks, func(i, j int) bool {
+		return report.Leaks[i].Start < report.Leaks[j].Start
+	})
+
+	if !remask || len(report.Leaks) == 0 {
+		return text, report
+	}
+
+	replacements := make(map[string]string, len(entities))
+	for _, entity := range entities {
+		if entity.Pseudonym != "" {
+			replacements[entity.Key] = entity.Pseudonym
+		}
+	}
+
+	var builder strings.Builder
+	lastIndex := 0
+	for _, leak := range report.Leaks {
+		builder.WriteString(text[lastIndex:leak.Start])
+		if pseudonym, ok := replacements[leak.Placeholder]; ok {
+			builder.WriteString(pseudonym)
+		} else {
+			builder.WriteString(leak.Placeholder)
+		}
+		lastIndex = leak.End
+	}
+	builder.WriteString(text[lastIndex:])
+	report.Remasked = true
+
+	return builder.String(), report
+}
+
+// normalizeWithOffsets normalizes text like normalizeValue and maps offsets back to the original.
+// starts[i] is the original byte offset of the rune starting at normalized byte i,
+// ends[i] is the original byte offset right after the rune ending at normalized byte i.
+func normalizeWithOffsets(text string) (string, []int, []int) {
+	var builder strings.Builder
+	starts := make([]int, 0, len(text)+1)
+	ends := make([]int, 1, len(text)+1)
+
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		if r >= 0xFF01 && r <= 0xFF5E {
+			r -= 0xFEE0
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		n, _ := builder.WriteRune(unicode.ToLower(r))
+		for k := 0; k < n; k++ {
+			starts = append(starts, i)
+			ends = append(ends, i+size)
+		}
+	}
+	starts = append(starts, len(text))
+
+	return builder.String(), starts, ends
+}
+
+// markSpans returns the byte spans of the placeholders and pseudonyms.
+func markSpans(marks []entityMark) [][2]int {
+	spans := make([][2]int, 0, len(marks))
+	for _, mark := range marks {
+		spans = append(spans, [2]int{mark.start, mark.end})
+	}
+	return spans
+}
+
+func overlapsAny(spans [][2]int, start, end int) bool {
+	for _, span := range spans {
+		if start < span[1] && span[0] < end {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anonymizer
+
+import (
+	"testing"
+)
+
+// TestVerifyAnonymized tests leak detection and re-masking.
+func TestVerifyAnonymized(t *testing.T) {
+	entities := []*Entity{
+		{Key: "<个人信息[0].姓名.全名>", Values: []string{"张三", "老张"}},
+		{Key: "<组织机构[0].公司.全名>", Values: []string{"ABC Tech"}},
+	}
+
+	tests := []struct {
+		name      string
+		text      string
+		remask    bool
+		expected  string
+		leakTexts []string
+	}{
+		{
+			name:      "No leaks",
+			text:      "<个人信息[0].姓名.全名>在<组织机构[0].公司.全名>工作",
+			expected:  "<个人信息[0].姓名.全名>在<组织机构[0].公司.全名>工作",
+			leakTexts: nil,
+		},
+		{
+			name:      "Report without remask",
+			text:      "<个人信息[0].姓名.全名>说老张会来",
+			expected:  "<个人信息[0].姓名.全名>说老张会来",
+			leakTexts: []string{"老张"},
+		},
+		{
+			name:      "Remask with width, case and whitespace differences",
+			text:      "张 三 joined ａｂｃ tech yesterday",
+			remask:    true,
+			expected:  "<个人信息[0].姓名.全名> joined <组织机构[0].公司.全名> yesterday",
+			leakTexts: []string{"张 三", "ａｂｃ tech"},
+		},
+		{
+			name:      "Multiple occurrences",
+			text:      "张三和张三",
+			remask:    true,
+			expected:  "<个人信息[0].姓名.全名>和<个人信息[0].姓名.全名>",
+			leakTexts: []string{"张三", "张三"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, report := VerifyAnonymized(tt.text, entities, tt.remask)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+			if len(report.Leaks) != len(tt.leakTexts) {
+				t.Fatalf("expected %d leaks, got %d: %+v", len(tt.leakTexts), len(report.Leaks), report.Leaks)
+			}
+			for i, leak := range report.Leaks {
+				if leak.Text != tt.leakTexts[i] {
+					t.Errorf("leak %d: expected %q, got %q", i, tt.leakTexts[i], leak.Text)
+				}
+				if tt.text[leak.Start:leak.End] != leak.Text {
+					t.Errorf("leak %d: offsets [%d:%d] do not match text %q", i, leak.Start, leak.End, leak.Text)
+				}
+			}
+			if report.Remasked != (tt.remask && report.HasLeaks()) {
+				t.Errorf("unexpected Remasked: %v", report.Remasked)
+			}
+		})
+	}
+}
+
+// TestVerifyAnonymized_IgnoresPlaceholders tests that values inside placeholders are not leaks.
+func TestVerifyAnonymized_IgnoresPlaceholders(t *testing.T) {
+	entities := []*Entity{
+		{Key: "<账户信息[0].银行账户.6222021001123456789>", Values: []string{"6222021001123456789"}},
+	}
+
+	_, report := VerifyAnonymized("卡号 <账户信息[0].银行账户.6222021001123456789>", entities, false)
+	if report.HasLeaks() {
+		t.Errorf("expected no leaks, got %+v", report.Leaks)
+	}
+}
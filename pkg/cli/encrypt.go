@@ -0,0 +1,247 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/rotisserie/eris"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// EntitiesPassphraseEnv is the environment variable holding the passphrase of encrypted entities files.
+const EntitiesPassphraseEnv = "INU_ENTITIES_PASSPHRASE"
+
+// Encrypted entities files start with a magic string and a format version, followed by
+// the key derivation, the AES-GCM nonce and the sealed entities document.
+// The whole header is authenticated as additional data.
+var encryptedEntitiesMagic = []byte("INUENC")
+
+const (
+	encryptedEntitiesVersion = 1
+
+	kdfNone   = 0
+	kdfScrypt = 1
+
+	entitiesKeySize  = 32
+	scryptSaltSize   = 16
+	scryptLogN       = 15
+	scryptR          = 8
+	scryptP          = 1
+	scryptMaxLogN    = 20
+	encryptedMinSize = 8
+)
+
+// EntitiesKey is the secret protecting an entities file:
+// either a passphrase stretched with scrypt, or a raw 32-byte key read from a key file.
+type EntitiesKey struct {
+	passphrase []byte
+	key        []byte
+}
+
+// NewPassphraseKey creates an entities key from a passphrase.
+func NewPassphraseKey(passphrase []byte) (*EntitiesKey, error) {
+	if len(passphrase) == 0 {
+		return nil, eris.New("passphrase is empty")
+	}
+	return &EntitiesKey{passphrase: append([]byte(nil), passphrase...)}, nil
+}
+
+// LoadEntitiesKeyFile reads a 32-byte key from file, either raw or hex encoded
+// (as generated by `openssl rand -hex 32`).
+func LoadEntitiesKeyFile(file string) (*EntitiesKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to read key file: %s", file)
+	}
+
+	if len(data) == entitiesKeySize {
+		return &EntitiesKey{key: data}, nil
+	}
+	if key, err := hex.DecodeString(string(bytes.TrimSpace(data))); err == nil && len(key) == entitiesKeySize {
+		return &EntitiesKey{key: key}, nil
+	}
+
+	return nil, eris.Errorf("key file must contain %d raw bytes or %d hex characters: %s", entitiesKeySize, 2*entitiesKeySize, file)
+}
+
+// readPassphrase prompts for a passphrase; it is a variable so that tests can replace the prompt.
+var readPassphrase = defaultReadPassphrase
+
+// defaultReadPassphrase prompts for a passphrase on the terminal without echo.
+func defaultReadPassphrase(prompt string) ([]byte, error) {
+	// Stdin may carry the input text, so the passphrase is read from the controlling terminal
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return nil, eris.Errorf("no terminal to prompt for the passphrase: set %s or use --key-file", EntitiesPassphraseEnv)
+	}
+	defer tty.Close()
+
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to read passphrase")
+	}
+	return passphrase, nil
+}
+
+// ResolveEntitiesKey returns the key of an entities file from the key file if given,
+// then from EntitiesPassphraseEnv, and finally by prompting on the terminal.
+// When confirm is true, the prompted passphrase must be entered twice.
+func ResolveEntitiesKey(keyFile string, confirm bool) (*EntitiesKey, error) {
+	if keyFile != "" {
+		return LoadEntitiesKeyFile(keyFile)
+	}
+
+	if passphrase := os.Getenv(EntitiesPassphraseEnv); passphrase != "" {
+		return NewPassphraseKey([]byte(passphrase))
+	}
+
+	passphrase, err := readPassphrase("Entities passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if confirm {
+		again, err := readPassphrase("Confirm passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(passphrase, again) {
+			return nil, eris.New("passphrases do not match")
+		}
+	}
+
+	return NewPassphraseKey(passphrase)
+}
+
+// IsEncryptedEntities reports whether data is an encrypted entities file.
+func IsEncryptedEntities(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedEntitiesMagic)
+}
+
+// EncryptEntities seals an entities document with AES-256-GCM.
+func EncryptEntities(plaintext []byte, key *EntitiesKey) ([]byte, error) {
+	header := append([]byte(nil), encryptedEntitiesMagic...)
+	header = append(header, encryptedEntitiesVersion)
+
+	aesKey := key.key
+	if aesKey == nil {
+		salt := make([]byte, scryptSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, eris.Wrap(err, "failed to generate salt")
+		}
+		header = append(header, kdfScrypt, scryptLogN, scryptR, scryptP)
+		header = append(header, salt...)
+
+		var err error
+		aesKey, err = scrypt.Key(key.passphrase, salt, 1<<scryptLogN, scryptR, scryptP, entitiesKeySize)
+		if err != nil {
+			return nil, eris.Wrap(err, "failed to derive key from passphrase")
+		}
+	} else {
+		header = append(header, kdfNone)
+	}
+
+	aead, err := newEntitiesAEAD(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, eris.Wrap(err, "failed to generate nonce")
+	}
+	header = append(header, nonce...)
+
+	return aead.Seal(header, nonce, plaintext, header), nil
+}
+
+// DecryptEntities opens an entities document sealed by EncryptEntities.
+func DecryptEntities(data []byte, key *EntitiesKey) ([]byte, error) {
+	if !IsEncryptedEntities(data) || len(data) < encryptedMinSize {
+		return nil, eris.New("not an encrypted entities file")
+	}
+	if version := data[len(encryptedEntitiesMagic)]; version != encryptedEntitiesVersion {
+		return nil, eris.Errorf("unsupported encrypted entities version: %d", version)
+	}
+
+	offset := len(encryptedEntitiesMagic) + 2
+	var aesKey []byte
+	switch data[offset-1] {
+	case kdfNone:
+		if key.key == nil {
+			return nil, eris.New("entities file was encrypted with a key file, not a passphrase")
+		}
+		aesKey = key.key
+	case kdfScrypt:
+		if key.passphrase == nil {
+			return nil, eris.New("entities file was encrypted with a passphrase, not a key file")
+		}
+		if len(data) < offset+3+scryptSaltSize {
+			return nil, eris.New("encrypted entities file is truncated")
+		}
+		logN, r, p := data[offset], data[offset+1], data[offset+2]
+		if logN == 0 || logN > scryptMaxLogN || r == 0 || p == 0 {
+			return nil, eris.New("invalid scrypt parameters in encrypted entities file")
+		}
+		salt := data[offset+3 : offset+3+scryptSaltSize]
+		offset += 3 + scryptSaltSize
+
+		var err error
+		aesKey, err = scrypt.Key(key.passphrase, salt, 1<<logN, int(r), int(p), entitiesKeySize)
+		if err != nil {
+			return nil, eris.Wrap(err, "failed to derive key from passphrase")
+		}
+	default:
+		return nil, eris.Errorf("unsupported key derivation in encrypted entities file: %d", data[offset-1])
+	}
+
+	aead, err := newEntitiesAEAD(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < offset+aead.NonceSize() {
+		return nil, eris.New("encrypted entities file is truncated")
+	}
+	header := data[:offset+aead.NonceSize()]
+	nonce := data[offset : offset+aead.NonceSize()]
+
+	plaintext, err := aead.Open(nil, nonce, data[len(header):], header)
+	if err != nil {
+		return nil, eris.New("failed to decrypt entities file: wrong key or corrupted file")
+	}
+	return plaintext, nil
+}
+
+func newEntitiesAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to create cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to create cipher")
+	}
+	return aead, nil
+}
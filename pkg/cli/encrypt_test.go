@@ -0,0 +1,172 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+)
+
+func newTestKeyFile(t *testing.T, content string) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "entities.key")
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+	return file
+}
+
+func TestSaveAndLoadEncryptedEntities(t *testing.T) {
+	testEntities := []*anonymizer.Entity{
+		{Key: "<个人信息[0].姓名.全名>", EntityType: "个人信息", ID: "0", Category: "姓名", Detail: "全名", Values: []string{"张三"}},
+	}
+
+	passphrase, err := NewPassphraseKey([]byte("correct horse"))
+	if err != nil {
+		t.Fatalf("NewPassphraseKey failed: %v", err)
+	}
+	keyFile, err := LoadEntitiesKeyFile(newTestKeyFile(t, strings.Repeat("ab", 32)+"\n"))
+	if err != nil {
+		t.Fatalf("LoadEntitiesKeyFile failed: %v", err)
+	}
+
+	for name, key := range map[string]*EntitiesKey{"passphrase": passphrase, "key file": keyFile} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "entities.yaml")
+			if err := SaveEncryptedEntities(testEntities, file, key); err != nil {
+				t.Fatalf("SaveEncryptedEntities failed: %v", err)
+			}
+
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("Failed to read entities file: %v", err)
+			}
+			if !IsEncryptedEntities(data) || bytes.Contains(data, []byte("张三")) {
+				t.Fatalf("Expected an encrypted file without plaintext values")
+			}
+
+			loaded, err := LoadEntities(file, func() (*EntitiesKey, error) { return key, nil })
+			if err != nil {
+				t.Fatalf("LoadEntities failed: %v", err)
+			}
+			if len(loaded) != 1 || loaded[0].Key != testEntities[0].Key || loaded[0].Values[0] != "张三" {
+				t.Errorf("Expected the entities to round trip, got %+v", loaded)
+			}
+
+			// Loading without a key reports that the file is encrypted
+			if _, err := LoadEntitiesFromYAML(file); err == nil || !strings.Contains(err.Error(), "encrypted") {
+				t.Errorf("Expected an encrypted file error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadEntities_PlainFileDoesNotResolveKey(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "entities.yaml")
+	if err := SaveEntitiesToYAML([]*anonymizer.Entity{{Key: "<个人信息[0].姓名.全名>", Values: []string{"张三"}}}, file); err != nil {
+		t.Fatalf("SaveEntitiesToYAML failed: %v", err)
+	}
+
+	loaded, err := LoadEntities(file, func() (*EntitiesKey, error) {
+		t.Fatal("Key must not be resolved for a plain file")
+		return nil, nil
+	})
+	if err != nil || len(loaded) != 1 {
+		t.Errorf("Expected 1 entity, got %+v, %v", loaded, err)
+	}
+}
+
+func TestDecryptEntities_Invalid(t *testing.T) {
+	key, _ := NewPassphraseKey([]byte("correct horse"))
+	wrong, _ := NewPassphraseKey([]byte("wrong horse"))
+	rawKey, _ := LoadEntitiesKeyFile(newTestKeyFile(t, strings.Repeat("k", 32)))
+
+	sealed, err := EncryptEntities([]byte("entities: []\n"), key)
+	if err != nil {
+		t.Fatalf("EncryptEntities failed: %v", err)
+	}
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name string
+		data []byte
+		key  *EntitiesKey
+	}{
+		{name: "wrong passphrase", data: sealed, key: wrong},
+		{name: "key file instead of passphrase", data: sealed, key: rawKey},
+		{name: "tampered", data: tampered, key: key},
+		{name: "truncated", data: sealed[:10], key: key},
+		{name: "plain", data: []byte("entities: []\n"), key: key},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecryptEntities(tt.data, tt.key); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestLoadEntitiesKeyFile_Invalid(t *testing.T) {
+	if _, err := LoadEntitiesKeyFile(newTestKeyFile(t, "too short")); err == nil {
+		t.Error("Expected an error for a short key")
+	}
+	if _, err := LoadEntitiesKeyFile("/nonexistent/entities.key"); err == nil {
+		t.Error("Expected an error for a missing key file")
+	}
+}
+
+func TestResolveEntitiesKey(t *testing.T) {
+	prompted := [][]byte{}
+	readPassphrase = func(prompt string) ([]byte, error) {
+		if len(prompted) == 0 {
+			prompted = append(prompted, []byte("first"))
+		} else {
+			prompted = append(prompted, []byte("second"))
+		}
+		return prompted[len(prompted)-1], nil
+	}
+	defer func() {
+		readPassphrase = defaultReadPassphrase
+	}()
+
+	t.Setenv(EntitiesPassphraseEnv, "from env")
+	key, err := ResolveEntitiesKey("", true)
+	if err != nil || string(key.passphrase) != "from env" || len(prompted) != 0 {
+		t.Errorf("Expected the passphrase from the environment, got %+v, %v", key, err)
+	}
+
+	t.Setenv(EntitiesPassphraseEnv, "")
+	key, err = ResolveEntitiesKey("", false)
+	if err != nil || string(key.passphrase) != "first" {
+		t.Errorf("Expected the prompted passphrase, got %+v, %v", key, err)
+	}
+
+	// The confirmation prompt returns a different passphrase
+	prompted = prompted[:0]
+	if _, err := ResolveEntitiesKey("", true); err == nil {
+		t.Error("Expected an error when the passphrases do not match")
+	}
+}
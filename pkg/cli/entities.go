@@ -17,50 +17,327 @@
 package cli
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/rotisserie/eris"
-	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
 
 	"github.com/mrlyc/inu/pkg/anonymizer"
 )
 
-// EntitiesConfig represents the YAML structure for entities file.
-type EntitiesConfig struct {
-	Entities []*anonymizer.Entity `yaml:"entities" mapstructure:"entities"`
+// EntitiesVersion is the version of the entities document written by this package.
+// Version 0 is the unversioned YAML written before documents carried metadata.
+const EntitiesVersion = 1
+
+// EntitiesFormat is the encoding of an entities file.
+type EntitiesFormat string
+
+const (
+	// EntitiesYAML is a single YAML document (.yaml, .yml and any unknown extension)
+	EntitiesYAML EntitiesFormat = "yaml"
+	// EntitiesJSON is a single JSON document (.json)
+	EntitiesJSON EntitiesFormat = "json"
+	// EntitiesJSONL is a metadata line followed by one entity per line (.jsonl, .ndjson)
+	EntitiesJSONL EntitiesFormat = "jsonl"
+)
+
+// DetectEntitiesFormat returns the format of an entities file from its extension.
+func DetectEntitiesFormat(file string) EntitiesFormat {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		return EntitiesJSON
+	case ".jsonl", ".ndjson":
+		return EntitiesJSONL
+	}
+	return EntitiesYAML
 }
 
-// SaveEntitiesToYAML saves entities to a YAML file.
-func SaveEntitiesToYAML(entities []*anonymizer.Entity, file string) error {
-	v := viper.New()
-	v.Set("entities", entities)
+// EntitiesMetadata describes how an entities document was produced.
+type EntitiesMetadata struct {
+	Version   int       `json:"version" yaml:"version"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+	// Model is the model or engine that detected the entities
+	Model string `json:"model,omitempty" yaml:"model,omitempty"`
+	// EntityTypes are the entity types requested during anonymization
+	EntityTypes []string `json:"entity_types,omitempty" yaml:"entity_types,omitempty"`
+	// SourceHash identifies the original text, see HashSource
+	SourceHash string `json:"source_hash,omitempty" yaml:"source_hash,omitempty"`
+	// Redacted is set on audit copies whose values are removed, see RedactEntitiesDocument
+	Redacted bool `json:"redacted,omitempty" yaml:"redacted,omitempty"`
+}
+
+// EntitiesDocument is the content of an entities file.
+type EntitiesDocument struct {
+	EntitiesMetadata `yaml:",inline"`
+	Entities         []*anonymizer.Entity `json:"entities" yaml:"entities"`
+}
+
+// NewEntitiesDocument creates a document of the current version holding entities.
+func NewEntitiesDocument(entities []*anonymizer.Entity) *EntitiesDocument {
+	if entities == nil {
+		entities = []*anonymizer.Entity{}
+	}
+	return &EntitiesDocument{
+		EntitiesMetadata: EntitiesMetadata{
+			Version:   EntitiesVersion,
+			CreatedAt: time.Now().UTC().Truncate(time.Second),
+		},
+		Entities: entities,
+	}
+}
+
+// HashSource returns the SHA-256 of the original text, so a document can be matched to its source
+// without storing it.
+func HashSource(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// EncodeEntities encodes a document in format.
+func EncodeEntities(doc *EntitiesDocument, format EntitiesFormat) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case EntitiesYAML:
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(doc); err != nil {
+			return nil, eris.Wrap(err, "failed to encode entities as YAML")
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, eris.Wrap(err, "failed to encode entities as YAML")
+		}
+	case EntitiesJSON:
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(doc); err != nil {
+			return nil, eris.Wrap(err, "failed to encode entities as JSON")
+		}
+	case EntitiesJSONL:
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(doc.EntitiesMetadata); err != nil {
+			return nil, eris.Wrap(err, "failed to encode entities as JSONL")
+		}
+		for _, entity := range doc.Entities {
+			if err := encoder.Encode(entity); err != nil {
+				return nil, eris.Wrap(err, "failed to encode entities as JSONL")
+			}
+		}
+	default:
+		return nil, eris.Errorf("unknown entities format: %s", format)
+	}
+	return buf.Bytes(), nil
+}
 
-	if err := v.WriteConfigAs(file); err != nil {
-		return eris.Wrapf(err, "failed to write entities to YAML file: %s", file)
+// DecodeEntities decodes a document in format, migrating version 0 documents to the current version.
+func DecodeEntities(data []byte, format EntitiesFormat) (*EntitiesDocument, error) {
+	var doc EntitiesDocument
+	switch format {
+	case EntitiesYAML:
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, eris.Wrap(err, "failed to parse entities YAML")
+		}
+		if doc.Version == 0 {
+			return migrateEntitiesV0(data)
+		}
+	case EntitiesJSON:
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, eris.Wrap(err, "failed to parse entities JSON")
+		}
+	case EntitiesJSONL:
+		if err := decodeEntitiesJSONL(data, &doc); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, eris.Errorf("unknown entities format: %s", format)
 	}
 
+	if doc.Version == 0 {
+		return nil, eris.New("entities document has no version")
+	}
+	if doc.Version > EntitiesVersion {
+		return nil, eris.Errorf("entities document version %d is newer than supported version %d", doc.Version, EntitiesVersion)
+	}
+	if doc.Entities == nil {
+		doc.Entities = []*anonymizer.Entity{}
+	}
+	return &doc, nil
+}
+
+func decodeEntitiesJSONL(data []byte, doc *EntitiesDocument) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+
+	header := true
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		if header {
+			if err := json.Unmarshal(text, &doc.EntitiesMetadata); err != nil {
+				return eris.Wrapf(err, "failed to parse entities JSONL metadata at line %d", line)
+			}
+			header = false
+			continue
+		}
+
+		var entity anonymizer.Entity
+		if err := json.Unmarshal(text, &entity); err != nil {
+			return eris.Wrapf(err, "failed to parse entity at line %d", line)
+		}
+		doc.Entities = append(doc.Entities, &entity)
+	}
+	if err := scanner.Err(); err != nil {
+		return eris.Wrap(err, "failed to read entities JSONL")
+	}
 	return nil
 }
 
-// LoadEntitiesFromYAML loads entities from a YAML file using viper.
-func LoadEntitiesFromYAML(file string) ([]*anonymizer.Entity, error) {
-	if _, err := os.Stat(file); os.IsNotExist(err) {
+// entityV0 is an entity of a version 0 file, whose YAML keys are the lowercased field names.
+type entityV0 struct {
+	Key        string   `yaml:"key"`
+	EntityType string   `yaml:"entitytype"`
+	ID         string   `yaml:"id"`
+	Category   string   `yaml:"category"`
+	Detail     string   `yaml:"detail"`
+	Values     []string `yaml:"values"`
+	Pseudonym  string   `yaml:"pseudonym"`
+	Spans      []struct {
+		Value           string `yaml:"value"`
+		Start           int    `yaml:"start"`
+		End             int    `yaml:"end"`
+		AnonymizedStart int    `yaml:"anonymizedstart"`
+		AnonymizedEnd   int    `yaml:"anonymizedend"`
+	} `yaml:"spans"`
+}
+
+// migrateEntitiesV0 converts an unversioned YAML file to the current document version.
+// Version 0 files have no metadata, so the migrated document has none either.
+func migrateEntitiesV0(data []byte) (*EntitiesDocument, error) {
+	var legacy struct {
+		Entities []*entityV0 `yaml:"entities"`
+	}
+	if err := yaml.Unmarshal(data, &legacy); err != nil {
+		return nil, eris.Wrap(err, "failed to parse version 0 entities YAML")
+	}
+
+	doc := &EntitiesDocument{
+		EntitiesMetadata: EntitiesMetadata{Version: EntitiesVersion},
+		Entities:         make([]*anonymizer.Entity, 0, len(legacy.Entities)),
+	}
+	for _, old := range legacy.Entities {
+		entity := &anonymizer.Entity{
+			Key:        old.Key,
+			EntityType: old.EntityType,
+			ID:         old.ID,
+			Category:   old.Category,
+			Detail:     old.Detail,
+			Values:     old.Values,
+			Pseudonym:  old.Pseudonym,
+		}
+		for _, span := range old.Spans {
+			entity.Spans = append(entity.Spans, anonymizer.Span{
+				Value:           span.Value,
+				Start:           span.Start,
+				End:             span.End,
+				AnonymizedStart: span.AnonymizedStart,
+				AnonymizedEnd:   span.AnonymizedEnd,
+			})
+		}
+		doc.Entities = append(doc.Entities, entity)
+	}
+	return doc, nil
+}
+
+// SaveEntities writes a document to file in the format given by its extension.
+// If key is not nil the file is encrypted and only readable by its owner.
+func SaveEntities(doc *EntitiesDocument, file string, key *EntitiesKey) error {
+	data, err := EncodeEntities(doc, DetectEntitiesFormat(file))
+	if err != nil {
+		return err
+	}
+
+	perm := os.FileMode(0644)
+	if key != nil {
+		data, err = EncryptEntities(data, key)
+		if err != nil {
+			return err
+		}
+		perm = 0600
+	}
+
+	if err := os.WriteFile(file, data, perm); err != nil {
+		return eris.Wrapf(err, "failed to write entities file: %s", file)
+	}
+
+	return nil
+}
+
+// LoadEntitiesDocument reads a plain or an encrypted entities file in the format given by its extension.
+// The key is only resolved if the file is encrypted, so plain files never prompt for a passphrase.
+func LoadEntitiesDocument(file string, resolveKey func() (*EntitiesKey, error)) (*EntitiesDocument, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
 		return nil, eris.Errorf("entities file does not exist: %s", file)
+	} else if err != nil {
+		return nil, eris.Wrapf(err, "failed to read entities file: %s", file)
 	}
 
-	v := viper.New()
-	v.SetConfigFile(file)
-	v.SetConfigType("yaml")
+	if IsEncryptedEntities(data) {
+		key, err := resolveKey()
+		if err != nil {
+			return nil, err
+		}
+		data, err = DecryptEntities(data, key)
+		if err != nil {
+			return nil, eris.Wrapf(err, "failed to read entities file: %s", file)
+		}
+	}
 
-	if err := v.ReadInConfig(); err != nil {
+	doc, err := DecodeEntities(data, DetectEntitiesFormat(file))
+	if err != nil {
 		return nil, eris.Wrapf(err, "failed to read entities file: %s", file)
 	}
+	return doc, nil
+}
 
-	var config EntitiesConfig
-	if err := v.Unmarshal(&config); err != nil {
-		return nil, eris.Wrapf(err, "failed to parse entities from YAML file: %s", file)
+// SaveEntitiesToYAML saves entities to a YAML file.
+func SaveEntitiesToYAML(entities []*anonymizer.Entity, file string) error {
+	return SaveEntities(NewEntitiesDocument(entities), file, nil)
+}
+
+// SaveEncryptedEntities saves entities to a file encrypted with key.
+func SaveEncryptedEntities(entities []*anonymizer.Entity, file string, key *EntitiesKey) error {
+	return SaveEntities(NewEntitiesDocument(entities), file, key)
+}
+
+// LoadEntitiesFromYAML loads entities from a plain entities file.
+func LoadEntitiesFromYAML(file string) ([]*anonymizer.Entity, error) {
+	return LoadEntities(file, func() (*EntitiesKey, error) {
+		return nil, eris.Errorf("entities file is encrypted, a key is required: %s", file)
+	})
+}
+
+// LoadEntities loads entities for restoration from a plain or an encrypted entities file.
+func LoadEntities(file string, resolveKey func() (*EntitiesKey, error)) ([]*anonymizer.Entity, error) {
+	doc, err := LoadEntitiesDocument(file, resolveKey)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Redacted {
+		return nil, eris.Errorf("entities file is redacted and cannot be used for restoration: %s", file)
 	}
 
 	// Empty entities list is valid
-	return config.Entities, nil
+	return doc.Entities, nil
 }
@@ -0,0 +1,295 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/rotisserie/eris"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+)
+
+// RedactedValue replaces the entity values of a redacted entities document.
+const RedactedValue = "[REDACTED]"
+
+// copyEntity returns a deep copy of entity.
+func copyEntity(entity *anonymizer.Entity) *anonymizer.Entity {
+	copied := *entity
+	copied.Values = append([]string(nil), entity.Values...)
+	copied.Spans = append([]anonymizer.Span(nil), entity.Spans...)
+	return &copied
+}
+
+// MergeEntitiesDocuments merges the entities of several documents, for example from several anonymize runs.
+// Entities with the same key, compared like restore compares placeholders, are combined if they share a value and have the same pseudonym; a key used
+// for unrelated values in different documents is a conflict, to be resolved with RenameEntity first.
+// Spans are dropped because they refer to a single text. Metadata is kept where all documents agree.
+func MergeEntitiesDocuments(docs ...*EntitiesDocument) (*EntitiesDocument, error) {
+	merged := NewEntitiesDocument(nil)
+	byKey := make(map[string]*anonymizer.Entity)
+
+	for i, doc := range docs {
+		if i == 0 {
+			merged.Model = doc.Model
+			merged.SourceHash = doc.SourceHash
+		}
+		if merged.Model != doc.Model {
+			merged.Model = ""
+		}
+		if merged.SourceHash != doc.SourceHash {
+			merged.SourceHash = ""
+		}
+		for _, entityType := range doc.EntityTypes {
+			if !containsString(merged.EntityTypes, entityType) {
+				merged.EntityTypes = append(merged.EntityTypes, entityType)
+			}
+		}
+		if doc.Redacted {
+			merged.Redacted = true
+		}
+
+		for _, entity := range doc.Entities {
+			key := anonymizer.NormalizePlaceholder(entity.Key)
+			existing, ok := byKey[key]
+			if !ok {
+				copied := copyEntity(entity)
+				copied.Spans = nil
+				byKey[key] = copied
+				merged.Entities = append(merged.Entities, copied)
+				continue
+			}
+
+			if !sharesValue(existing.Values, entity.Values) || existing.Pseudonym != entity.Pseudonym {
+				return nil, eris.Errorf("conflicting entities for %s: %v and %v", entity.Key, existing.Values, entity.Values)
+			}
+			for _, value := range entity.Values {
+				if !containsString(existing.Values, value) {
+					existing.Values = append(existing.Values, value)
+				}
+			}
+		}
+	}
+
+	return merged, nil
+}
+
+func sharesValue(a, b []string) bool {
+	for _, value := range b {
+		if containsString(a, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// EntityChange is an entity whose type, category, detail, values or pseudonym differ between two documents.
+type EntityChange struct {
+	Old *anonymizer.Entity
+	New *anonymizer.Entity
+}
+
+// EntitiesDiff lists the differences between two entity lists, each sorted by key.
+type EntitiesDiff struct {
+	Added   []*anonymizer.Entity
+	Removed []*anonymizer.Entity
+	Changed []EntityChange
+}
+
+// IsEmpty returns true if the entity lists are equivalent.
+func (d *EntitiesDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffEntities compares two entity lists by key, compared like restore compares placeholders. Spans are ignored.
+func DiffEntities(before, after []*anonymizer.Entity) *EntitiesDiff {
+	oldByKey := make(map[string]*anonymizer.Entity, len(before))
+	for _, entity := range before {
+		oldByKey[anonymizer.NormalizePlaceholder(entity.Key)] = entity
+	}
+	newByKey := make(map[string]*anonymizer.Entity, len(after))
+	for _, entity := range after {
+		newByKey[anonymizer.NormalizePlaceholder(entity.Key)] = entity
+	}
+
+	diff := &EntitiesDiff{}
+	for key, entity := range newByKey {
+		previous, ok := oldByKey[key]
+		if !ok {
+			diff.Added = append(diff.Added, entity)
+		} else if !sameEntity(previous, entity) {
+			diff.Changed = append(diff.Changed, EntityChange{Old: previous, New: entity})
+		}
+	}
+	for key, entity := range oldByKey {
+		if _, ok := newByKey[key]; !ok {
+			diff.Removed = append(diff.Removed, entity)
+		}
+	}
+
+	sortEntities(diff.Added)
+	sortEntities(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return diff.Changed[i].New.Key < diff.Changed[j].New.Key
+	})
+	return diff
+}
+
+func sameEntity(a, b *anonymizer.Entity) bool {
+	return a.EntityType == b.EntityType &&
+		a.ID == b.ID &&
+		a.Category == b.Category &&
+		a.Detail == b.Detail &&
+		a.Pseudonym == b.Pseudonym &&
+		reflect.DeepEqual(a.Values, b.Values)
+}
+
+func sortEntities(entities []*anonymizer.Entity) {
+	sort.Slice(entities, func(i, j int) bool {
+		return entities[i].Key < entities[j].Key
+	})
+}
+
+// RenameEntity changes the key of an entity, for example to resolve a merge conflict.
+// Only the mapping changes: anonymized texts using the old key must be updated separately.
+func RenameEntity(entities []*anonymizer.Entity, oldKey, newKey string) error {
+	renamed, err := anonymizer.ParseEntityKey(newKey)
+	if err != nil {
+		return eris.Wrap(err, "invalid new key")
+	}
+
+	// Keys are compared like restore matches placeholders
+	oldKey, newKey = anonymizer.NormalizePlaceholder(oldKey), anonymizer.NormalizePlaceholder(newKey)
+
+	var target *anonymizer.Entity
+	for _, entity := range entities {
+		switch anonymizer.NormalizePlaceholder(entity.Key) {
+		case oldKey:
+			target = entity
+		case newKey:
+			return eris.Errorf("entity already exists: %s", entity.Key)
+		}
+	}
+	if target == nil {
+		return eris.Errorf("entity not found: %s", oldKey)
+	}
+
+	target.Key = renamed.Key
+	target.EntityType = renamed.EntityType
+	target.ID = renamed.ID
+	target.Category = renamed.Category
+	target.Detail = renamed.Detail
+	return nil
+}
+
+// DropEntities removes false positives: the entities with the given keys, and the given values from
+// every entity. Entities left without values are removed too. Unknown keys and values are an error,
+// so that a typo does not silently keep a false positive.
+func DropEntities(entities []*anonymizer.Entity, keys, values []string) ([]*anonymizer.Entity, error) {
+	// Keys are compared like restore matches placeholders
+	droppedKeys := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		droppedKeys[anonymizer.NormalizePlaceholder(key)] = false
+	}
+	droppedValues := make(map[string]bool, len(values))
+
+	kept := make([]*anonymizer.Entity, 0, len(entities))
+	for _, entity := range entities {
+		key := anonymizer.NormalizePlaceholder(entity.Key)
+		if _, ok := droppedKeys[key]; ok {
+			droppedKeys[key] = true
+			continue
+		}
+
+		remaining := entity.Values[:0:0]
+		for _, value := range entity.Values {
+			if containsString(values, value) {
+				droppedValues[value] = true
+			} else {
+				remaining = append(remaining, value)
+			}
+		}
+		if len(remaining) == len(entity.Values) {
+			kept = append(kept, entity)
+			continue
+		}
+		if len(remaining) == 0 {
+			continue
+		}
+
+		copied := copyEntity(entity)
+		copied.Values = remaining
+		copied.Spans = copied.Spans[:0]
+		for _, span := range entity.Spans {
+			if !containsString(values, span.Value) {
+				copied.Spans = append(copied.Spans, span)
+			}
+		}
+		kept = append(kept, copied)
+	}
+
+	var missing []string
+	for _, key := range keys {
+		if !droppedKeys[anonymizer.NormalizePlaceholder(key)] {
+			missing = append(missing, key)
+		}
+	}
+	for _, value := range values {
+		if !droppedValues[value] {
+			missing = append(missing, value)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, eris.Errorf("not found in entities: %s", strings.Join(missing, ", "))
+	}
+
+	return kept, nil
+}
+
+// RedactEntitiesDocument returns a copy of the document for audit: every original value is replaced with
+// RedactedValue, keeping the number of values, the keys, the pseudonyms and the span offsets.
+// Redacted documents cannot be used for restoration.
+func RedactEntitiesDocument(doc *EntitiesDocument) *EntitiesDocument {
+	redacted := *doc
+	redacted.EntityTypes = append([]string(nil), doc.EntityTypes...)
+	redacted.Redacted = true
+	redacted.Entities = make([]*anonymizer.Entity, 0, len(doc.Entities))
+
+	for _, entity := range doc.Entities {
+		copied := copyEntity(entity)
+		for i := range copied.Values {
+			copied.Values[i] = RedactedValue
+		}
+		for i := range copied.Spans {
+			copied.Spans[i].Value = RedactedValue
+		}
+		redacted.Entities = append(redacted.Entities, copied)
+	}
+
+	return &redacted
+}
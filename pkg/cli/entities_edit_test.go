@@ -0,0 +1,230 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+)
+
+func newTestEntity(key string, values ...string) *anonymizer.Entity {
+	entity, err := anonymizer.ParseEntityKey(key)
+	if err != nil {
+		panic(err)
+	}
+	entity.Values = values
+	return entity
+}
+
+func TestMergeEntitiesDocuments(t *testing.T) {
+	first := NewEntitiesDocument([]*anonymizer.Entity{
+		newTestEntity("<个人信息[0].姓名.全名>", "张三"),
+		newTestEntity("<个人信息[1].电话.号码>", "13800138000"),
+	})
+	first.Model = "llm:gpt-4"
+	first.EntityTypes = []string{"个人信息"}
+	first.Entities[0].Spans = []anonymizer.Span{{Value: "张三", Start: 0, End: 2}}
+
+	second := NewEntitiesDocument([]*anonymizer.Entity{
+		newTestEntity("<个人信息[0].姓名.全名>", "张三", "老张"),
+		newTestEntity("<业务信息[0].项目.名称>", "星火计划"),
+	})
+	second.Model = "llm:gpt-4"
+	second.EntityTypes = []string{"个人信息", "业务信息"}
+
+	merged, err := MergeEntitiesDocuments(first, second)
+	if err != nil {
+		t.Fatalf("MergeEntitiesDocuments failed: %v", err)
+	}
+
+	expected := []*anonymizer.Entity{
+		newTestEntity("<个人信息[0].姓名.全名>", "张三", "老张"),
+		newTestEntity("<个人信息[1].电话.号码>", "13800138000"),
+		newTestEntity("<业务信息[0].项目.名称>", "星火计划"),
+	}
+	if !reflect.DeepEqual(merged.Entities, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, merged.Entities)
+	}
+	if merged.Model != "llm:gpt-4" || !reflect.DeepEqual(merged.EntityTypes, []string{"个人信息", "业务信息"}) {
+		t.Errorf("Unexpected metadata: %+v", merged.EntitiesMetadata)
+	}
+	if len(first.Entities[0].Spans) != 1 || len(first.Entities[0].Values) != 1 {
+		t.Errorf("Expected the inputs to be left unchanged, got %+v", first.Entities[0])
+	}
+
+	// Keys are compared like restore compares placeholders
+	variant := newTestEntity("<个人信息[0].姓名.全名>", "张三", "张先生")
+	variant.Key = "< 个人信息［０］. 姓名。全名 >"
+	merged, err = MergeEntitiesDocuments(first, NewEntitiesDocument([]*anonymizer.Entity{variant}))
+	if err != nil {
+		t.Fatalf("MergeEntitiesDocuments failed: %v", err)
+	}
+	if len(merged.Entities) != 2 || !reflect.DeepEqual(merged.Entities[0].Values, []string{"张三", "张先生"}) {
+		t.Errorf("Expected the variant key to be merged, got %+v", merged.Entities)
+	}
+
+	// The same key for unrelated values cannot be merged
+	conflict := NewEntitiesDocument([]*anonymizer.Entity{newTestEntity("<个人信息[0].姓名.全名>", "李四")})
+	if _, err := MergeEntitiesDocuments(first, conflict); err == nil {
+		t.Error("Expected a conflict error")
+	}
+}
+
+func TestDiffEntities(t *testing.T) {
+	before := []*anonymizer.Entity{
+		newTestEntity("<个人信息[0].姓名.全名>", "张三"),
+		newTestEntity("<个人信息[1].姓名.全名>", "李四"),
+		newTestEntity("<个人信息[2].电话.号码>", "13800138000"),
+	}
+	after := []*anonymizer.Entity{
+		newTestEntity("<个人信息[0].姓名.全名>", "张三"),
+		newTestEntity("<个人信息[1].姓名.全名>", "李四", "小李"),
+		newTestEntity("<业务信息[0].项目.名称>", "星火计划"),
+	}
+
+	diff := DiffEntities(before, after)
+	if len(diff.Added) != 1 || diff.Added[0].Key != "<业务信息[0].项目.名称>" {
+		t.Errorf("Unexpected added entities: %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Key != "<个人信息[2].电话.号码>" {
+		t.Errorf("Unexpected removed entities: %+v", diff.Removed)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Old != before[1] || diff.Changed[0].New != after[1] {
+		t.Errorf("Unexpected changed entities: %+v", diff.Changed)
+	}
+
+	if !DiffEntities(before, before).IsEmpty() {
+		t.Error("Expected no difference between identical lists")
+	}
+
+	// A whitespace or fullwidth variant of a key is the same entity
+	variant := newTestEntity("<个人信息[0].姓名.全名>", "张三")
+	variant.Key = "< 个人信息［０］ .姓名.全名>"
+	if diff := DiffEntities(before[:1], []*anonymizer.Entity{variant}); !diff.IsEmpty() {
+		t.Errorf("Expected no difference for a variant key, got %+v", diff)
+	}
+}
+
+func TestRenameEntity(t *testing.T) {
+	entities := []*anonymizer.Entity{
+		newTestEntity("<个人信息[0].姓名.全名>", "张三"),
+		newTestEntity("<个人信息[1].姓名.全名>", "李四"),
+	}
+
+	if err := RenameEntity(entities, "<个人信息[1].姓名.全名>", "<个人信息[7].姓名.昵称>"); err != nil {
+		t.Fatalf("RenameEntity failed: %v", err)
+	}
+	if expected := newTestEntity("<个人信息[7].姓名.昵称>", "李四"); !reflect.DeepEqual(entities[1], expected) {
+		t.Errorf("Expected %+v, got %+v", expected, entities[1])
+	}
+
+	for _, keys := range [][2]string{
+		{"<个人信息[9].姓名.全名>", "<个人信息[8].姓名.全名>"},
+		{"<个人信息[0].姓名.全名>", "<个人信息[7].姓名.昵称>"},
+		{"<个人信息[0].姓名.全名>", "个人信息 0"},
+	} {
+		if err := RenameEntity(entities, keys[0], keys[1]); err == nil {
+			t.Errorf("Expected an error renaming %s to %s", keys[0], keys[1])
+		}
+	}
+
+	// Keys are matched like restore matches placeholders, a variant key collides with the new key
+	variant := newTestEntity("<个人信息[2].姓名.全名>", "王五")
+	variant.Key = "<个人信息 [2]。姓名.全名>"
+	entities = append(entities, variant)
+	if err := RenameEntity(entities, "<个人信息[0].姓名.全名>", "<个人信息[2].姓名.全名>"); err == nil {
+		t.Error("Expected an error renaming to a key that collides once normalized")
+	}
+	if err := RenameEntity(entities, "<个人信息 [0].姓名.全名>", "<个人信息[3].姓名.全名>"); err != nil || entities[0].Key != "<个人信息[3].姓名.全名>" {
+		t.Errorf("Expected a variant old key to rename the entity, got %+v, %v", entities[0], err)
+	}
+}
+
+func TestDropEntities(t *testing.T) {
+	names := newTestEntity("<个人信息[0].姓名.全名>", "张三", "老张")
+	names.Spans = []anonymizer.Span{{Value: "张三", Start: 0, End: 2}, {Value: "老张", Start: 5, End: 7}}
+	entities := []*anonymizer.Entity{
+		names,
+		newTestEntity("<业务信息[0].系统.名称>", "Linux"),
+		newTestEntity("<业务信息[1].项目.名称>", "星火计划"),
+	}
+
+	kept, err := DropEntities(entities, []string{"<业务信息[0].系统.名称>"}, []string{"老张"})
+	if err != nil {
+		t.Fatalf("DropEntities failed: %v", err)
+	}
+
+	expected := newTestEntity("<个人信息[0].姓名.全名>", "张三")
+	expected.Spans = []anonymizer.Span{{Value: "张三", Start: 0, End: 2}}
+	if len(kept) != 2 || !reflect.DeepEqual(kept[0], expected) || kept[1] != entities[2] {
+		t.Errorf("Unexpected remaining entities: %+v", kept)
+	}
+	if len(names.Values) != 2 {
+		t.Errorf("Expected the input to be left unchanged, got %+v", names)
+	}
+
+	// Keys are matched like restore matches placeholders
+	kept, err = DropEntities(entities, []string{"<业务信息 [0]。系统.名称>"}, nil)
+	if err != nil || len(kept) != 2 || kept[1] != entities[2] {
+		t.Errorf("Expected a variant key to drop the entity, got %+v, %v", kept, err)
+	}
+
+	// Dropping the last value drops the entity
+	kept, err = DropEntities(entities, nil, []string{"星火计划"})
+	if err != nil || len(kept) != 2 {
+		t.Errorf("Expected the entity without values to be dropped, got %+v, %v", kept, err)
+	}
+
+	if _, err := DropEntities(entities, []string{"<业务信息[9].系统.名称>"}, nil); err == nil {
+		t.Error("Expected an error for an unknown key")
+	}
+	if _, err := DropEntities(entities, nil, []string{"王五"}); err == nil {
+		t.Error("Expected an error for an unknown value")
+	}
+}
+
+func TestRedactEntitiesDocument(t *testing.T) {
+	entity := newTestEntity("<个人信息[0].姓名.全名>", "张三", "老张")
+	entity.Pseudonym = "王伟"
+	entity.Spans = []anonymizer.Span{{Value: "张三", Start: 0, End: 2, AnonymizedStart: 0, AnonymizedEnd: 2}}
+	doc := NewEntitiesDocument([]*anonymizer.Entity{entity})
+	doc.SourceHash = HashSource("张三")
+
+	redacted := RedactEntitiesDocument(doc)
+
+	expected := newTestEntity("<个人信息[0].姓名.全名>", RedactedValue, RedactedValue)
+	expected.Pseudonym = "王伟"
+	expected.Spans = []anonymizer.Span{{Value: RedactedValue, Start: 0, End: 2, AnonymizedStart: 0, AnonymizedEnd: 2}}
+	if !redacted.Redacted || redacted.SourceHash != doc.SourceHash || !reflect.DeepEqual(redacted.Entities[0], expected) {
+		t.Errorf("Unexpected redacted document: %+v, %+v", redacted.EntitiesMetadata, redacted.Entities[0])
+	}
+	if doc.Redacted || entity.Values[0] != "张三" || entity.Spans[0].Value != "张三" {
+		t.Errorf("Expected the original document to be left unchanged, got %+v", entity)
+	}
+
+	// Redacted files cannot be used for restoration
+	file := filepath.Join(t.TempDir(), "redacted.yaml")
+	if err := SaveEntities(redacted, file, nil); err != nil {
+		t.Fatalf("SaveEntities failed: %v", err)
+	}
+	if _, err := LoadEntitiesFromYAML(file); err == nil {
+		t.Error("Expected an error loading a redacted file for restoration")
+	}
+}
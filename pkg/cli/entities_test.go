@@ -18,7 +18,11 @@ package cli
 
 import (
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/mrlyc/inu/pkg/anonymizer"
 )
@@ -89,6 +93,41 @@ func TestSaveAndLoadEntities(t *testing.T) {
 	}
 }
 
+func TestSaveAndLoadEntities_Spans(t *testing.T) {
+	testEntities := []*anonymizer.Entity{
+		{
+			Key:    "<个人信息[0].姓名.全名>",
+			Values: []string{"张三"},
+			Spans: []anonymizer.Span{
+				{Value: "张三", Start: 0, End: 2, AnonymizedStart: 0, AnonymizedEnd: 15},
+			},
+		},
+	}
+
+	tmpFile, err := os.CreateTemp("", "test-entities-*.yaml")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	_ = tmpFile.Close()
+	defer func() { _ = os.Remove(tmpFile.Name()) }()
+
+	if err := SaveEntitiesToYAML(testEntities, tmpFile.Name()); err != nil {
+		t.Fatalf("SaveEntitiesToYAML failed: %v", err)
+	}
+
+	loadedEntities, err := LoadEntitiesFromYAML(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("LoadEntitiesFromYAML failed: %v", err)
+	}
+
+	if len(loadedEntities) != 1 || len(loadedEntities[0].Spans) != 1 {
+		t.Fatalf("Expected 1 entity with 1 span, got %+v", loadedEntities)
+	}
+	if loadedEntities[0].Spans[0] != testEntities[0].Spans[0] {
+		t.Errorf("Expected span %+v, got %+v", testEntities[0].Spans[0], loadedEntities[0].Spans[0])
+	}
+}
+
 func TestLoadEntitiesFromYAML_FileNotFound(t *testing.T) {
 	_, err := LoadEntitiesFromYAML("/nonexistent/file.yaml")
 	if err == nil {
@@ -138,3 +177,163 @@ func TestSaveEntitiesToYAML_EmptyEntities(t *testing.T) {
 		t.Errorf("Expected 0 entities, got %d", len(loadedEntities))
 	}
 }
+
+func TestSaveAndLoadEntities_Pseudonym(t *testing.T) {
+	testEntities := []*anonymizer.Entity{
+		{Key: "<个人信息[0].姓名.全名>", Values: []string{"张三"}, Pseudonym: "李伟"},
+		{Key: "<个人信息[1].姓名.全名>", Values: []string{"李四"}},
+	}
+
+	file := filepath.Join(t.TempDir(), "entities.yaml")
+	if err := SaveEntitiesToYAML(testEntities, file); err != nil {
+		t.Fatalf("SaveEntitiesToYAML failed: %v", err)
+	}
+
+	loadedEntities, err := LoadEntitiesFromYAML(file)
+	if err != nil {
+		t.Fatalf("LoadEntitiesFromYAML failed: %v", err)
+	}
+
+	if len(loadedEntities) != 2 || loadedEntities[0].Pseudonym != "李伟" || loadedEntities[1].Pseudonym != "" {
+		t.Errorf("Expected the pseudonyms to round trip, got %+v", loadedEntities)
+	}
+}
+
+func TestSaveAndLoadEntities_Formats(t *testing.T) {
+	doc := NewEntitiesDocument([]*anonymizer.Entity{
+		{
+			Key:        "<PersonInfo[0].Name.Full>",
+			EntityType: "PersonInfo",
+			ID:         "0",
+			Category:   "Name",
+			Detail:     "Full",
+			Values:     []string{"张三", "Zhang San"},
+			Spans:      []anonymizer.Span{{Value: "张三", Start: 0, End: 2, AnonymizedStart: 0, AnonymizedEnd: 25}},
+		},
+		{Key: "<个人信息[1].邮箱.地址>", EntityType: "个人信息", ID: "1", Category: "邮箱", Detail: "地址", Values: []string{"a@b.cn"}},
+	})
+	doc.Model = "llm:gpt-4"
+	doc.EntityTypes = []string{"PersonInfo", "个人信息"}
+	doc.SourceHash = HashSource("张三 a@b.cn")
+
+	for _, name := range []string{"entities.yaml", "entities.json", "entities.jsonl"} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), name)
+			if err := SaveEntities(doc, file, nil); err != nil {
+				t.Fatalf("SaveEntities failed: %v", err)
+			}
+
+			loaded, err := LoadEntitiesDocument(file, nil)
+			if err != nil {
+				t.Fatalf("LoadEntitiesDocument failed: %v", err)
+			}
+			if !reflect.DeepEqual(loaded, doc) {
+				t.Errorf("Expected %+v, got %+v", doc, loaded)
+			}
+		})
+	}
+}
+
+func TestEncodeEntities_JSONL(t *testing.T) {
+	doc := NewEntitiesDocument([]*anonymizer.Entity{
+		{Key: "<个人信息[0].姓名.全名>", Values: []string{"张三"}},
+		{Key: "<个人信息[1].姓名.全名>", Values: []string{"李四"}},
+	})
+
+	data, err := EncodeEntities(doc, EntitiesJSONL)
+	if err != nil {
+		t.Fatalf("EncodeEntities failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], `"version":1`) || !strings.Contains(lines[2], "李四") {
+		t.Errorf("Expected a metadata line and one line per entity, got %q", data)
+	}
+}
+
+func TestLoadEntities_MigratesV0(t *testing.T) {
+	// Written by SaveEntitiesToYAML before entities files were versioned
+	content := `entities:
+    - key: <个人信息[0].姓名.全名>
+      entitytype: 个人信息
+      id: "0"
+      category: 姓名
+      detail: 全名
+      values:
+        - 张三
+      spans:
+        - value: 张三
+          start: 0
+          end: 2
+          anonymizedstart: 3
+          anonymizedend: 18
+`
+	file := filepath.Join(t.TempDir(), "entities.yaml")
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write entities file: %v", err)
+	}
+
+	doc, err := LoadEntitiesDocument(file, nil)
+	if err != nil {
+		t.Fatalf("LoadEntitiesDocument failed: %v", err)
+	}
+
+	expected := []*anonymizer.Entity{{
+		Key:        "<个人信息[0].姓名.全名>",
+		EntityType: "个人信息",
+		ID:         "0",
+		Category:   "姓名",
+		Detail:     "全名",
+		Values:     []string{"张三"},
+		Spans:      []anonymizer.Span{{Value: "张三", Start: 0, End: 2, AnonymizedStart: 3, AnonymizedEnd: 18}},
+	}}
+	if doc.Version != EntitiesVersion || !reflect.DeepEqual(doc.Entities, expected) {
+		t.Errorf("Expected a migrated document with %+v, got %+v", expected, doc)
+	}
+}
+
+func TestDecodeEntities_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		format EntitiesFormat
+	}{
+		{name: "newer version", data: "version: 99\nentities: []\n", format: EntitiesYAML},
+		{name: "JSON without version", data: `{"entities": []}`, format: EntitiesJSON},
+		{name: "malformed JSONL entity", data: "{\"version\":1}\n{\"key\":\n", format: EntitiesJSONL},
+		{name: "unknown format", data: "", format: "toml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeEntities([]byte(tt.data), tt.format); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestNewEntitiesDocument(t *testing.T) {
+	doc := NewEntitiesDocument(nil)
+	if doc.Version != EntitiesVersion || doc.Entities == nil || time.Since(doc.CreatedAt) > time.Minute {
+		t.Errorf("Unexpected document: %+v", doc)
+	}
+	if HashSource("a") == HashSource("b") || !strings.HasPrefix(HashSource("a"), "sha256:") {
+		t.Errorf("Unexpected source hash: %s", HashSource("a"))
+	}
+}
+
+func TestDetectEntitiesFormat(t *testing.T) {
+	for file, expected := range map[string]EntitiesFormat{
+		"entities.yaml":   EntitiesYAML,
+		"entities.yml":    EntitiesYAML,
+		"entities.enc":    EntitiesYAML,
+		"entities.JSON":   EntitiesJSON,
+		"entities.jsonl":  EntitiesJSONL,
+		"entities.ndjson": EntitiesJSONL,
+	} {
+		if format := DetectEntitiesFormat(file); format != expected {
+			t.Errorf("DetectEntitiesFormat(%q) = %s, expected %s", file, format, expected)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rotisserie/eris"
+	"github.com/spf13/viper"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+)
+
+// LoadEntityTypeSchema loads an entity type schema from a YAML or JSON file (chosen by extension).
+func LoadEntityTypeSchema(file string) (*anonymizer.EntityTypeSchema, error) {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil, eris.Errorf("entity type schema file does not exist: %s", file)
+	}
+
+	// The config type is inferred from the extension
+	v := viper.New()
+	v.SetConfigFile(file)
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, eris.Wrapf(err, "failed to read entity type schema: %s", file)
+	}
+
+	var schema anonymizer.EntityTypeSchema
+	if err := v.Unmarshal(&schema); err != nil {
+		return nil, eris.Wrapf(err, "failed to parse entity type schema: %s", file)
+	}
+	if err := schema.Validate(); err != nil {
+		return nil, eris.Wrapf(err, "invalid entity type schema: %s", file)
+	}
+
+	return &schema, nil
+}
+
+// ResolveEntityTypes interprets the --entity-types flag: either a list of type names, described by
+// the built-in schema where it defines them, or a single path to a .yaml, .yml or .json schema file.
+// It returns the type names to detect and the schema describing them.
+func ResolveEntityTypes(values []string) ([]string, *anonymizer.EntityTypeSchema, error) {
+	if len(values) == 1 && isSchemaFile(values[0]) {
+		schema, err := LoadEntityTypeSchema(values[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		return schema.Names(), schema, nil
+	}
+
+	names := make([]string, 0, len(values))
+	for _, value := range values {
+		if isSchemaFile(value) {
+			return nil, nil, eris.Errorf("an entity type schema file cannot be combined with other entity types: %s", value)
+		}
+		if name := strings.TrimSpace(value); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil, eris.New("no entity types specified")
+	}
+
+	return names, anonymizer.DefaultEntityTypeSchema, nil
+}
+
+// isSchemaFile returns true if value names an entity type schema file.
+func isSchemaFile(value string) bool {
+	switch strings.ToLower(filepath.Ext(value)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+)
+
+func TestLoadEntityTypeSchema(t *testing.T) {
+	expected := &anonymizer.EntityTypeSchema{
+		Types: []*anonymizer.EntityTypeDefinition{
+			{
+				Name:            "客户",
+				Description:     "客户公司名称",
+				Examples:        []string{"某某科技"},
+				CounterExamples: []string{"供应商"},
+				Categories: []anonymizer.CategoryDefinition{
+					{Name: "公司", Details: []string{"全称", "简称"}},
+				},
+			},
+		},
+	}
+
+	files := map[string]string{
+		"schema.yaml": `types:
+  - name: 客户
+    description: 客户公司名称
+    examples: [某某科技]
+    counter_examples: [供应商]
+    categories:
+      - name: 公司
+        details: [全称, 简称]
+`,
+		"schema.json": `{"types": [{"name": "客户", "description": "客户公司名称", "examples": ["某某科技"],
+"counter_examples": ["供应商"], "categories": [{"name": "公司", "details": ["全称", "简称"]}]}]}`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), name)
+			if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write schema: %v", err)
+			}
+
+			schema, err := LoadEntityTypeSchema(file)
+			if err != nil {
+				t.Fatalf("Failed to load schema: %v", err)
+			}
+			if !reflect.DeepEqual(schema, expected) {
+				t.Errorf("Unexpected schema: %+v", schema.Types[0])
+			}
+		})
+	}
+}
+
+func TestLoadEntityTypeSchema_Invalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "schema.yaml")
+	if err := os.WriteFile(file, []byte("types:\n  - name: 客户\n  - name: 客户\n"), 0644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+
+	if _, err := LoadEntityTypeSchema(file); err == nil {
+		t.Error("Expected an error for duplicate entity types")
+	}
+	if _, err := LoadEntityTypeSchema(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestResolveEntityTypes(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "types.yml")
+	if err := os.WriteFile(file, []byte("types:\n  - name: 客户\n  - name: 供应商\n"), 0644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+
+	types, schema, err := ResolveEntityTypes([]string{file})
+	if err != nil {
+		t.Fatalf("Failed to resolve schema file: %v", err)
+	}
+	if !reflect.DeepEqual(types, []string{"客户", "供应商"}) || schema.Lookup("供应商") == nil {
+		t.Errorf("Unexpected types from schema file: %v", types)
+	}
+
+	types, schema, err = ResolveEntityTypes([]string{"个人信息", " 客户 "})
+	if err != nil {
+		t.Fatalf("Failed to resolve names: %v", err)
+	}
+	if !reflect.DeepEqual(types, []string{"个人信息", "客户"}) || schema != anonymizer.DefaultEntityTypeSchema {
+		t.Errorf("Unexpected types from names: %v", types)
+	}
+
+	if _, _, err := ResolveEntityTypes([]string{"个人信息", file}); err == nil {
+		t.Error("Expected an error when combining a schema file with names")
+	}
+	if _, _, err := ResolveEntityTypes([]string{""}); err == nil {
+		t.Error("Expected an error for empty entity types")
+	}
+}
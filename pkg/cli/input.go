@@ -22,6 +22,8 @@ import (
 	"os"
 
 	"github.com/rotisserie/eris"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
 )
 
 // ReadInput reads input from file, content string, or stdin with priority: file > content > stdin.
@@ -58,7 +60,12 @@ func ReadInput(file, content string, stdin io.Reader) (string, error) {
 }
 
 // CheckRequiredEnvVars checks if required environment variables are set and returns a friendly error.
+// Nothing is required when LLM fixtures are replayed.
 func CheckRequiredEnvVars() error {
+	if os.Getenv(anonymizer.FixtureModeEnv) == string(anonymizer.FixtureReplay) {
+		return nil
+	}
+
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	modelName := os.Getenv("OPENAI_MODEL_NAME")
 
@@ -20,6 +20,8 @@ import (
 	"os"
 	"strings"
 	"testing"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
 )
 
 func TestReadInput_FromFile(t *testing.T) {
@@ -166,3 +168,13 @@ func TestCheckRequiredEnvVars(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckRequiredEnvVars_FixtureReplay(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("OPENAI_MODEL_NAME", "")
+	t.Setenv(anonymizer.FixtureModeEnv, string(anonymizer.FixtureReplay))
+
+	if err := CheckRequiredEnvVars(); err != nil {
+		t.Errorf("Expected no error when replaying fixtures but got: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/rotisserie/eris"
+)
+
+// IDKeyEnv is the environment variable holding the secret of keyed entity IDs.
+const IDKeyEnv = "INU_ID_KEY"
+
+// LoadIDKey reads the secret of keyed entity IDs from file, or from IDKeyEnv if file is empty.
+// Surrounding whitespace (such as the trailing newline of a key file) is removed.
+func LoadIDKey(file string) ([]byte, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, eris.Wrapf(err, "failed to read ID key file: %s", file)
+		}
+		key := bytes.TrimSpace(data)
+		if len(key) == 0 {
+			return nil, eris.Errorf("ID key file is empty: %s", file)
+		}
+		return key, nil
+	}
+
+	key := bytes.TrimSpace([]byte(os.Getenv(IDKeyEnv)))
+	if len(key) == 0 {
+		return nil, eris.Errorf("keyed IDs require a secret: set %s or use --id-key-file", IDKeyEnv)
+	}
+	return key, nil
+}
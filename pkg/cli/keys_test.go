@@ -0,0 +1,52 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadIDKey(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "id.key")
+	if err := os.WriteFile(file, []byte("file-secret\n"), 0600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+	t.Setenv(IDKeyEnv, "env-secret")
+
+	key, err := LoadIDKey(file)
+	if err != nil || string(key) != "file-secret" {
+		t.Errorf("expected the key from the file, got %q, %v", key, err)
+	}
+
+	key, err = LoadIDKey("")
+	if err != nil || string(key) != "env-secret" {
+		t.Errorf("expected the key from the environment, got %q, %v", key, err)
+	}
+}
+
+func TestLoadIDKey_Missing(t *testing.T) {
+	t.Setenv(IDKeyEnv, "")
+
+	if _, err := LoadIDKey(""); err == nil {
+		t.Error("expected an error without a key")
+	}
+	if _, err := LoadIDKey("/nonexistent/id.key"); err == nil {
+		t.Error("expected an error for a missing key file")
+	}
+}
@@ -65,6 +65,36 @@ func WriteEntitiesToStderr(entities []*anonymizer.Entity, noPrint bool) {
 	}
 }
 
+// WriteLeakReport writes leaked entity values found after anonymization to stderr.
+// Nothing is written if the report has no leaks.
+func WriteLeakReport(report *anonymizer.LeakReport) {
+	if !report.HasLeaks() {
+		return
+	}
+
+	if report.Remasked {
+		fmt.Fprintf(os.Stderr, "\nWarning: %d leaked value(s) were found and re-masked:\n", len(report.Leaks))
+	} else {
+		fmt.Fprintf(os.Stderr, "\nWarning: %d leaked value(s) remain in the anonymized text (use --strict to re-mask):\n", len(report.Leaks))
+	}
+	for _, leak := range report.Leaks {
+		fmt.Fprintf(os.Stderr, "  - %q at %d-%d (%s)\n", leak.Text, leak.Start, leak.End, leak.Placeholder)
+	}
+}
+
+// WriteValidationIssues writes inconsistencies between the entity mapping and the text to stderr.
+// Nothing is written if there are no issues.
+func WriteValidationIssues(issues []anonymizer.ValidationIssue) {
+	if len(issues) == 0 {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "\nWarning: %d entity mapping issue(s) found:\n", len(issues))
+	for _, issue := range issues {
+		fmt.Fprintf(os.Stderr, "  - [%s] %s\n", issue.Kind, issue)
+	}
+}
+
 // PrintEntitiesSimplified is deprecated. Use WriteEntitiesToStderr instead.
 // Kept for backward compatibility during transition.
 func PrintEntitiesSimplified(entities []*anonymizer.Entity) {
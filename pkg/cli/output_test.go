@@ -136,3 +136,30 @@ func TestWriteEntitiesToStderr_NilEntities(t *testing.T) {
 	WriteEntitiesToStderr(nil, false)
 	// Should not output anything
 }
+
+func TestWriteLeakReport(t *testing.T) {
+	// Test with nil and empty reports
+	WriteLeakReport(nil)
+	WriteLeakReport(&anonymizer.LeakReport{})
+
+	// Test with leaks
+	WriteLeakReport(&anonymizer.LeakReport{
+		Leaks: []anonymizer.Leak{
+			{Placeholder: "<个人信息[0].姓名.全名>", Value: "张三", Text: "张三", Start: 0, End: 6},
+		},
+		Remasked: true,
+	})
+	// Note: This test only verifies no panic/error occurs
+}
+
+func TestWriteValidationIssues(t *testing.T) {
+	// Test with no issues
+	WriteValidationIssues(nil)
+
+	// Test with issues
+	WriteValidationIssues([]anonymizer.ValidationIssue{
+		{Kind: anonymizer.IssueHallucinatedValue, Placeholder: "<个人信息[0].姓名.全名>", Value: "王五"},
+		{Kind: anonymizer.IssueMissingMapping, Placeholder: "<个人信息[1].姓名.全名>"},
+	})
+	// Note: This test only verifies no panic/error occurs
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"os"
+
+	"github.com/rotisserie/eris"
+	"github.com/spf13/viper"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+)
+
+// LoadPromptTemplateSet loads prompt templates from a YAML or JSON file (chosen by extension) and validates them.
+func LoadPromptTemplateSet(file string) (*anonymizer.PromptTemplateSet, error) {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil, eris.Errorf("prompt template file does not exist: %s", file)
+	}
+
+	// The config type is inferred from the extension
+	v := viper.New()
+	v.SetConfigFile(file)
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, eris.Wrapf(err, "failed to read prompt template file: %s", file)
+	}
+
+	var set anonymizer.PromptTemplateSet
+	if err := v.Unmarshal(&set); err != nil {
+		return nil, eris.Wrapf(err, "failed to parse prompt template file: %s", file)
+	}
+	if err := set.Validate(); err != nil {
+		return nil, eris.Wrapf(err, "invalid prompt template file: %s", file)
+	}
+
+	return &set, nil
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPromptTemplateSet(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "prompts.yaml")
+	content := `format: fstring
+language: zh-CN
+languages:
+  en:
+    user: "Types: {types}\n<text>{text}</text>"
+  zh-CN:
+    system: |
+      你是一个脱敏助手。
+      实体类型：{types}
+    user: "<text>{text}</text>"
+    examples:
+      - text: 李四来了
+        response: |
+          <个人信息[0].姓名.全名>来了
+          <<<PAIR>>>
+          {"<个人信息[0].姓名.全名>": ["李四"]}
+`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write prompt file: %v", err)
+	}
+
+	set, err := LoadPromptTemplateSet(file)
+	if err != nil {
+		t.Fatalf("Failed to load prompt file: %v", err)
+	}
+
+	template, err := set.Select("")
+	if err != nil {
+		t.Fatalf("Failed to select default language: %v", err)
+	}
+	if template.System != "你是一个脱敏助手。\n实体类型：{types}\n" {
+		t.Errorf("Unexpected system template: %q", template.System)
+	}
+	if len(template.Examples) != 1 || template.Examples[0].Text != "李四来了" {
+		t.Errorf("Unexpected examples: %+v", template.Examples)
+	}
+
+	if _, err := set.Select("EN"); err != nil {
+		t.Errorf("Failed to select en: %v", err)
+	}
+}
+
+func TestLoadPromptTemplateSet_Invalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "prompts.json")
+	if err := os.WriteFile(file, []byte(`{"languages": {"en": {"user": "no variables"}}}`), 0644); err != nil {
+		t.Fatalf("Failed to write prompt file: %v", err)
+	}
+
+	if _, err := LoadPromptTemplateSet(file); err == nil {
+		t.Error("Expected an error for a template without required variables")
+	}
+	if _, err := LoadPromptTemplateSet(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"os"
+	"strings"
+
+	"github.com/rotisserie/eris"
+	"github.com/spf13/viper"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+)
+
+// LoadTermLists loads allow and deny terms from a YAML or JSON file (chosen by extension) and validates them.
+func LoadTermLists(file string) (*anonymizer.TermLists, error) {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil, eris.Errorf("terms file does not exist: %s", file)
+	}
+
+	// The config type is inferred from the extension
+	v := viper.New()
+	v.SetConfigFile(file)
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, eris.Wrapf(err, "failed to read terms file: %s", file)
+	}
+
+	var lists anonymizer.TermLists
+	if err := v.Unmarshal(&lists); err != nil {
+		return nil, eris.Wrapf(err, "failed to parse terms file: %s", file)
+	}
+	if err := lists.Validate(); err != nil {
+		return nil, eris.Wrapf(err, "invalid terms file: %s", file)
+	}
+
+	return &lists, nil
+}
+
+// ParseDenyTerm parses a deny term given on the command line as TERM=TYPE.
+// The term is split at the last '=' so that it may itself contain '='.
+func ParseDenyTerm(value string) (anonymizer.DenyTerm, error) {
+	index := strings.LastIndex(value, "=")
+	if index < 0 {
+		return anonymizer.DenyTerm{}, eris.Errorf("deny term must be in the format TERM=TYPE: %s", value)
+	}
+
+	term := anonymizer.DenyTerm{
+		Value: strings.TrimSpace(value[:index]),
+		Type:  strings.TrimSpace(value[index+1:]),
+	}
+	if term.Value == "" || term.Type == "" {
+		return anonymizer.DenyTerm{}, eris.Errorf("deny term must be in the format TERM=TYPE: %s", value)
+	}
+	return term, nil
+}
+
+// ResolveTermLists combines the terms of the optional file with the allow and deny terms given
+// on the command line. It returns nil if no term is given.
+func ResolveTermLists(file string, allow, deny []string) (*anonymizer.TermLists, error) {
+	lists := &anonymizer.TermLists{}
+	if file != "" {
+		loaded, err := LoadTermLists(file)
+		if err != nil {
+			return nil, err
+		}
+		lists = loaded
+	}
+
+	lists.Allow = append(lists.Allow, allow...)
+	for _, value := range deny {
+		term, err := ParseDenyTerm(value)
+		if err != nil {
+			return nil, err
+		}
+		lists.Deny = append(lists.Deny, term)
+	}
+
+	if lists.IsEmpty() {
+		return nil, nil
+	}
+	if err := lists.Validate(); err != nil {
+		return nil, eris.Wrap(err, "invalid terms")
+	}
+	return lists, nil
+}
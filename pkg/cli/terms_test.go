@@ -0,0 +1,86 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+)
+
+func TestResolveTermLists(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "terms.yaml")
+	content := `allow:
+  - 某某科技
+deny:
+  - value: 星火计划
+    type: 业务信息
+    category: 项目
+    detail: 代号
+`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write terms file: %v", err)
+	}
+
+	lists, err := ResolveTermLists(file, []string{"Inu"}, []string{"a=b=业务信息"})
+	if err != nil {
+		t.Fatalf("Failed to resolve terms: %v", err)
+	}
+
+	expected := &anonymizer.TermLists{
+		Allow: []string{"某某科技", "Inu"},
+		Deny: []anonymizer.DenyTerm{
+			{Value: "星火计划", Type: "业务信息", Category: "项目", Detail: "代号"},
+			{Value: "a=b", Type: "业务信息"},
+		},
+	}
+	if !reflect.DeepEqual(lists, expected) {
+		t.Errorf("unexpected term lists: %+v", lists)
+	}
+}
+
+func TestResolveTermLists_Empty(t *testing.T) {
+	lists, err := ResolveTermLists("", nil, nil)
+	if err != nil || lists != nil {
+		t.Errorf("expected no term lists, got %+v, %v", lists, err)
+	}
+}
+
+func TestResolveTermLists_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		allow []string
+		deny  []string
+	}{
+		{name: "missing file", file: "/nonexistent/terms.yaml"},
+		{name: "deny term without type", deny: []string{"星火计划"}},
+		{name: "deny term with empty type", deny: []string{"星火计划="}},
+		{name: "term both allowed and denied", allow: []string{"星火计划"}, deny: []string{"星火计划=业务信息"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ResolveTermLists(tt.file, tt.allow, tt.deny); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
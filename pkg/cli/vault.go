@@ -0,0 +1,42 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"os"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+)
+
+// DefaultVaultProject is the vault project used when none is given.
+const DefaultVaultProject = "default"
+
+// VaultExists reports whether the vault file exists; OpenVault creates missing vaults.
+func VaultExists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
+
+// OpenVault opens or creates the vault file with an entities key:
+// a key file is used as the vault key, a passphrase is stretched with the salt stored in the vault.
+func OpenVault(file string, key *EntitiesKey) (*anonymizer.BoltVault, error) {
+	return anonymizer.OpenBoltVault(&anonymizer.BoltVaultConfig{
+		Path:       file,
+		Key:        key.key,
+		Passphrase: key.passphrase,
+	})
+}
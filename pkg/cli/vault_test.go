@@ -0,0 +1,78 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+)
+
+func TestOpenVault(t *testing.T) {
+	testEntities := []*anonymizer.Entity{
+		{Key: "<个人信息[0].姓名.全名>", EntityType: "个人信息", ID: "0", Category: "姓名", Detail: "全名", Values: []string{"张三"}},
+	}
+
+	passphrase, err := NewPassphraseKey([]byte("correct horse"))
+	if err != nil {
+		t.Fatalf("NewPassphraseKey failed: %v", err)
+	}
+	keyFile, err := LoadEntitiesKeyFile(newTestKeyFile(t, strings.Repeat("ab", 32)+"\n"))
+	if err != nil {
+		t.Fatalf("LoadEntitiesKeyFile failed: %v", err)
+	}
+
+	for name, key := range map[string]*EntitiesKey{"passphrase": passphrase, "key file": keyFile} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "inu.vault")
+			if VaultExists(file) {
+				t.Fatal("Expected the vault not to exist yet")
+			}
+
+			vault, err := OpenVault(file, key)
+			if err != nil {
+				t.Fatalf("OpenVault failed: %v", err)
+			}
+			if err := vault.Put(context.Background(), DefaultVaultProject, testEntities); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+			if err := vault.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+			if !VaultExists(file) {
+				t.Fatal("Expected the vault to exist")
+			}
+
+			vault, err = OpenVault(file, key)
+			if err != nil {
+				t.Fatalf("OpenVault failed: %v", err)
+			}
+			defer vault.Close()
+
+			entity, err := vault.LookupValue(context.Background(), DefaultVaultProject, "张三")
+			if err != nil {
+				t.Fatalf("LookupValue failed: %v", err)
+			}
+			if entity.Key != testEntities[0].Key {
+				t.Errorf("Expected %s, got %s", testEntities[0].Key, entity.Key)
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package eval measures the detection quality of an Anonymizer on a labeled corpus.
+package eval
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rotisserie/eris"
+	"github.com/spf13/viper"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+)
+
+// Annotation 是一个标注的敏感实体：实体类型 (如 "个人信息") 和它在原文中的值。
+type Annotation struct {
+	Type  string `json:"type" yaml:"type" mapstructure:"type"`
+	Value string `json:"value" yaml:"value" mapstructure:"value"`
+}
+
+// Document 是语料中的一篇文本及其标准答案 (gold) 标注。
+type Document struct {
+	Name        string
+	Text        string
+	Annotations []Annotation
+}
+
+// goldFile is the YAML structure of an annotation file.
+type goldFile struct {
+	Entities []Annotation `mapstructure:"entities"`
+}
+
+// LoadCorpus 读取 dir 下的所有 <name>.txt 文本，以及同名的 <name>.yaml 标注文件：
+//
+//	entities:
+//	  - type: 个人信息
+//	    value: 张三
+//
+// 没有敏感实体的文本也必须提供标注文件 (entities 为空)，以免漏写标注被当作无实体。
+// 文本末尾的一个换行会被去掉。返回的文档按名称排序。
+func LoadCorpus(dir string) ([]*Document, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to list corpus: %s", dir)
+	}
+	if len(paths) == 0 {
+		return nil, eris.Errorf("no .txt documents found in corpus: %s", dir)
+	}
+	sort.Strings(paths)
+
+	documents := make([]*Document, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, eris.Wrapf(err, "failed to read document: %s", path)
+		}
+
+		name := strings.TrimSuffix(filepath.Base(path), ".txt")
+		annotations, err := loadAnnotations(strings.TrimSuffix(path, ".txt") + ".yaml")
+		if err != nil {
+			return nil, err
+		}
+
+		text := strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r")
+		documents = append(documents, &Document{Name: name, Text: text, Annotations: annotations})
+	}
+
+	return documents, nil
+}
+
+// loadAnnotations reads an annotation file.
+func loadAnnotations(file string) ([]Annotation, error) {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil, eris.Errorf("annotation file does not exist: %s", file)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(file)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, eris.Wrapf(err, "failed to read annotation file: %s", file)
+	}
+
+	var gold goldFile
+	if err := v.Unmarshal(&gold); err != nil {
+		return nil, eris.Wrapf(err, "failed to parse annotation file: %s", file)
+	}
+
+	for i, annotation := range gold.Entities {
+		if annotation.Type == "" || strings.TrimSpace(annotation.Value) == "" {
+			return nil, eris.Errorf("annotation %d in %s must have a type and a value", i, file)
+		}
+	}
+	return gold.Entities, nil
+}
+
+// Metrics 是一组实体的检测统计。
+// 实体按 (类型, 值) 在每篇文档内去重后比较；分母为 0 时对应的比率为 0。
+type Metrics struct {
+	TruePositives  int     `json:"true_positives"`
+	FalsePositives int     `json:"false_positives"`
+	FalseNegatives int     `json:"false_negatives"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+	F1             float64 `json:"f1"`
+	// Leaks 是标注值在脱敏文本中残留的次数
+	Leaks int `json:"leaks"`
+}
+
+// RoundTrip 统计还原后与原文一致的文档数。
+type RoundTrip struct {
+	Passed int     `json:"passed"`
+	Failed int     `json:"failed"`
+	Rate   float64 `json:"rate"`
+}
+
+// DocumentResult 是单篇文档的评测结果。
+type DocumentResult struct {
+	Name string `json:"name"`
+	// Error 是脱敏或还原失败时的错误信息，此时所有标注都计为漏检
+	Error    string       `json:"error,omitempty"`
+	Missed   []Annotation `json:"missed,omitempty"`
+	Spurious []Annotation `json:"spurious,omitempty"`
+	Leaks    int          `json:"leaks"`
+	// RoundTrip 表示还原后的文本是否与原文一致 (忽略首尾空白)
+	RoundTrip bool `json:"round_trip"`
+}
+
+// Report 是语料的评测报告，JSON 输出字段顺序稳定，可以直接在两次运行之间 diff。
+type Report struct {
+	Documents int                 `json:"documents"`
+	Overall   *Metrics            `json:"overall"`
+	Types     map[string]*Metrics `json:"types"`
+	RoundTrip RoundTrip           `json:"round_trip"`
+	Results   []*DocumentResult   `json:"results"`
+}
+
+// Evaluate 用 anon 脱敏每篇文档，与标注比较后汇总为报告。
+// 模型返回的幻觉值会像 anonymize 命令一样先经 ValidateEntities 去除。
+// 单篇文档失败不会中止评测，失败原因记录在对应的 DocumentResult 中；ctx 取消时返回错误。
+func Evaluate(ctx context.Context, anon anonymizer.Anonymizer, types []string, documents []*Document) (*Report, error) {
+	report := &Report{
+		Documents: len(documents),
+		Overall:   &Metrics{},
+		Types:     make(map[string]*Metrics),
+		Results:   make([]*DocumentResult, 0, len(documents)),
+	}
+
+	for _, document := range documents {
+		result := evaluateDocument(ctx, anon, types, document, report)
+		if err := ctx.Err(); err != nil {
+			return nil, eris.Wrap(err, "evaluation canceled")
+		}
+
+		report.Results = append(report.Results, result)
+		if result.RoundTrip {
+			report.RoundTrip.Passed++
+		} else {
+			report.RoundTrip.Failed++
+		}
+	}
+
+	report.Overall.finish()
+	for _, metrics := range report.Types {
+		metrics.finish()
+	}
+	report.RoundTrip.Rate = ratio(report.RoundTrip.Passed, report.RoundTrip.Passed+report.RoundTrip.Failed)
+
+	return report, nil
+}
+
+// evaluateDocument anonymizes one document and adds its counts to the report.
+func evaluateDocument(ctx context.Context, anon anonymizer.Anonymizer, types []string, document *Document, report *Report) *DocumentResult {
+	result := &DocumentResult{Name: document.Name}
+	gold := annotationSet(document.Annotations)
+
+	var anonymized bytes.Buffer
+	entities, err := anon.Anonymize(ctx, types, document.Text, &anonymized)
+	if err != nil {
+		result.Error = err.Error()
+		for _, annotation := range gold {
+			result.Missed = append(result.Missed, annotation)
+			report.count(annotation.Type, func(m *Metrics) { m.FalseNegatives++ })
+		}
+		sortAnnotations(result.Missed)
+		return result
+	}
+	entities, _ = anonymizer.ValidateEntities(document.Text, anonymized.String(), entities)
+
+	// Compare the detected values with the annotations
+	var detected []Annotation
+	for _, entity := range entities {
+		for _, value := range entity.Values {
+			detected = append(detected, Annotation{Type: entity.EntityType, Value: value})
+		}
+	}
+	predicted := annotationSet(detected)
+
+	for key, annotation := range gold {
+		if _, ok := predicted[key]; ok {
+			report.count(annotation.Type, func(m *Metrics) { m.TruePositives++ })
+			continue
+		}
+		result.Missed = append(result.Missed, annotation)
+		report.count(annotation.Type, func(m *Metrics) { m.FalseNegatives++ })
+	}
+	for key, annotation := range predicted {
+		if _, ok := gold[key]; ok {
+			continue
+		}
+		result.Spurious = append(result.Spurious, annotation)
+		report.count(annotation.Type, func(m *Metrics) { m.FalsePositives++ })
+	}
+	sortAnnotations(result.Missed)
+	sortAnnotations(result.Spurious)
+
+	// Count annotated values left in the anonymized text, attributed to the type of their annotation
+	goldEntities := make([]*anonymizer.Entity, 0, len(gold))
+	goldTypes := make(map[string]string, len(gold))
+	for _, annotation := range gold {
+		key := fmt.Sprintf("<%s[%d].标注.原值>", annotation.Type, len(goldEntities))
+		goldEntities = append(goldEntities, &anonymizer.Entity{
+			Key:        key,
+			EntityType: annotation.Type,
+			ID:         strconv.Itoa(len(goldEntities)),
+			Category:   "标注",
+			Detail:     "原值",
+			Values:     []string{annotation.Value},
+		})
+		goldTypes[key] = annotation.Type
+	}
+	_, leaks := anonymizer.VerifyAnonymized(anonymized.String(), goldEntities, false)
+	result.Leaks = len(leaks.Leaks)
+	for _, leak := range leaks.Leaks {
+		report.count(goldTypes[leak.Placeholder], func(m *Metrics) { m.Leaks++ })
+	}
+
+	// Restore the anonymized text with the detected entities
+	var restored bytes.Buffer
+	failures, err := anon.RestoreText(ctx, entities, anonymized.String(), &restored)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.RoundTrip = len(failures) == 0 && strings.TrimSpace(restored.String()) == strings.TrimSpace(document.Text)
+
+	return result
+}
+
+// count applies update to the metrics of the entity type and to the overall metrics.
+func (r *Report) count(entityType string, update func(*Metrics)) {
+	metrics, ok := r.Types[entityType]
+	if !ok {
+		metrics = &Metrics{}
+		r.Types[entityType] = metrics
+	}
+	update(metrics)
+	update(r.Overall)
+}
+
+// finish computes the ratios from the counts.
+func (m *Metrics) finish() {
+	m.Precision = ratio(m.TruePositives, m.TruePositives+m.FalsePositives)
+	m.Recall = ratio(m.TruePositives, m.TruePositives+m.FalseNegatives)
+	if m.Precision+m.Recall > 0 {
+		m.F1 = round(2 * m.Precision * m.Recall / (m.Precision + m.Recall))
+	}
+}
+
+// ratio returns n/d rounded for stable output, 0 if d is 0.
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return round(float64(n) / float64(d))
+}
+
+// round rounds to 4 decimal places so that reports of identical runs are byte-identical.
+func round(f float64) float64 {
+	return math.Round(f*10000) / 10000
+}
+
+// annotationSet deduplicates annotations by type and trimmed value.
+func annotationSet(annotations []Annotation) map[Annotation]Annotation {
+	set := make(map[Annotation]Annotation, len(annotations))
+	for _, annotation := range annotations {
+		key := Annotation{Type: annotation.Type, Value: strings.TrimSpace(annotation.Value)}
+		if _, ok := set[key]; !ok {
+			set[key] = annotation
+		}
+	}
+	return set
+}
+
+// sortAnnotations sorts annotations by type and value.
+func sortAnnotations(annotations []Annotation) {
+	sort.Slice(annotations, func(i, j int) bool {
+		if annotations[i].Type != annotations[j].Type {
+			return annotations[i].Type < annotations[j].Type
+		}
+		return annotations[i].Value < annotations[j].Value
+	})
+}
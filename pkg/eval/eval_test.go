@@ -0,0 +1,212 @@
+/*
+ * Copyright 2024 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+	"github.com/mrlyc/inu/pkg/anonymizer/anonymizertest"
+)
+
+// writeFile creates a file in dir for the test.
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+}
+
+func TestLoadCorpus(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "b.txt", "没有敏感信息\n")
+	writeFile(t, dir, "b.yaml", "entities: []\n")
+	writeFile(t, dir, "a.txt", "张三的电话是 13800138000\n")
+	writeFile(t, dir, "a.yaml", `entities:
+  - type: 个人信息
+    value: 张三
+  - type: 个人信息
+    value: "13800138000"
+`)
+
+	documents, err := LoadCorpus(dir)
+	if err != nil {
+		t.Fatalf("LoadCorpus failed: %v", err)
+	}
+
+	if len(documents) != 2 || documents[0].Name != "a" || documents[1].Name != "b" {
+		t.Fatalf("unexpected documents: %+v", documents)
+	}
+	if documents[0].Text != "张三的电话是 13800138000" {
+		t.Errorf("expected the trailing newline to be removed, got %q", documents[0].Text)
+	}
+	expected := []Annotation{{Type: "个人信息", Value: "张三"}, {Type: "个人信息", Value: "13800138000"}}
+	if !reflect.DeepEqual(documents[0].Annotations, expected) {
+		t.Errorf("unexpected annotations: %+v", documents[0].Annotations)
+	}
+	if len(documents[1].Annotations) != 0 {
+		t.Errorf("expected no annotations, got %+v", documents[1].Annotations)
+	}
+}
+
+func TestLoadCorpus_MissingAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "a.txt", "张三")
+
+	if _, err := LoadCorpus(dir); err == nil {
+		t.Error("expected an error for a document without annotation file")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	documents := []*Document{
+		{
+			Name: "partial",
+			Text: "张三在北京工作",
+			Annotations: []Annotation{
+				{Type: "个人信息", Value: "张三"},
+				{Type: "位置数据", Value: "北京"},
+			},
+		},
+		{
+			Name:        "spurious",
+			Text:        "李四来了",
+			Annotations: []Annotation{{Type: "个人信息", Value: "李四"}},
+		},
+		{
+			Name:        "failed",
+			Text:        "王五",
+			Annotations: []Annotation{{Type: "个人信息", Value: "王五"}},
+		},
+	}
+
+	chatModel := anonymizertest.NewChatModel(
+		// Detects the name, leaks the location
+		anonymizertest.PairResponse("<个人信息[0].姓名.全名>在北京工作", map[string][]string{
+			"<个人信息[0].姓名.全名>": {"张三"},
+		}, 0),
+		// Detects the name with a wrong type and an extra word
+		anonymizertest.PairResponse("<个人信息[0].姓名.全名><业务信息[0].动作.描述>", map[string][]string{
+			"<个人信息[0].姓名.全名>": {"李四"},
+			"<业务信息[0].动作.描述>": {"来了"},
+		}, 0),
+		anonymizertest.Response{Err: errors.New("model unavailable")},
+	)
+	anon, err := anonymizer.NewHashHidePair(chatModel)
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	report, err := Evaluate(context.Background(), anon, []string{"个人信息"}, documents)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+
+	expectedOverall := &Metrics{
+		TruePositives:  2,
+		FalsePositives: 1,
+		FalseNegatives: 2,
+		Precision:      0.6667,
+		Recall:         0.5,
+		F1:             0.5714,
+		Leaks:          1,
+	}
+	if !reflect.DeepEqual(report.Overall, expectedOverall) {
+		t.Errorf("unexpected overall metrics: %+v", report.Overall)
+	}
+
+	if person := report.Types["个人信息"]; person.TruePositives != 2 || person.FalseNegatives != 1 || person.Recall != 0.6667 {
+		t.Errorf("unexpected 个人信息 metrics: %+v", person)
+	}
+	if location := report.Types["位置数据"]; location.FalseNegatives != 1 || location.Leaks != 1 {
+		t.Errorf("unexpected 位置数据 metrics: %+v", location)
+	}
+	if business := report.Types["业务信息"]; business.FalsePositives != 1 || business.Precision != 0 {
+		t.Errorf("unexpected 业务信息 metrics: %+v", business)
+	}
+
+	if report.RoundTrip != (RoundTrip{Passed: 2, Failed: 1, Rate: 0.6667}) {
+		t.Errorf("unexpected round trip: %+v", report.RoundTrip)
+	}
+
+	failed := report.Results[2]
+	if failed.Error == "" || failed.RoundTrip || len(failed.Missed) != 1 {
+		t.Errorf("unexpected result of the failed document: %+v", failed)
+	}
+	partial := report.Results[0]
+	if partial.Leaks != 1 || !reflect.DeepEqual(partial.Missed, []Annotation{{Type: "位置数据", Value: "北京"}}) {
+		t.Errorf("unexpected result of the partial document: %+v", partial)
+	}
+}
+
+func TestEvaluate_StableReport(t *testing.T) {
+	documents := []*Document{{
+		Name: "contact",
+		Text: "电话 13800138000，邮箱 zhangsan@example.com",
+		Annotations: []Annotation{
+			{Type: "个人信息", Value: "13800138000"},
+			{Type: "个人信息", Value: "zhangsan@example.com"},
+		},
+	}}
+
+	anon, err := anonymizer.NewRuleBased(nil)
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	var encoded []string
+	for i := 0; i < 2; i++ {
+		report, err := Evaluate(context.Background(), anon, anonymizer.DefaultEntityTypes, documents)
+		if err != nil {
+			t.Fatalf("Evaluate failed: %v", err)
+		}
+		data, err := json.Marshal(report)
+		if err != nil {
+			t.Fatalf("failed to marshal report: %v", err)
+		}
+		encoded = append(encoded, string(data))
+
+		if report.Overall.Recall != 1 || report.RoundTrip.Passed != 1 {
+			t.Errorf("unexpected report: %s", data)
+		}
+	}
+
+	if encoded[0] != encoded[1] {
+		t.Errorf("expected identical reports, got\n%s\n%s", encoded[0], encoded[1])
+	}
+}
+
+func TestEvaluate_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	anon, err := anonymizer.NewRuleBased(nil)
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	_, err = Evaluate(ctx, anon, nil, []*Document{{Name: "a", Text: "张三"}})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package web
 
 import (
 	"fmt"
+	"time"
 )
 
 // Config holds the configuration for the web server
@@ -12,6 +13,10 @@ type Config struct {
 	AdminUser string
 	// AdminToken is the admin password/token for HTTP Basic Auth
 	AdminToken string
+	// SessionTTL is how long server-side sessions are kept (session.DefaultTTL if 0)
+	SessionTTL time.Duration
+	// SessionDir stores sessions in files under this directory; sessions are kept in memory if empty
+	SessionDir string
 }
 
 // Validate checks if the configuration is valid
@@ -24,6 +29,9 @@ func (c *Config) Validate() error {
 	if c.AdminToken != "" && c.AdminUser == "" {
 		return fmt.Errorf("admin-user cannot be empty when admin-token is set")
 	}
+	if c.SessionTTL < 0 {
+		return fmt.Errorf("session-ttl cannot be negative")
+	}
 	return nil
 }
 
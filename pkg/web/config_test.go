@@ -2,6 +2,7 @@ package web
 
 import (
 	"testing"
+	"time"
 )
 
 func TestConfig_Validate(t *testing.T) {
@@ -55,6 +56,23 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantError: false,
 		},
+		{
+			name: "session ttl and directory",
+			config: &Config{
+				Addr:       "127.0.0.1:8080",
+				SessionTTL: 30 * time.Minute,
+				SessionDir: "/var/lib/inu/sessions",
+			},
+			wantError: false,
+		},
+		{
+			name: "negative session ttl",
+			config: &Config{
+				Addr:       "127.0.0.1:8080",
+				SessionTTL: -time.Minute,
+			},
+			wantError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -5,10 +5,12 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/mrlyc/inu/pkg/anonymizer"
+	"github.com/mrlyc/inu/pkg/web/session"
 )
 
 // Anonymizer defines the interface for anonymization operations
@@ -20,16 +22,33 @@ type Anonymizer interface {
 type AnonymizeRequest struct {
 	Text        string   `json:"text" binding:"required"`
 	EntityTypes []string `json:"entity_types"`
+	// Strict re-masks entity values left in the anonymized text
+	Strict bool `json:"strict"`
+	// Session keeps the entities on the server; the response only carries a session ID
+	// and entities without their original values
+	Session bool `json:"session"`
 }
 
 // AnonymizeResponse represents the response body for anonymization
 type AnonymizeResponse struct {
-	AnonymizedText string               `json:"anonymized_text"`
-	Entities       []*anonymizer.Entity `json:"entities"`
+	AnonymizedText string                 `json:"anonymized_text"`
+	Entities       []*anonymizer.Entity   `json:"entities"`
+	LeakReport     *anonymizer.LeakReport `json:"leak_report"`
+	// Warnings lists inconsistencies between the entity mapping and the text
+	Warnings []anonymizer.ValidationIssue `json:"warnings,omitempty"`
+	// SessionID identifies the server-side session holding the entities, if requested
+	SessionID string     `json:"session_id,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 // AnonymizeHandler returns a handler for the anonymize endpoint
 func AnonymizeHandler(anon Anonymizer) gin.HandlerFunc {
+	return AnonymizeHandlerWithSessions(anon, nil)
+}
+
+// AnonymizeHandlerWithSessions returns a handler for the anonymize endpoint that can keep
+// the entities in sessions; session requests are rejected if sessions is nil
+func AnonymizeHandlerWithSessions(anon Anonymizer, sessions session.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req AnonymizeRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -51,6 +70,15 @@ func AnonymizeHandler(anon Anonymizer) gin.HandlerFunc {
 			return
 		}
 
+		if req.Session && sessions == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "sessions_disabled",
+				"message": "Sessions are not enabled on this server",
+				"code":    400,
+			})
+			return
+		}
+
 		// Use default entity types if not specified
 		entityTypes := req.EntityTypes
 		if len(entityTypes) == 0 {
@@ -69,10 +97,83 @@ func AnonymizeHandler(anon Anonymizer) gin.HandlerFunc {
 			return
 		}
 
-		// Return successful response
-		c.JSON(http.StatusOK, AnonymizeResponse{
-			AnonymizedText: buf.String(),
+		// Drop hallucinated values and report placeholders that cannot be restored
+		entities, issues := anonymizer.ValidateEntities(req.Text, buf.String(), entities)
+
+		// Verify that no entity value is left in the anonymized text
+		anonymizedText, report := anonymizer.VerifyAnonymized(buf.String(), entities, req.Strict)
+
+		// Record where every entity occurs for highlighting
+		anonymizer.ComputeSpans(req.Text, anonymizedText, entities)
+
+		response := AnonymizeResponse{
+			AnonymizedText: anonymizedText,
 			Entities:       entities,
-		})
+			LeakReport:     report,
+			Warnings:       issues,
+		}
+
+		// Keep the original values on the server
+		if req.Session {
+			created, err := sessions.Create(c.Request.Context(), entities)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":   "session_error",
+					"message": "Failed to create session: " + err.Error(),
+					"code":    500,
+				})
+				return
+			}
+			response.Entities = withoutValues(entities)
+			response.LeakReport = leaksWithoutValues(report)
+			response.Warnings = issuesWithoutValues(issues)
+			response.SessionID = created.ID
+			response.ExpiresAt = &created.ExpiresAt
+		}
+
+		// Return successful response
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// withoutValues returns copies of the entities without their original values.
+// Keys, pseudonyms and span offsets are kept for highlighting.
+func withoutValues(entities []*anonymizer.Entity) []*anonymizer.Entity {
+	stripped := make([]*anonymizer.Entity, 0, len(entities))
+	for _, entity := range entities {
+		e := *entity
+		e.Values = []string{}
+		e.Spans = make([]anonymizer.Span, len(entity.Spans))
+		for i, span := range entity.Spans {
+			span.Value = ""
+			e.Spans[i] = span
+		}
+		stripped = append(stripped, &e)
+	}
+	return stripped
+}
+
+// leaksWithoutValues returns a copy of the report without the leaked values.
+// Placeholders and offsets are kept so that the leaks can still be located.
+func leaksWithoutValues(report *anonymizer.LeakReport) *anonymizer.LeakReport {
+	if report == nil {
+		return nil
+	}
+	stripped := &anonymizer.LeakReport{Leaks: make([]anonymizer.Leak, len(report.Leaks)), Remasked: report.Remasked}
+	for i, leak := range report.Leaks {
+		leak.Value = ""
+		leak.Text = ""
+		stripped.Leaks[i] = leak
+	}
+	return stripped
+}
+
+// issuesWithoutValues returns copies of the validation issues without their entity values
+func issuesWithoutValues(issues []anonymizer.ValidationIssue) []anonymizer.ValidationIssue {
+	stripped := make([]anonymizer.ValidationIssue, len(issues))
+	for i, issue := range issues {
+		issue.Value = ""
+		stripped[i] = issue
 	}
+	return stripped
 }
@@ -13,6 +13,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/mrlyc/inu/pkg/anonymizer"
+	"github.com/mrlyc/inu/pkg/anonymizer/anonymizertest"
 )
 
 func TestAnonymizeHandler_Success(t *testing.T) {
@@ -62,7 +63,12 @@ func TestAnonymizeHandler_Success(t *testing.T) {
 	}
 
 	if len(response.Entities) != 1 {
-		t.Errorf("expected 1 entity, got %d", len(response.Entities))
+		t.Fatalf("expected 1 entity, got %d", len(response.Entities))
+	}
+
+	expectedSpan := anonymizer.Span{Value: "张三", Start: 0, End: 2, AnonymizedStart: 0, AnonymizedEnd: 15}
+	if spans := response.Entities[0].Spans; len(spans) != 1 || spans[0] != expectedSpan {
+		t.Errorf("expected span %+v, got %+v", expectedSpan, spans)
 	}
 }
 
@@ -231,3 +237,172 @@ func TestAnonymizeHandler_CustomEntityTypes(t *testing.T) {
 		t.Errorf("expected entity type '%s', got '%s'", customTypes[0], receivedTypes[0])
 	}
 }
+
+func TestAnonymizeHandler_LeakReport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockAnon := &mockAnonymizer{
+		anonymizeFunc: func(ctx context.Context, types []string, text string, writer io.Writer) ([]*anonymizer.Entity, error) {
+			writer.Write([]byte("<个人信息[0].姓名.全名>和张三"))
+			return []*anonymizer.Entity{
+				{Key: "<个人信息[0].姓名.全名>", Values: []string{"张三"}},
+			}, nil
+		},
+	}
+
+	router := gin.New()
+	router.POST("/anonymize", AnonymizeHandler(mockAnon))
+
+	for _, strict := range []bool{false, true} {
+		body, _ := json.Marshal(AnonymizeRequest{Text: "张三和张三", Strict: strict})
+
+		req := httptest.NewRequest("POST", "/anonymize", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		var response AnonymizeResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+
+		if response.LeakReport == nil || len(response.LeakReport.Leaks) != 1 {
+			t.Fatalf("strict=%v: expected 1 leak, got %+v", strict, response.LeakReport)
+		}
+
+		expected := "<个人信息[0].姓名.全名>和张三"
+		if strict {
+			expected = "<个人信息[0].姓名.全名>和<个人信息[0].姓名.全名>"
+		}
+		if response.AnonymizedText != expected {
+			t.Errorf("strict=%v: expected %q, got %q", strict, expected, response.AnonymizedText)
+		}
+		if response.LeakReport.Remasked != strict {
+			t.Errorf("strict=%v: unexpected remasked flag", strict)
+		}
+	}
+}
+
+func TestAnonymizeHandler_Warnings(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockAnon := &mockAnonymizer{
+		anonymizeFunc: func(ctx context.Context, types []string, text string, writer io.Writer) ([]*anonymizer.Entity, error) {
+			writer.Write([]byte("<个人信息[0].姓名.全名>和<个人信息[1].姓名.全名>"))
+			return []*anonymizer.Entity{
+				{Key: "<个人信息[0].姓名.全名>", Values: []string{"张三", "王五"}},
+			}, nil
+		},
+	}
+
+	router := gin.New()
+	router.POST("/anonymize", AnonymizeHandler(mockAnon))
+
+	body, _ := json.Marshal(AnonymizeRequest{Text: "张三和李四"})
+	req := httptest.NewRequest("POST", "/anonymize", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var response AnonymizeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+
+	expected := []anonymizer.ValidationIssue{
+		{Kind: anonymizer.IssueHallucinatedValue, Placeholder: "<个人信息[0].姓名.全名>", Value: "王五"},
+		{Kind: anonymizer.IssueMissingMapping, Placeholder: "<个人信息[1].姓名.全名>"},
+	}
+	if len(response.Warnings) != len(expected) {
+		t.Fatalf("expected %d warnings, got %+v", len(expected), response.Warnings)
+	}
+	for i := range expected {
+		if response.Warnings[i] != expected[i] {
+			t.Errorf("warning %d: expected %+v, got %+v", i, expected[i], response.Warnings[i])
+		}
+	}
+
+	if len(response.Entities) != 1 || len(response.Entities[0].Values) != 1 || response.Entities[0].Values[0] != "张三" {
+		t.Errorf("expected hallucinated value to be removed, got %+v", response.Entities)
+	}
+}
+
+func TestAnonymizeHandler_StreamingLLM(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	chatModel := anonymizertest.NewChatModel(anonymizertest.PairResponse(
+		"<个人信息[0].姓名.全名>的信息",
+		map[string][]string{"<个人信息[0].姓名.全名>": {"张三"}},
+		3,
+	))
+	anon, err := anonymizer.NewHashHidePair(chatModel)
+	if err != nil {
+		t.Fatalf("failed to create anonymizer: %v", err)
+	}
+
+	router := gin.New()
+	router.POST("/anonymize", AnonymizeHandler(anon))
+
+	body, _ := json.Marshal(AnonymizeRequest{Text: "张三的信息"})
+	req := httptest.NewRequest("POST", "/anonymize", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response AnonymizeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+
+	if response.AnonymizedText != "<个人信息[0].姓名.全名>的信息" {
+		t.Errorf("unexpected anonymized text: %q", response.AnonymizedText)
+	}
+	if len(response.Entities) != 1 || len(response.Warnings) != 0 {
+		t.Errorf("unexpected entities %+v or warnings %+v", response.Entities, response.Warnings)
+	}
+	if chatModel.Calls() != 1 {
+		t.Errorf("expected 1 LLM call, got %d", chatModel.Calls())
+	}
+}
+
+func TestAnonymizeHandler_StreamingLLMError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	chatModel := anonymizertest.NewChatModel(anonymizertest.Response{
+		Tokens:    []string{"<个人信息[0].姓名.全名>"},
+		StreamErr: fmt.Errorf("connection reset"),
+	})
+	anon, err := anonymizer.NewHashHidePair(chatModel)
+	if err != nil {
+		t.Fatalf("failed to create anonymizer: %v", err)
+	}
+
+	router := gin.New()
+	router.POST("/anonymize", AnonymizeHandler(anon))
+
+	body, _ := json.Marshal(AnonymizeRequest{Text: "张三的信息"})
+	req := httptest.NewRequest("POST", "/anonymize", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", w.Code)
+	}
+}
@@ -4,18 +4,33 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
 )
 
 // ConfigResponse represents the configuration response
 type ConfigResponse struct {
 	EntityTypes []string `json:"entity_types"`
+	// EntityTypeDefinitions describes every entity type, in the order of EntityTypes
+	EntityTypeDefinitions []*anonymizer.EntityTypeDefinition `json:"entity_type_definitions"`
 }
 
-// ConfigHandler returns a handler for the GET /api/v1/config endpoint
-func ConfigHandler(entityTypes []string) gin.HandlerFunc {
+// ConfigHandler returns a handler for the GET /api/v1/config endpoint.
+// Types the schema does not define are returned with their name only.
+func ConfigHandler(entityTypes []string, schema *anonymizer.EntityTypeSchema) gin.HandlerFunc {
+	definitions := make([]*anonymizer.EntityTypeDefinition, 0, len(entityTypes))
+	for _, name := range entityTypes {
+		definition := schema.Lookup(name)
+		if definition == nil {
+			definition = &anonymizer.EntityTypeDefinition{Name: name}
+		}
+		definitions = append(definitions, definition)
+	}
+
 	return func(c *gin.Context) {
 		c.JSON(http.StatusOK, ConfigResponse{
-			EntityTypes: entityTypes,
+			EntityTypes:           entityTypes,
+			EntityTypeDefinitions: definitions,
 		})
 	}
 }
@@ -8,6 +8,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
 )
 
 func TestConfigHandler(t *testing.T) {
@@ -42,7 +44,7 @@ func TestConfigHandler(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			router := gin.New()
-			router.GET("/api/v1/config", ConfigHandler(tt.entityTypes))
+			router.GET("/api/v1/config", ConfigHandler(tt.entityTypes, anonymizer.DefaultEntityTypeSchema))
 
 			req := httptest.NewRequest(http.MethodGet, "/api/v1/config", nil)
 			rec := httptest.NewRecorder()
@@ -58,3 +60,30 @@ func TestConfigHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigHandler_Definitions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	schema := &anonymizer.EntityTypeSchema{
+		Types: []*anonymizer.EntityTypeDefinition{
+			{Name: "客户", Description: "客户公司名称", Examples: []string{"某某科技"}},
+		},
+	}
+
+	router := gin.New()
+	router.GET("/api/v1/config", ConfigHandler([]string{"客户", "CUSTOM"}, schema))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/config", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp ConfigResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	if assert.Len(t, resp.EntityTypeDefinitions, 2) {
+		assert.Equal(t, "客户公司名称", resp.EntityTypeDefinitions[0].Description)
+		assert.Equal(t, []string{"某某科技"}, resp.EntityTypeDefinitions[0].Examples)
+		assert.Equal(t, &anonymizer.EntityTypeDefinition{Name: "CUSTOM"}, resp.EntityTypeDefinitions[1])
+	}
+}
@@ -3,12 +3,14 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/mrlyc/inu/pkg/anonymizer"
+	"github.com/mrlyc/inu/pkg/web/session"
 )
 
 // Restorer defines the interface for restoration operations
@@ -18,8 +20,11 @@ type Restorer interface {
 
 // RestoreRequest represents the request body for restoration
 type RestoreRequest struct {
-	AnonymizedText string               `json:"anonymized_text" binding:"required"`
-	Entities       []*anonymizer.Entity `json:"entities" binding:"required"`
+	AnonymizedText string `json:"anonymized_text" binding:"required"`
+	// Entities is the mapping returned by anonymize; required unless SessionID is set
+	Entities []*anonymizer.Entity `json:"entities"`
+	// SessionID restores with the entities kept on the server by anonymize
+	SessionID string `json:"session_id"`
 }
 
 // RestoreResponse represents the response body for restoration
@@ -30,6 +35,12 @@ type RestoreResponse struct {
 
 // RestoreHandler returns a handler for the restore endpoint
 func RestoreHandler(anon Restorer) gin.HandlerFunc {
+	return RestoreHandlerWithSessions(anon, nil)
+}
+
+// RestoreHandlerWithSessions returns a handler for the restore endpoint that can restore
+// with the entities of a session; session requests are rejected if sessions is nil
+func RestoreHandlerWithSessions(anon Restorer, sessions session.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req RestoreRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -51,9 +62,45 @@ func RestoreHandler(anon Restorer) gin.HandlerFunc {
 			return
 		}
 
+		entities := req.Entities
+		switch {
+		case req.SessionID != "" && sessions == nil:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "sessions_disabled",
+				"message": "Sessions are not enabled on this server",
+				"code":    400,
+			})
+			return
+		case req.SessionID != "":
+			found, err := sessions.Get(c.Request.Context(), req.SessionID)
+			if errors.Is(err, session.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error":   "session_not_found",
+					"message": "Session not found or expired",
+					"code":    404,
+				})
+				return
+			} else if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":   "session_error",
+					"message": "Failed to load session: " + err.Error(),
+					"code":    500,
+				})
+				return
+			}
+			entities = found.Entities
+		case entities == nil:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "invalid_input",
+				"message": "Either entities or session_id is required",
+				"code":    400,
+			})
+			return
+		}
+
 		// Call anonymizer to restore text
 		var buf bytes.Buffer
-		failures, err := anon.RestoreText(c.Request.Context(), req.Entities, req.AnonymizedText, &buf)
+		failures, err := anon.RestoreText(c.Request.Context(), entities, req.AnonymizedText, &buf)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":   "restore_error",
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mrlyc/inu/pkg/web/session"
+)
+
+// SessionDeleteHandler returns a handler that deletes a session before it expires
+func SessionDeleteHandler(sessions session.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := sessions.Delete(c.Request.Context(), c.Param("id"))
+		if errors.Is(err, session.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "session_not_found",
+				"message": "Session not found or expired",
+				"code":    404,
+			})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "session_error",
+				"message": "Failed to delete session: " + err.Error(),
+				"code":    500,
+			})
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+	"github.com/mrlyc/inu/pkg/web/session"
+)
+
+func newSessionRouter(sessions session.Store) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	mockAnon := &mockAnonymizer{
+		anonymizeFunc: func(ctx context.Context, types []string, text string, writer io.Writer) ([]*anonymizer.Entity, error) {
+			writer.Write([]byte("<个人信息[0].姓名.全名>的信息"))
+			return []*anonymizer.Entity{
+				{
+					Key:        "<个人信息[0].姓名.全名>",
+					EntityType: "个人信息",
+					ID:         "0",
+					Category:   "姓名",
+					Detail:     "全名",
+					Values:     []string{"张三"},
+				},
+			}, nil
+		},
+		restoreFunc: func(ctx context.Context, entities []*anonymizer.Entity, text string, writer io.Writer) ([]anonymizer.RestoreFailure, error) {
+			for _, entity := range entities {
+				writer.Write([]byte(entity.Values[0]))
+			}
+			return nil, nil
+		},
+	}
+
+	router := gin.New()
+	router.POST("/anonymize", AnonymizeHandlerWithSessions(mockAnon, sessions))
+	router.POST("/restore", RestoreHandlerWithSessions(mockAnon, sessions))
+	if sessions != nil {
+		router.DELETE("/sessions/:id", SessionDeleteHandler(sessions))
+	}
+	return router
+}
+
+func postJSON(router *gin.Engine, path string, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", path, bytes.NewBuffer(data))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSessionFlow(t *testing.T) {
+	router := newSessionRouter(session.NewMemoryStore(time.Minute))
+
+	w := postJSON(router, "/anonymize", AnonymizeRequest{Text: "张三的信息", Session: true})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if bytes.Contains(w.Body.Bytes(), []byte("张三")) {
+		t.Errorf("response must not contain original values: %s", w.Body.String())
+	}
+
+	var anonymized AnonymizeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &anonymized); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if anonymized.SessionID == "" || anonymized.ExpiresAt == nil {
+		t.Fatalf("expected session ID and expiry, got %+v", anonymized)
+	}
+	if len(anonymized.Entities) != 1 || anonymized.Entities[0].Key != "<个人信息[0].姓名.全名>" {
+		t.Errorf("expected entity keys to be returned, got %+v", anonymized.Entities)
+	}
+	if len(anonymized.Entities[0].Spans) != 1 || anonymized.Entities[0].Spans[0].End != 2 {
+		t.Errorf("expected span offsets to be returned, got %+v", anonymized.Entities[0].Spans)
+	}
+
+	w = postJSON(router, "/restore", RestoreRequest{
+		AnonymizedText: anonymized.AnonymizedText,
+		SessionID:      anonymized.SessionID,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var restored RestoreResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &restored); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if restored.RestoredText != "张三" {
+		t.Errorf("unexpected restored text: %s", restored.RestoredText)
+	}
+
+	req := httptest.NewRequest("DELETE", "/sessions/"+anonymized.SessionID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", w.Code)
+	}
+
+	w = postJSON(router, "/restore", RestoreRequest{
+		AnonymizedText: anonymized.AnonymizedText,
+		SessionID:      anonymized.SessionID,
+	})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 after delete, got %d", w.Code)
+	}
+}
+
+func TestSessionAnonymize_NoValuesInResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockAnon := &mockAnonymizer{
+		anonymizeFunc: func(ctx context.Context, types []string, text string, writer io.Writer) ([]*anonymizer.Entity, error) {
+			writer.Write([]byte("<个人信息[0].姓名.全名>和张三，电话 13800138000"))
+			return []*anonymizer.Entity{
+				{Key: "<个人信息[0].姓名.全名>", Values: []string{"张三", "王五"}},
+				{Key: "<个人信息[1].电话.号码>", Values: []string{"13800138000"}},
+			}, nil
+		},
+	}
+
+	router := gin.New()
+	router.POST("/anonymize", AnonymizeHandlerWithSessions(mockAnon, session.NewMemoryStore(time.Minute)))
+
+	for _, strict := range []bool{false, true} {
+		w := postJSON(router, "/anonymize", AnonymizeRequest{Text: "张三和张三，电话 13800138000", Strict: strict, Session: true})
+		if w.Code != http.StatusOK {
+			t.Fatalf("strict=%v: expected status 200, got %d: %s", strict, w.Code, w.Body.String())
+		}
+
+		var response AnonymizeResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		if response.LeakReport == nil || len(response.LeakReport.Leaks) == 0 || len(response.Warnings) == 0 {
+			t.Fatalf("strict=%v: expected leaks and warnings, got %s", strict, w.Body.String())
+		}
+		for _, leak := range response.LeakReport.Leaks {
+			if leak.Placeholder == "" || leak.End <= leak.Start {
+				t.Errorf("strict=%v: expected placeholder and offsets to be kept, got %+v", strict, leak)
+			}
+		}
+
+		// Without strict the leaks stay in the anonymized text, otherwise no original value may be sent
+		values := []string{"王五"}
+		if strict {
+			values = append(values, "张三", "13800138000")
+		}
+		for _, value := range values {
+			if bytes.Contains(w.Body.Bytes(), []byte(value)) {
+				t.Errorf("strict=%v: response must not contain %q: %s", strict, value, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestSessionDeleteHandler_NotFound(t *testing.T) {
+	router := newSessionRouter(session.NewMemoryStore(time.Minute))
+
+	req := httptest.NewRequest("DELETE", "/sessions/unknown", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", w.Code)
+	}
+}
+
+func TestSessionsDisabled(t *testing.T) {
+	router := newSessionRouter(nil)
+
+	w := postJSON(router, "/anonymize", AnonymizeRequest{Text: "张三的信息", Session: true})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for anonymize, got %d", w.Code)
+	}
+
+	w = postJSON(router, "/restore", RestoreRequest{AnonymizedText: "<个人信息[0].姓名.全名>", SessionID: "abc"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for restore, got %d", w.Code)
+	}
+}
+
+func TestRestoreHandler_MissingEntitiesAndSession(t *testing.T) {
+	router := newSessionRouter(session.NewMemoryStore(time.Minute))
+
+	w := postJSON(router, "/restore", map[string]string{"anonymized_text": "<个人信息[0].姓名.全名>"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,6 +15,7 @@ import (
 	"github.com/mrlyc/inu/pkg/anonymizer"
 	"github.com/mrlyc/inu/pkg/web/handlers"
 	"github.com/mrlyc/inu/pkg/web/middleware"
+	"github.com/mrlyc/inu/pkg/web/session"
 )
 
 //go:embed static/*
@@ -28,6 +30,10 @@ type Server struct {
 	engine      *gin.Engine
 	httpServer  *http.Server
 	entityTypes []string
+	schema      *anonymizer.EntityTypeSchema
+	sessions    session.Store
+	stopExpiry  chan struct{}
+	stopOnce    sync.Once
 }
 
 // NewServer creates a new web server instance
@@ -47,11 +53,24 @@ func NewServer(anon anonymizer.Anonymizer, config *Config) (*Server, error) {
 	engine.RedirectTrailingSlash = false
 	engine.RedirectFixedPath = false
 
+	// Sessions keep the entities on the server so that clients only hold a session ID
+	var sessions session.Store = session.NewMemoryStore(config.SessionTTL)
+	if config.SessionDir != "" {
+		store, err := session.NewFileStore(config.SessionDir, config.SessionTTL)
+		if err != nil {
+			return nil, err
+		}
+		sessions = store
+	}
+
 	s := &Server{
 		config:      config,
 		anonymizer:  anon,
 		engine:      engine,
 		entityTypes: anonymizer.DefaultEntityTypes, // 使用默认实体类型
+		schema:      anonymizer.DefaultEntityTypeSchema,
+		sessions:    sessions,
+		stopExpiry:  make(chan struct{}),
 	}
 
 	s.setupRoutes()
@@ -66,6 +85,20 @@ func (s *Server) SetEntityTypes(types []string) {
 	}
 }
 
+// SetEntityTypeSchema sets the definitions of the entity types served by /api/v1/config
+func (s *Server) SetEntityTypeSchema(schema *anonymizer.EntityTypeSchema) {
+	if schema != nil {
+		s.schema = schema
+	}
+}
+
+// SetSessionStore replaces the store of server-side sessions
+func (s *Server) SetSessionStore(store session.Store) {
+	if store != nil {
+		s.sessions = store
+	}
+}
+
 // setupRoutes configures all HTTP routes and middleware
 func (s *Server) setupRoutes() {
 	// Determine if auth is enabled
@@ -125,9 +158,19 @@ func (s *Server) setupRoutes() {
 		v1.Use(middleware.BasicAuth(s.config.AdminUser, s.config.AdminToken))
 	}
 	{
-		v1.GET("/config", handlers.ConfigHandler(s.entityTypes))
-		v1.POST("/anonymize", handlers.AnonymizeHandler(s.anonymizer))
-		v1.POST("/restore", handlers.RestoreHandler(s.anonymizer))
+		// Resolved per request so that SetEntityTypes and SetEntityTypeSchema take effect after setup
+		v1.GET("/config", func(c *gin.Context) {
+			handlers.ConfigHandler(s.entityTypes, s.schema)(c)
+		})
+		v1.POST("/anonymize", func(c *gin.Context) {
+			handlers.AnonymizeHandlerWithSessions(s.anonymizer, s.sessions)(c)
+		})
+		v1.POST("/restore", func(c *gin.Context) {
+			handlers.RestoreHandlerWithSessions(s.anonymizer, s.sessions)(c)
+		})
+		v1.DELETE("/sessions/:id", func(c *gin.Context) {
+			handlers.SessionDeleteHandler(s.sessions)(c)
+		})
 	}
 }
 
@@ -156,8 +199,12 @@ func (s *Server) Start() error {
 	log.Printf("    GET  /api/v1/config")
 	log.Printf("    POST /api/v1/anonymize")
 	log.Printf("    POST /api/v1/restore")
+	log.Printf("    DELETE /api/v1/sessions/:id")
+
+	go s.expireSessions(s.stopExpiry)
 
 	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		s.stopSessionExpiry()
 		return fmt.Errorf("failed to start server: %w", err)
 	}
 
@@ -171,6 +218,7 @@ func (s *Server) Stop() error {
 	}
 
 	log.Println("Shutting down server...")
+	s.stopSessionExpiry()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -182,3 +230,27 @@ func (s *Server) Stop() error {
 	log.Println("Server stopped gracefully")
 	return nil
 }
+
+// stopSessionExpiry stops the session sweeper, it is safe to call more than once
+func (s *Server) stopSessionExpiry() {
+	s.stopOnce.Do(func() {
+		close(s.stopExpiry)
+	})
+}
+
+// expireSessions deletes expired sessions every minute until stop is closed
+func (s *Server) expireSessions(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if _, err := s.sessions.DeleteExpired(context.Background()); err != nil {
+				log.Printf("Failed to delete expired sessions: %v", err)
+			}
+		}
+	}
+}
@@ -2,15 +2,19 @@ package web
 
 import (
 	"context"
+	"encoding/json"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/mrlyc/inu/pkg/anonymizer"
+	"github.com/mrlyc/inu/pkg/web/handlers"
 )
 
 // mockAnonymizer is a simple mock for testing web routes
@@ -159,3 +163,78 @@ func TestHomePageRoute(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "<!DOCTYPE html>", "Should return index.html")
 	assert.Contains(t, w.Body.String(), "Inu", "Should contain app name")
 }
+
+// TestConfigRoute_EntityTypeSchema tests that entity types set after creation are served by /api/v1/config
+func TestConfigRoute_EntityTypeSchema(t *testing.T) {
+	server, err := NewServer(&mockAnonymizer{}, &Config{Addr: "127.0.0.1:8080"})
+	require.NoError(t, err, "Should create server successfully")
+
+	server.SetEntityTypes([]string{"客户"})
+	server.SetEntityTypeSchema(&anonymizer.EntityTypeSchema{
+		Types: []*anonymizer.EntityTypeDefinition{{Name: "客户", Description: "客户公司名称"}},
+	})
+
+	req := httptest.NewRequest("GET", "/api/v1/config", nil)
+	w := httptest.NewRecorder()
+	server.engine.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp handlers.ConfigResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"客户"}, resp.EntityTypes)
+	require.Len(t, resp.EntityTypeDefinitions, 1)
+	assert.Equal(t, "客户公司名称", resp.EntityTypeDefinitions[0].Description)
+}
+
+// TestSessionRoutes tests that anonymize, restore and delete share the server's session store
+func TestSessionRoutes(t *testing.T) {
+	server, err := NewServer(&mockAnonymizer{}, &Config{Addr: "127.0.0.1:8080"})
+	require.NoError(t, err, "Should create server successfully")
+
+	req := httptest.NewRequest("POST", "/api/v1/anonymize", strings.NewReader(`{"text":"hello","session":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.engine.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var anonymized handlers.AnonymizeResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &anonymized))
+	require.NotEmpty(t, anonymized.SessionID)
+
+	req = httptest.NewRequest("POST", "/api/v1/restore", strings.NewReader(`{"anonymized_text":"hello","session_id":"`+anonymized.SessionID+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	server.engine.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req = httptest.NewRequest("DELETE", "/api/v1/sessions/"+anonymized.SessionID, nil)
+	w = httptest.NewRecorder()
+	server.engine.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	req = httptest.NewRequest("DELETE", "/api/v1/sessions/"+anonymized.SessionID, nil)
+	w = httptest.NewRecorder()
+	server.engine.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// TestServerStop_AfterFailedStart tests that a failed Start stops the session sweeper and Stop may be called twice
+func TestServerStop_AfterFailedStart(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	server, err := NewServer(&mockAnonymizer{}, &Config{Addr: listener.Addr().String()})
+	require.NoError(t, err, "Should create server successfully")
+
+	require.Error(t, server.Start(), "Start should fail on an address in use")
+	select {
+	case <-server.stopExpiry:
+	default:
+		t.Error("session sweeper should be stopped after a failed start")
+	}
+
+	assert.NoError(t, server.Stop())
+	assert.NoError(t, server.Stop())
+}
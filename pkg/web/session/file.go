@@ -0,0 +1,152 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+)
+
+// FileStore keeps every session in a JSON file of a directory, so that sessions survive restarts
+// and can be shared by several server processes. Files are only readable by their owner.
+type FileStore struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewFileStore creates a session store in dir whose sessions expire after ttl (DefaultTTL if 0)
+func NewFileStore(dir string, ttl time.Duration) (*FileStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("session directory cannot be empty")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	return &FileStore{
+		dir: dir,
+		ttl: ttlOrDefault(ttl),
+		now: time.Now,
+	}, nil
+}
+
+// Create stores the entities in a new session
+func (f *FileStore) Create(ctx context.Context, entities []*anonymizer.Entity) (*Session, error) {
+	session, err := newSession(entities, f.now(), f.ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode session: %w", err)
+	}
+
+	// Write to a temporary file first so that readers never see a partial session
+	tmp, err := os.CreateTemp(f.dir, ".session-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to write session file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write session file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path(session.ID)); err != nil {
+		return nil, fmt.Errorf("failed to write session file: %w", err)
+	}
+
+	return session, nil
+}
+
+// Get returns a session, or ErrNotFound if it does not exist or has expired
+func (f *FileStore) Get(ctx context.Context, id string) (*Session, error) {
+	if !isValidID(id) {
+		return nil, ErrNotFound
+	}
+
+	session, err := f.read(f.path(id))
+	if err != nil {
+		return nil, err
+	}
+	if session.expired(f.now()) {
+		_ = os.Remove(f.path(id))
+		return nil, ErrNotFound
+	}
+
+	return session, nil
+}
+
+// Delete removes a session, or returns ErrNotFound if it does not exist
+func (f *FileStore) Delete(ctx context.Context, id string) error {
+	if !isValidID(id) {
+		return ErrNotFound
+	}
+
+	if err := os.Remove(f.path(id)); os.IsNotExist(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to delete session file: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes the expired sessions and returns how many were removed
+func (f *FileStore) DeleteExpired(ctx context.Context) (int, error) {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read session directory: %w", err)
+	}
+
+	now := f.now()
+	deleted := 0
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !isValidID(id) {
+			continue
+		}
+
+		session, err := f.read(f.path(id))
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return deleted, err
+		}
+		if session.expired(now) {
+			if err := os.Remove(f.path(id)); err != nil && !os.IsNotExist(err) {
+				return deleted, fmt.Errorf("failed to delete session file: %w", err)
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (f *FileStore) path(id string) string {
+	return filepath.Join(f.dir, id+".json")
+}
+
+func (f *FileStore) read(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read session file: %w", err)
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to decode session file %s: %w", path, err)
+	}
+	return &session, nil
+}
@@ -0,0 +1,91 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+)
+
+// MemoryStore keeps sessions in memory; they are lost when the server stops
+type MemoryStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	sessions map[string]*Session
+	now      func() time.Time
+}
+
+// NewMemoryStore creates an in-memory session store whose sessions expire after ttl (DefaultTTL if 0)
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		ttl:      ttlOrDefault(ttl),
+		sessions: make(map[string]*Session),
+		now:      time.Now,
+	}
+}
+
+// Create stores the entities in a new session
+func (m *MemoryStore) Create(ctx context.Context, entities []*anonymizer.Entity) (*Session, error) {
+	session, err := newSession(entities, m.now(), m.ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[session.ID] = session
+
+	return copySession(session), nil
+}
+
+// Get returns a session, or ErrNotFound if it does not exist or has expired
+func (m *MemoryStore) Get(ctx context.Context, id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if session.expired(m.now()) {
+		delete(m.sessions, id)
+		return nil, ErrNotFound
+	}
+
+	return copySession(session), nil
+}
+
+// Delete removes a session, or returns ErrNotFound if it does not exist
+func (m *MemoryStore) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sessions[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.sessions, id)
+	return nil
+}
+
+// DeleteExpired removes the expired sessions and returns how many were removed
+func (m *MemoryStore) DeleteExpired(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	deleted := 0
+	for id, session := range m.sessions {
+		if session.expired(now) {
+			delete(m.sessions, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func copySession(session *Session) *Session {
+	copied := *session
+	copied.Entities = copyEntities(session.Entities)
+	return &copied
+}
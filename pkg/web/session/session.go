@@ -0,0 +1,90 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+)
+
+// DefaultTTL is how long a session is kept if no TTL is configured
+const DefaultTTL = time.Hour
+
+// idSize is the number of random bytes of a session ID
+const idSize = 16
+
+// ErrNotFound is returned for sessions that do not exist, have expired or were deleted
+var ErrNotFound = errors.New("session not found")
+
+// Session holds the entities of one anonymization on the server, so that clients only keep its ID
+type Session struct {
+	ID        string               `json:"id"`
+	Entities  []*anonymizer.Entity `json:"entities"`
+	CreatedAt time.Time            `json:"created_at"`
+	ExpiresAt time.Time            `json:"expires_at"`
+}
+
+// Store keeps sessions on the server until they expire or are deleted
+type Store interface {
+	// Create stores the entities in a new session
+	Create(ctx context.Context, entities []*anonymizer.Entity) (*Session, error)
+	// Get returns a session, or ErrNotFound if it does not exist or has expired
+	Get(ctx context.Context, id string) (*Session, error)
+	// Delete removes a session, or returns ErrNotFound if it does not exist
+	Delete(ctx context.Context, id string) error
+	// DeleteExpired removes the expired sessions and returns how many were removed
+	DeleteExpired(ctx context.Context) (int, error)
+}
+
+// newSession creates a session with a random opaque ID
+func newSession(entities []*anonymizer.Entity, now time.Time, ttl time.Duration) (*Session, error) {
+	id := make([]byte, idSize)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		ID:        hex.EncodeToString(id),
+		Entities:  copyEntities(entities),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}, nil
+}
+
+// isValidID returns true if id has the format of a session ID.
+// IDs are checked before use so that they can name files safely.
+func isValidID(id string) bool {
+	if len(id) != 2*idSize {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// expired returns true if the session has expired at now
+func (s *Session) expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+// copyEntities returns a deep copy of entities, so that callers cannot modify a stored session
+func copyEntities(entities []*anonymizer.Entity) []*anonymizer.Entity {
+	copied := make([]*anonymizer.Entity, 0, len(entities))
+	for _, entity := range entities {
+		e := *entity
+		e.Values = append([]string(nil), entity.Values...)
+		e.Spans = append([]anonymizer.Span(nil), entity.Spans...)
+		copied = append(copied, &e)
+	}
+	return copied
+}
+
+// ttlOrDefault returns DefaultTTL if ttl is not positive
+func ttlOrDefault(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return DefaultTTL
+	}
+	return ttl
+}
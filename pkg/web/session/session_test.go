@@ -0,0 +1,240 @@
+package session
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+)
+
+func testEntities() []*anonymizer.Entity {
+	return []*anonymizer.Entity{
+		{
+			Key:        "<个人信息[0].姓名.全名>",
+			EntityType: "个人信息",
+			Category:   "姓名",
+			Detail:     "全名",
+			Values:     []string{"张三"},
+			Spans:      []anonymizer.Span{{Start: 0, End: 2, AnonymizedStart: 0, AnonymizedEnd: 15, Value: "张三"}},
+		},
+	}
+}
+
+// testStores returns a memory, a file and a vault store whose clocks are controlled by the returned pointer
+func testStores(t *testing.T, ttl time.Duration) (map[string]Store, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	memory := NewMemoryStore(ttl)
+	memory.now = clock
+
+	file, err := NewFileStore(filepath.Join(t.TempDir(), "sessions"), ttl)
+	if err != nil {
+		t.Fatalf("failed to create file store: %v", err)
+	}
+	file.now = clock
+
+	vault := NewVaultStore(newFakeVault(clock), ttl)
+	vault.now = clock
+
+	return map[string]Store{"memory": memory, "file": file, "vault": vault}, &now
+}
+
+func TestStore_CreateAndGet(t *testing.T) {
+	stores, _ := testStores(t, time.Minute)
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			entities := testEntities()
+
+			created, err := store.Create(ctx, entities)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !isValidID(created.ID) {
+				t.Errorf("invalid session ID: %q", created.ID)
+			}
+			if got := created.ExpiresAt.Sub(created.CreatedAt); got != time.Minute {
+				t.Errorf("expected TTL of 1m, got %v", got)
+			}
+
+			// Changes to the caller's entities must not affect the stored session
+			entities[0].Values[0] = "李四"
+
+			got, err := store.Get(ctx, created.ID)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got.Entities) != 1 || got.Entities[0].Values[0] != "张三" {
+				t.Errorf("unexpected entities: %+v", got.Entities)
+			}
+			if len(got.Entities[0].Spans) != 1 || got.Entities[0].Spans[0].AnonymizedEnd != 15 {
+				t.Errorf("unexpected spans: %+v", got.Entities[0].Spans)
+			}
+		})
+	}
+}
+
+func TestStore_UniqueIDs(t *testing.T) {
+	stores, _ := testStores(t, 0)
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			first, err := store.Create(context.Background(), testEntities())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			second, err := store.Create(context.Background(), testEntities())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if first.ID == second.ID {
+				t.Errorf("expected different session IDs, got %q twice", first.ID)
+			}
+			if got := first.ExpiresAt.Sub(first.CreatedAt); got != DefaultTTL {
+				t.Errorf("expected default TTL, got %v", got)
+			}
+		})
+	}
+}
+
+func TestStore_Expiry(t *testing.T) {
+	stores, now := testStores(t, time.Minute)
+	ctx := context.Background()
+
+	ids := make(map[string]string)
+	for name, store := range stores {
+		created, err := store.Create(ctx, testEntities())
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		ids[name] = created.ID
+	}
+
+	*now = now.Add(time.Minute)
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			if _, err := store.Get(ctx, ids[name]); err != ErrNotFound {
+				t.Errorf("expected ErrNotFound for expired session, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStore_Delete(t *testing.T) {
+	stores, _ := testStores(t, time.Minute)
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			created, err := store.Create(ctx, testEntities())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if err := store.Delete(ctx, created.ID); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, err := store.Get(ctx, created.ID); err != ErrNotFound {
+				t.Errorf("expected ErrNotFound after delete, got %v", err)
+			}
+			if err := store.Delete(ctx, created.ID); err != ErrNotFound {
+				t.Errorf("expected ErrNotFound for second delete, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStore_DeleteExpired(t *testing.T) {
+	stores, now := testStores(t, time.Minute)
+	ctx := context.Background()
+
+	for name, store := range stores {
+		if _, err := store.Create(ctx, testEntities()); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+	}
+	*now = now.Add(30 * time.Second)
+	kept := make(map[string]string)
+	for name, store := range stores {
+		created, err := store.Create(ctx, testEntities())
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		kept[name] = created.ID
+	}
+	*now = now.Add(30 * time.Second)
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			deleted, err := store.DeleteExpired(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if deleted != 1 {
+				t.Errorf("expected 1 expired session, got %d", deleted)
+			}
+			if _, err := store.Get(ctx, kept[name]); err != nil {
+				t.Errorf("expected unexpired session to be kept, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStore_InvalidID(t *testing.T) {
+	stores, _ := testStores(t, time.Minute)
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			for _, id := range []string{"", "../../etc/passwd", "not-a-session-id"} {
+				if _, err := store.Get(context.Background(), id); err != ErrNotFound {
+					t.Errorf("Get(%q): expected ErrNotFound, got %v", id, err)
+				}
+				if err := store.Delete(context.Background(), id); err != ErrNotFound {
+					t.Errorf("Delete(%q): expected ErrNotFound, got %v", id, err)
+				}
+			}
+		})
+	}
+}
+
+func TestFileStore_Persistence(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create file store: %v", err)
+	}
+
+	created, err := store.Create(context.Background(), testEntities())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, created.ID+".json"))
+	if err != nil {
+		t.Fatalf("session file not found: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("expected session file mode 0600, got %o", mode)
+	}
+
+	// A new store on the same directory sees the session
+	reopened, err := NewFileStore(dir, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to reopen file store: %v", err)
+	}
+	got, err := reopened.Get(context.Background(), created.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Entities[0].Values[0] != "张三" {
+		t.Errorf("unexpected entities: %+v", got.Entities)
+	}
+}
+
+func TestNewFileStore_EmptyDir(t *testing.T) {
+	if _, err := NewFileStore("", time.Minute); err == nil {
+		t.Error("expected error for empty directory")
+	}
+}
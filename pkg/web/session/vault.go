@@ -0,0 +1,110 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+)
+
+// vaultProjectPrefix names the vault projects holding sessions, apart from the projects of the CLI
+const vaultProjectPrefix = "web-session/"
+
+// VaultStore keeps every session as a project of an encrypted vault, so that sessions survive
+// restarts and their original values are encrypted at rest. Spans are not kept.
+type VaultStore struct {
+	vault anonymizer.Vault
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+// NewVaultStore creates a session store in vault whose sessions expire after ttl (DefaultTTL if 0)
+func NewVaultStore(vault anonymizer.Vault, ttl time.Duration) *VaultStore {
+	return &VaultStore{
+		vault: vault,
+		ttl:   ttlOrDefault(ttl),
+		now:   time.Now,
+	}
+}
+
+// Create stores the entities in a new session
+func (v *VaultStore) Create(ctx context.Context, entities []*anonymizer.Entity) (*Session, error) {
+	session, err := newSession(entities, v.now(), v.ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := v.vault.Put(ctx, vaultProjectPrefix+session.ID, entities); err != nil {
+		return nil, fmt.Errorf("failed to store session: %w", err)
+	}
+	return session, nil
+}
+
+// Get returns a session, or ErrNotFound if it does not exist or has expired
+func (v *VaultStore) Get(ctx context.Context, id string) (*Session, error) {
+	if !isValidID(id) {
+		return nil, ErrNotFound
+	}
+
+	project, err := v.vault.Project(ctx, vaultProjectPrefix+id)
+	if errors.Is(err, anonymizer.ErrNotInVault) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+
+	session := &Session{
+		ID:        id,
+		CreatedAt: project.CreatedAt,
+		ExpiresAt: project.CreatedAt.Add(v.ttl),
+	}
+	if session.expired(v.now()) {
+		_ = v.vault.DeleteProject(ctx, project.Name)
+		return nil, ErrNotFound
+	}
+
+	session.Entities, err = v.vault.Entities(ctx, project.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	return session, nil
+}
+
+// Delete removes a session, or returns ErrNotFound if it does not exist
+func (v *VaultStore) Delete(ctx context.Context, id string) error {
+	if !isValidID(id) {
+		return ErrNotFound
+	}
+
+	err := v.vault.DeleteProject(ctx, vaultProjectPrefix+id)
+	if errors.Is(err, anonymizer.ErrNotInVault) {
+		return ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes the expired sessions and returns how many were removed
+func (v *VaultStore) DeleteExpired(ctx context.Context) (int, error) {
+	projects, err := v.vault.Projects(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	now := v.now()
+	deleted := 0
+	for _, project := range projects {
+		if !strings.HasPrefix(project.Name, vaultProjectPrefix) || now.Before(project.CreatedAt.Add(v.ttl)) {
+			continue
+		}
+		if err := v.vault.DeleteProject(ctx, project.Name); err != nil && !errors.Is(err, anonymizer.ErrNotInVault) {
+			return deleted, fmt.Errorf("failed to delete session: %w", err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,145 @@
+package session
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mrlyc/inu/pkg/anonymizer"
+)
+
+// fakeVault is an in-memory vault whose clock is controlled by the tests
+type fakeVault struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	projects map[string]*anonymizer.VaultProject
+	entities map[string][]*anonymizer.Entity
+}
+
+func newFakeVault(now func() time.Time) *fakeVault {
+	return &fakeVault{
+		now:      now,
+		projects: make(map[string]*anonymizer.VaultProject),
+		entities: make(map[string][]*anonymizer.Entity),
+	}
+}
+
+func (f *fakeVault) Put(ctx context.Context, project string, entities []*anonymizer.Entity) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, ok := f.projects[project]
+	if !ok {
+		info = &anonymizer.VaultProject{Name: project, CreatedAt: f.now()}
+		f.projects[project] = info
+	}
+	info.UpdatedAt = f.now()
+	f.entities[project] = append(f.entities[project], copyEntities(entities)...)
+	info.Entities = len(f.entities[project])
+	return nil
+}
+
+func (f *fakeVault) Entities(ctx context.Context, project string) ([]*anonymizer.Entity, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.projects[project]; !ok {
+		return nil, anonymizer.ErrNotInVault
+	}
+	return copyEntities(f.entities[project]), nil
+}
+
+func (f *fakeVault) LookupKey(ctx context.Context, project, key string) (*anonymizer.Entity, error) {
+	return nil, anonymizer.ErrNotInVault
+}
+
+func (f *fakeVault) LookupValue(ctx context.Context, project, value string) (*anonymizer.Entity, error) {
+	return nil, anonymizer.ErrNotInVault
+}
+
+func (f *fakeVault) Project(ctx context.Context, project string) (*anonymizer.VaultProject, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, ok := f.projects[project]
+	if !ok {
+		return nil, anonymizer.ErrNotInVault
+	}
+	copied := *info
+	return &copied, nil
+}
+
+func (f *fakeVault) Projects(ctx context.Context) ([]*anonymizer.VaultProject, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	projects := make([]*anonymizer.VaultProject, 0, len(f.projects))
+	for _, info := range f.projects {
+		copied := *info
+		projects = append(projects, &copied)
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Name < projects[j].Name })
+	return projects, nil
+}
+
+func (f *fakeVault) DeleteProject(ctx context.Context, project string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.projects[project]; !ok {
+		return anonymizer.ErrNotInVault
+	}
+	delete(f.projects, project)
+	delete(f.entities, project)
+	return nil
+}
+
+func (f *fakeVault) Close() error {
+	return nil
+}
+
+func TestVaultStore_BoltVault(t *testing.T) {
+	ctx := context.Background()
+	vault, err := anonymizer.OpenBoltVault(&anonymizer.BoltVaultConfig{
+		Path: filepath.Join(t.TempDir(), "inu.vault"),
+		Key:  []byte("0123456789abcdef0123456789abcdef"),
+	})
+	if err != nil {
+		t.Fatalf("failed to open vault: %v", err)
+	}
+	defer vault.Close()
+
+	// Projects of the CLI are not sessions
+	if err := vault.Put(ctx, "default", testEntities()); err != nil {
+		t.Fatalf("failed to store project: %v", err)
+	}
+
+	store := NewVaultStore(vault, time.Minute)
+	created, err := store.Create(ctx, testEntities())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := store.Get(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got.Entities) != 1 || got.Entities[0].Values[0] != "张三" {
+		t.Errorf("unexpected entities: %+v", got.Entities)
+	}
+
+	store.now = func() time.Time { return time.Now().Add(time.Hour) }
+	deleted, err := store.DeleteExpired(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("expected 1 expired session, got %d", deleted)
+	}
+	if _, err := vault.Project(ctx, "default"); err != nil {
+		t.Errorf("expected the CLI project to be kept, got %v", err)
+	}
+}
@@ -16,6 +16,9 @@
         outputText: document.getElementById('output-text'),
         anonymizeBtn: document.getElementById('anonymize-btn'),
         switchToRestoreBtn: document.getElementById('switch-to-restore-btn'),
+        highlightPanels: document.getElementById('highlight-panels'),
+        originalHighlight: document.getElementById('original-highlight'),
+        anonymizedHighlight: document.getElementById('anonymized-highlight'),
 
         // 还原视图
         restoreView: document.getElementById('restore-view'),
@@ -51,7 +54,7 @@
 
             if (response.ok) {
                 const config = await response.json();
-                populateEntityTypes(config.entity_types || []);
+                populateEntityTypes(config.entity_types || [], config.entity_type_definitions || []);
             } else {
                 // 如果配置端点不可用，使用默认类型
                 console.warn('Config endpoint not available, using defaults');
@@ -64,12 +67,14 @@
         }
     }
 
-    function populateEntityTypes(types) {
+    function populateEntityTypes(types, definitions = []) {
+        const descriptions = new Map(definitions.map(definition => [definition.name, definition.description || '']));
         elements.entityTypes.innerHTML = '';
         types.forEach(type => {
             const option = document.createElement('option');
             option.value = type;
             option.textContent = type;
+            option.title = descriptions.get(type) || '';
             option.selected = true; // 默认选中所有类型
             elements.entityTypes.appendChild(option);
         });
@@ -102,7 +107,11 @@
         elements.outputText.classList.add('loading');
         elements.outputText.classList.remove('error');
 
+        // 上一次脱敏的会话不再需要，通知服务器删除
+        deletePreviousSession();
+
         try {
+            // 实体映射保存在服务器端会话中，浏览器只保存会话 ID
             const response = await fetchWithAuth('/api/v1/anonymize', {
                 method: 'POST',
                 headers: {
@@ -110,7 +119,8 @@
                 },
                 body: JSON.stringify({
                     text: text,
-                    entity_types: selectedTypes
+                    entity_types: selectedTypes,
+                    session: true
                 })
             });
 
@@ -120,9 +130,11 @@
                 // 显示结果
                 elements.outputText.textContent = result.anonymized_text;
                 elements.outputText.classList.remove('loading');
+                renderHighlights(text, result.anonymized_text, result.entities);
 
                 // 保存状态到 sessionStorage
                 saveStateToSession({
+                    sessionId: result.session_id,
                     entities: result.entities,
                     anonymizedText: result.anonymized_text,
                     originalText: text,
@@ -157,9 +169,9 @@
         }
         elements.restoreInput.classList.remove('error');
 
-        // 从 sessionStorage 获取实体映射
+        // 从 sessionStorage 获取服务器端会话 ID
         const state = loadStateFromSession();
-        if (!state || !state.entities) {
+        if (!state || !state.sessionId) {
             alert('错误: 未找到实体映射。请先执行脱敏操作。');
             return;
         }
@@ -178,7 +190,7 @@
                 },
                 body: JSON.stringify({
                     anonymized_text: text,
-                    entities: state.entities
+                    session_id: state.sessionId
                 })
             });
 
@@ -186,6 +198,8 @@
                 const result = await response.json();
                 elements.restoreInput.value = result.restored_text;
                 elements.restoreInput.classList.remove('error');
+            } else if (response.status === 404) {
+                alert('还原失败: 会话已过期或已删除，请重新执行脱敏操作。');
             } else {
                 const errorData = await response.json().catch(() => ({}));
                 const errorMsg = errorData.error || `HTTP ${response.status}: ${response.statusText}`;
@@ -208,7 +222,7 @@
         }
 
         // 显示实体映射
-        displayEntityMappings(state.entities);
+        displayEntityMappings(state.entities, state.originalText);
 
         // 显示脱敏文本
         elements.anonymizedTextDisplay.textContent = state.anonymizedText;
@@ -226,6 +240,7 @@
             elements.inputText.value = state.originalText || '';
             elements.outputText.textContent = state.anonymizedText || '';
             elements.switchToRestoreBtn.style.display = 'inline-block';
+            renderHighlights(state.originalText, state.anonymizedText, state.entities);
         }
 
         // 切换视图
@@ -233,7 +248,28 @@
         elements.anonymizeView.style.display = 'block';
     }
 
-    function displayEntityMappings(entities) {
+    // 服务器不返回原始值，由浏览器根据 spans 从用户输入的原文中取出
+    function originalValues(entity, originalText) {
+        const chars = Array.from(originalText || '');
+        const values = [];
+        (entity.spans || []).forEach(span => {
+            const value = chars.slice(span.start, span.end).join('');
+            if (value && !values.includes(value)) {
+                values.push(value);
+            }
+        });
+        return values.length > 0 ? values : (entity.values || []);
+    }
+
+    function deletePreviousSession() {
+        const state = loadStateFromSession();
+        if (state && state.sessionId) {
+            fetchWithAuth('/api/v1/sessions/' + encodeURIComponent(state.sessionId), { method: 'DELETE' })
+                .catch(error => console.error('Delete session error:', error));
+        }
+    }
+
+    function displayEntityMappings(entities, originalText) {
         elements.entityMappingsDisplay.innerHTML = '';
 
         if (!entities || entities.length === 0) {
@@ -245,7 +281,7 @@
             const item = document.createElement('div');
             item.className = 'mapping-item';
             // 显示 key -> values 格式
-            const valuesStr = Array.isArray(entity.values) ? entity.values.join(', ') : String(entity.values);
+            const valuesStr = originalValues(entity, originalText).join(', ');
             item.innerHTML = `
                 <span class="placeholder">${escapeHtml(entity.key)}</span>
                 <span class="arrow">→</span>
@@ -255,6 +291,63 @@
         });
     }
 
+    // ========== 对照高亮 ==========
+    // 使用实体的 spans (字符偏移) 在原文和脱敏文本中标注每一处替换，悬停时同步高亮对应位置
+    function renderHighlights(originalText, anonymizedText, entities) {
+        const original = [];
+        const anonymized = [];
+        const chars = Array.from(originalText || '');
+        (entities || []).forEach(entity => {
+            (entity.spans || []).forEach(span => {
+                const id = original.length;
+                original.push({ start: span.start, end: span.end, id: id, title: entity.key });
+                anonymized.push({ start: span.anonymized_start, end: span.anonymized_end, id: id, title: chars.slice(span.start, span.end).join('') });
+            });
+        });
+
+        if (original.length === 0) {
+            elements.highlightPanels.style.display = 'none';
+            return;
+        }
+
+        renderMarkedText(elements.originalHighlight, originalText || '', original);
+        renderMarkedText(elements.anonymizedHighlight, anonymizedText || '', anonymized);
+        elements.highlightPanels.style.display = 'flex';
+    }
+
+    function renderMarkedText(element, text, ranges) {
+        // 偏移量按 Unicode 码点计算
+        const chars = Array.from(text);
+        const sorted = ranges.slice().sort((a, b) => a.start - b.start);
+
+        element.innerHTML = '';
+        let last = 0;
+        sorted.forEach(range => {
+            if (range.start < last || range.end > chars.length) {
+                return;
+            }
+            element.appendChild(document.createTextNode(chars.slice(last, range.start).join('')));
+
+            const mark = document.createElement('mark');
+            mark.className = 'entity-mark';
+            mark.dataset.span = String(range.id);
+            mark.title = range.title;
+            mark.textContent = chars.slice(range.start, range.end).join('');
+            mark.addEventListener('mouseenter', () => setActiveSpan(range.id, true));
+            mark.addEventListener('mouseleave', () => setActiveSpan(range.id, false));
+            element.appendChild(mark);
+
+            last = range.end;
+        });
+        element.appendChild(document.createTextNode(chars.slice(last).join('')));
+    }
+
+    function setActiveSpan(id, active) {
+        document.querySelectorAll(`.entity-mark[data-span="${id}"]`).forEach(mark => {
+            mark.classList.toggle('active', active);
+        });
+    }
+
     // ========== 自定义实体类型 ==========
     function handleAddCustomType() {
         const customType = prompt('输入自定义实体类型名称（例如: PRODUCT, LOCATION）:');
@@ -306,6 +399,7 @@
             if (state.anonymizedText) {
                 elements.outputText.textContent = state.anonymizedText;
                 elements.switchToRestoreBtn.style.display = 'inline-block';
+                renderHighlights(state.originalText, state.anonymizedText, state.entities);
             }
 
             // 恢复实体类型选择